@@ -0,0 +1,22 @@
+package api
+
+import (
+	"embed"
+)
+
+//go:embed query/*.json
+var querySchemas embed.FS
+
+// QuerySchema returns the request and response JSON Schemas of a user query endpoint, as published over the
+// micro SCHEMA verb.
+func QuerySchema(endpoint string) (request string, response string, err error) {
+	requestSchema, err := querySchemas.ReadFile("query/" + endpoint + ".request.json")
+	if err != nil {
+		return "", "", err
+	}
+	responseSchema, err := querySchemas.ReadFile("query/user.response.json")
+	if err != nil {
+		return "", "", err
+	}
+	return string(requestSchema), string(responseSchema), nil
+}
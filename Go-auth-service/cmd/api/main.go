@@ -1,22 +1,40 @@
 package main
 
 import (
+	"Golang-practice-2023/api"
+	backfillRepository "Golang-practice-2023/internal/backfill/repository"
+	backfillService "Golang-practice-2023/internal/backfill/service"
+	outboxRepository "Golang-practice-2023/internal/outbox/repository"
+	outboxService "Golang-practice-2023/internal/outbox/service"
+	grpcHandler "Golang-practice-2023/internal/transport/grpc/handler"
+	queryHandler "Golang-practice-2023/internal/transport/micro/handler"
 	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/internal/transport/rest/middleware"
 	"Golang-practice-2023/internal/user/repository"
 	"Golang-practice-2023/internal/user/service"
+	webhookRepository "Golang-practice-2023/internal/webhook/repository"
+	webhookService "Golang-practice-2023/internal/webhook/service"
 	"Golang-practice-2023/pkg/health"
 	"Golang-practice-2023/pkg/logger"
 	"Golang-practice-2023/pkg/migration"
 	"Golang-practice-2023/pkg/pgconnect"
-	"Golang-practice-2023/pkg/pubsub/nats/pub"
+	"Golang-practice-2023/pkg/pubsub/bus"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	grpcHealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -49,13 +67,14 @@ func main() {
 	if err != nil {
 		myLogger.Fatal(fmt.Sprintf("Failed to get Postgresql port: %s", err))
 	}
-	db, err := pgconnect.ConnectDatabase(pgconnect.ConnectionConfigData{
+	pgConfig := pgconnect.ConnectionConfigData{
 		Username:     os.Getenv("POSTGRES_USERNAME"),
 		Password:     os.Getenv("POSTGRES_PASSWORD"),
 		DatabaseName: os.Getenv("POSTGRES_DATABASE"),
 		Port:         pgPort,
 		Host:         os.Getenv("POSTGRES_HOST"),
-	})
+	}
+	db, err := pgconnect.ConnectDatabase(pgConfig)
 	_ = db
 
 	migrationData, err := migration.New(db.DB, "file://schemas")
@@ -68,27 +87,97 @@ func main() {
 		}
 	}
 
-	publisher, err := pub.New(fmt.Sprintf("nats://%s:%s", os.Getenv("NATS_HOST"), os.Getenv("NATS_PORT")), myLogger)
+	busConfig := bus.Config{
+		Backend:                  os.Getenv("EVENT_BUS"),
+		NatsURL:                  fmt.Sprintf("nats://%s:%s", os.Getenv("NATS_HOST"), os.Getenv("NATS_PORT")),
+		PostgresConnectionString: os.Getenv("EVENT_BUS_POSTGRES_URL"),
+		PostgresChannel:          os.Getenv("EVENT_BUS_POSTGRES_CHANNEL"),
+	}
+	if busConfig.PostgresConnectionString == "" {
+		busConfig.PostgresConnectionString = pgconnect.ConnectionString(pgConfig)
+	}
+	if busConfig.Backend == bus.BackendMemory {
+		myLogger.Warning("In-memory event bus selected, user events will not leave this process")
+	}
+	publisher, err := bus.NewPublisher(busConfig, myLogger)
 	if err != nil {
-		myLogger.Fatal(fmt.Sprintf("Failed to connect NATS: %s", err.Error()))
+		myLogger.Fatal(fmt.Sprintf("Failed to connect event bus: %s", err.Error()))
 	}
 
-	//subscriber, err := sub.New(fmt.Sprintf("nats://%s:%s", os.Getenv("NATS_HOST"), os.Getenv("NATS_PORT")), myLogger)
-	//_, err = subscriber.Subscribe("NewUser", func(msg *nats.Msg) {
-	//	fmt.Println("Received message: " + string(msg.Data))
-	//})
+	userRepository := repository.New(db, myLogger)
+	eventSchemas, err := api.NewEventRegistry()
 	if err != nil {
-		myLogger.Warning("Failed to subscribe")
+		myLogger.Fatal(fmt.Sprintf("Failed to load event schemas: %s", err.Error()))
 	}
+	userService := service.New(userRepository, eventSchemas, myLogger)
 
-	userRepository := repository.New(db, myLogger)
-	userService := service.New(userRepository, myLogger, publisher)
+	relay, err := outboxService.NewRelay(outboxRepository.New(db, myLogger), publisher, outboxService.DefaultConfig(),
+		prometheus.DefaultRegisterer, myLogger)
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to create outbox relay: %s", err.Error()))
+	}
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayStopped := make(chan struct{})
+	go func() {
+		relay.Run(relayCtx)
+		close(relayStopped)
+	}()
 	userHandler := handler.New(userService, myLogger)
 
+	backfillConfig := backfillService.DefaultConfig()
+	if subject := os.Getenv("BACKFILL_SUBJECT"); subject != "" {
+		backfillConfig.Subject = subject
+	}
+	if rate := os.Getenv("BACKFILL_RATE"); rate != "" {
+		backfillConfig.RatePerSecond, err = strconv.Atoi(rate)
+		if err != nil {
+			myLogger.Fatal(fmt.Sprintf("Failed to get backfill rate: %s", err.Error()))
+		}
+	}
+	backfills := backfillService.New(backfillRepository.New(db, myLogger), publisher, eventSchemas, backfillConfig, myLogger)
+	backfillCtx, stopBackfills := context.WithCancel(context.Background())
+	backfillsStopped := make(chan struct{})
+	go func() {
+		backfills.Run(backfillCtx)
+		close(backfillsStopped)
+	}()
+
+	webhooks := webhookService.New(webhookRepository.New(db, myLogger), webhookService.DefaultConfig(), myLogger)
+	userRepository.OnChange(webhooks.OnUserChange)
+	webhookHandler := handler.NewWebhookHandler(webhooks, myLogger)
+	webhookCtx, stopWebhooks := context.WithCancel(context.Background())
+	webhooksStopped := make(chan struct{})
+	go func() {
+		webhooks.Run(webhookCtx)
+		close(webhooksStopped)
+	}()
+
 	port := os.Getenv("PORT")
 
+	spec, err := api.Load()
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to load OpenAPI spec: %s", err.Error()))
+	}
+	v1 := handler.Version{Name: "v1", Routes: []handler.RoutesInitializer{userHandler.InitRoutes}}
+
+	specValidator, err := middleware.OpenAPIValidator(spec, myLogger, v1.Prefix(), "/")
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to create OpenAPI validator: %s", err.Error()))
+	}
+
+	legacyDeprecation, err := time.Parse(time.RFC3339, os.Getenv("LEGACY_API_DEPRECATION"))
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to get legacy API deprecation date: %s", err.Error()))
+	}
+	var legacySunset *time.Time
+	if sunset, err := time.Parse(time.RFC3339, os.Getenv("LEGACY_API_SUNSET")); err == nil {
+		legacySunset = &sunset
+	}
+
 	router := mux.NewRouter()
-	userHandler.InitRoutes(router)
+	router.Use(specValidator)
+	handler.InitVersionedRoutes(router, v1)
+	handler.NewOpenAPIHandler(spec, myLogger).InitRoutes(router)
 	router.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
@@ -98,8 +187,16 @@ func main() {
 		}
 	})
 
+	router.Handle("/metrics", promhttp.Handler())
+
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.AdminToken(os.Getenv("ADMIN_TOKEN"), myLogger))
+	handler.NewBackfillHandler(backfills, myLogger).InitRoutes(adminRouter)
+	webhookHandler.InitRoutes(adminRouter)
+
+	handler.InitLegacyRoutes(router, v1, legacyDeprecation, legacySunset)
+
 	defer cancel()
-	defer publisher.Conn.Close()
 
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -117,6 +214,39 @@ func main() {
 		}
 	}()
 
+	grpcListener, err := net.Listen("tcp", ":"+os.Getenv("GRPC_PORT"))
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to listen gRPC port: %s", err.Error()))
+	}
+	grpcSrv := grpc.NewServer()
+	grpcHandler.New(userService, myLogger).Register(grpcSrv)
+	grpcHealthSrv := grpcHealth.NewServer()
+	grpc_health_v1.RegisterHealthServer(grpcSrv, grpcHealthSrv)
+	grpcHealthSrv.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpcHealthSrv.SetServingStatus("user.v1.UserService", grpc_health_v1.HealthCheckResponse_SERVING)
+
+	go func() {
+		if err := grpcSrv.Serve(grpcListener); err != nil {
+			myLogger.Error("Could not start the gRPC server: " + err.Error())
+		}
+	}()
+
+	// User lookups are served over NATS request-reply whenever a NATS server is configured, whatever the event bus.
+	var queryConn *nats.Conn
+	var querySvc micro.Service
+	if os.Getenv("NATS_HOST") != "" {
+		queryConn, err = nats.Connect(busConfig.NatsURL, nats.Name("go-auth-users"))
+		if err != nil {
+			myLogger.Fatal(fmt.Sprintf("Failed to connect user query API: %s", err.Error()))
+		}
+		querySvc, err = queryHandler.New(userService, queryHandler.DefaultConfig(), myLogger).Start(queryConn)
+		if err != nil {
+			myLogger.Fatal(fmt.Sprintf("Failed to start user query API: %s", err.Error()))
+		}
+	} else {
+		myLogger.Warning("NATS_HOST is not set, the user query API is disabled")
+	}
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	signal.Notify(c, syscall.SIGTERM)
@@ -143,8 +273,44 @@ func main() {
 	ctx2, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	grpcHealthSrv.Shutdown()
+	stopWebhooks()
+	if querySvc != nil {
+		if err := querySvc.Stop(); err != nil {
+			myLogger.Warning(fmt.Sprintf("Failed to stop user query API: %s", err.Error()))
+		}
+		if err := queryConn.Drain(); err != nil {
+			myLogger.Warning(fmt.Sprintf("Failed to drain user query API connection: %s", err.Error()))
+		}
+	}
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcSrv.GracefulStop()
+		close(grpcStopped)
+	}()
+
 	err = srv.Shutdown(ctx2)
 	if err != nil {
 		myLogger.Fatal("Could not shutdown the server (after getting signal): " + err.Error())
 	}
+
+	stopRelay()
+	stopBackfills()
+	<-relayStopped
+	<-backfillsStopped
+	<-webhooksStopped
+	if err := publisher.Close(); err != nil {
+		myLogger.Warning(fmt.Sprintf("Failed to close event bus: %s", err.Error()))
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-ctx2.Done():
+		myLogger.Warning("gRPC server did not stop in time, closing remaining streams")
+		grpcSrv.Stop()
+	}
+
+	if err := db.Close(); err != nil {
+		myLogger.Warning(fmt.Sprintf("Failed to close database: %s", err.Error()))
+	}
 }
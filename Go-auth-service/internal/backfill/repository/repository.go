@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/backfill"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/user"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+const jobColumns = `id, subject, status, createdAfter, createdBefore, fromId, toId, ratePerSecond, total, published,
+	cursorId, lastError, createdAt, updatedAt, finishedAt`
+
+type Repository struct {
+	db     *sqlx.DB
+	logger logger.Logger
+}
+
+func New(db *sqlx.DB, logger logger.Logger) *Repository {
+	return &Repository{db: db, logger: logger}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (r *Repository) Create(ctx context.Context, job *backfill.Job) error {
+	conditions, args := rangeConditions(job, []interface{}{job.Subject, job.CreatedAfter, job.CreatedBefore,
+		job.FromID, job.ToID, job.RatePerSecond})
+	query := fmt.Sprintf(`INSERT INTO backfill (subject, createdAfter, createdBefore, fromId, toId, ratePerSecond, total)
+		SELECT $1, $2, $3, $4, $5, $6, count(*) FROM account WHERE %s
+		RETURNING %s`, conditions, jobColumns)
+
+	created, err := scanJob(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	*job = *created
+
+	return nil
+}
+
+func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*backfill.Job, error) {
+	query := fmt.Sprintf("SELECT %s FROM backfill WHERE id=$1", jobColumns)
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrBackfillNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return job, nil
+}
+
+func (r *Repository) List(ctx context.Context) ([]backfill.Job, error) {
+	query := fmt.Sprintf("SELECT %s FROM backfill ORDER BY createdAt DESC", jobColumns)
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	jobs := make([]backfill.Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return jobs, nil
+}
+
+func (r *Repository) SetStatus(ctx context.Context, id uuid.UUID, from []backfill.Status, status backfill.Status) (*backfill.Job, error) {
+	query := fmt.Sprintf(`UPDATE backfill SET status=$2, updatedAt=current_timestamp, leaseUntil=current_timestamp,
+		finishedAt=CASE WHEN $2 IN ('finished', 'cancelled') THEN current_timestamp END
+		WHERE id=$1 AND status = ANY($3)
+		RETURNING %s`, jobColumns)
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, id, string(status), statusesToArray(from)))
+	if err == sql.ErrNoRows {
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, apperrors.ErrBackfillStateConflict
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return job, nil
+}
+
+func (r *Repository) Claim(ctx context.Context, lease time.Duration) (*backfill.Job, error) {
+	query := fmt.Sprintf(`WITH due AS (
+		SELECT id FROM backfill
+		WHERE status = 'running' AND leaseUntil <= current_timestamp
+		ORDER BY leaseUntil
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	UPDATE backfill b SET leaseUntil = current_timestamp + $1 * interval '1 millisecond'
+	FROM due
+	WHERE b.id = due.id
+	RETURNING %s`, prefixedJobColumns("b"))
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, lease.Milliseconds()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return job, nil
+}
+
+func (r *Repository) NextUsers(ctx context.Context, job *backfill.Job, limit int) ([]user.User, error) {
+	conditions, args := rangeConditions(job, nil)
+	if job.Cursor != nil {
+		args = append(args, *job.Cursor)
+		conditions += fmt.Sprintf(" AND id > $%d", len(args))
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf("SELECT id, email, createdAt, updatedAt FROM account WHERE %s ORDER BY id LIMIT $%d",
+		conditions, len(args))
+
+	users := make([]user.User, 0, limit)
+	if err := r.db.SelectContext(ctx, &users, query, args...); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return users, nil
+}
+
+func (r *Repository) Advance(ctx context.Context, job *backfill.Job, retryIn time.Duration) error {
+	query := `UPDATE backfill SET cursorId=$2, published=$3, lastError=$4, updatedAt=current_timestamp,
+		leaseUntil=current_timestamp + $5 * interval '1 millisecond'
+		WHERE id=$1`
+
+	_, err := r.db.ExecContext(ctx, query, job.ID, job.Cursor, job.Published, job.LastError, retryIn.Milliseconds())
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) Finish(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE backfill SET status='finished', lastError='', updatedAt=current_timestamp, finishedAt=current_timestamp
+		WHERE id=$1 AND status='running'`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+// rangeConditions appends the bounds of the job's range to args and returns the matching conditions on
+// the account table.
+func rangeConditions(job *backfill.Job, args []interface{}) (string, []interface{}) {
+	conditions := []string{"true"}
+	if job.CreatedAfter != nil {
+		args = append(args, *job.CreatedAfter)
+		conditions = append(conditions, fmt.Sprintf("createdAt > $%d", len(args)))
+	}
+	if job.CreatedBefore != nil {
+		args = append(args, *job.CreatedBefore)
+		conditions = append(conditions, fmt.Sprintf("createdAt < $%d", len(args)))
+	}
+	if job.FromID != nil {
+		args = append(args, *job.FromID)
+		conditions = append(conditions, fmt.Sprintf("id >= $%d", len(args)))
+	}
+	if job.ToID != nil {
+		args = append(args, *job.ToID)
+		conditions = append(conditions, fmt.Sprintf("id <= $%d", len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func scanJob(row rowScanner) (*backfill.Job, error) {
+	var job backfill.Job
+	err := row.Scan(&job.ID, &job.Subject, &job.Status, &job.CreatedAfter, &job.CreatedBefore, &job.FromID, &job.ToID,
+		&job.RatePerSecond, &job.Total, &job.Published, &job.Cursor, &job.LastError, &job.CreatedAt, &job.UpdatedAt,
+		&job.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.UpdateProgress()
+	return &job, nil
+}
+
+func prefixedJobColumns(alias string) string {
+	columns := strings.Split(jobColumns, ",")
+	for i, column := range columns {
+		columns[i] = alias + "." + strings.TrimSpace(column)
+	}
+	return strings.Join(columns, ", ")
+}
+
+func statusesToArray(statuses []backfill.Status) pq.StringArray {
+	array := make(pq.StringArray, len(statuses))
+	for i, status := range statuses {
+		array[i] = string(status)
+	}
+	return array
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/backfill"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/pkg/cloudevents"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+const (
+	eventSource    = "/go-auth"
+	maxErrorLength = 512
+
+	// JobHeader carries the id of the backfill job on every replayed message.
+	JobHeader = "Backfill-Id"
+)
+
+type Config struct {
+	// Subject is where jobs that do not name one publish. It must be kept by the event stream, the default
+	// falls under users.>.
+	Subject          string
+	RatePerSecond    int
+	MaxRatePerSecond int
+	BatchSize        int
+	PollInterval     time.Duration
+	Lease            time.Duration
+	RetryDelay       time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Subject:          "users.replay",
+		RatePerSecond:    100,
+		MaxRatePerSecond: 5000,
+		BatchSize:        500,
+		PollInterval:     time.Second,
+		Lease:            30 * time.Second,
+		RetryDelay:       10 * time.Second,
+	}
+}
+
+// Service runs backfill jobs: it republishes the users of the auth database, so that consumers can rebuild
+// their copies without reading it. Progress is stored after every batch, so a job survives restarts and
+// several instances can run jobs side by side.
+type Service struct {
+	repository backfill.Repository
+	publisher  pubsub.Publisher
+	schemas    *cloudevents.Registry
+	config     Config
+	logger     logger.Logger
+}
+
+func New(repository backfill.Repository, publisher pubsub.Publisher, schemas *cloudevents.Registry, config Config,
+	logger logger.Logger) *Service {
+	return &Service{repository: repository, publisher: publisher, schemas: schemas, config: config, logger: logger}
+}
+
+func (service *Service) Start(ctx context.Context, job *backfill.Job) error {
+	if job.Subject == "" {
+		job.Subject = service.config.Subject
+	}
+	if err := validateSubject(job.Subject); err != nil {
+		return err
+	}
+	if job.CreatedAfter != nil && job.CreatedBefore != nil && !job.CreatedAfter.Before(*job.CreatedBefore) {
+		return apperrors.ErrInvalidBackfillRange
+	}
+	if job.FromID != nil && job.ToID != nil && bytes.Compare(job.FromID[:], job.ToID[:]) > 0 {
+		return apperrors.ErrInvalidBackfillRange
+	}
+	if job.RatePerSecond == 0 {
+		job.RatePerSecond = service.config.RatePerSecond
+	}
+	if job.RatePerSecond < 0 || job.RatePerSecond > service.config.MaxRatePerSecond {
+		return apperrors.ErrInvalidBackfillRate
+	}
+
+	if err := service.repository.Create(ctx, job); err != nil {
+		return err
+	}
+	service.logger.Info(fmt.Sprintf("Started backfill %s of %d users to %s", job.ID, job.Total, job.Subject))
+	return nil
+}
+
+func (service *Service) Get(ctx context.Context, id uuid.UUID) (*backfill.Job, error) {
+	return service.repository.Get(ctx, id)
+}
+
+func (service *Service) List(ctx context.Context) ([]backfill.Job, error) {
+	return service.repository.List(ctx)
+}
+
+// Pause stops a running job after its current batch; Resume continues it from its cursor.
+func (service *Service) Pause(ctx context.Context, id uuid.UUID) (*backfill.Job, error) {
+	return service.repository.SetStatus(ctx, id, []backfill.Status{backfill.StatusRunning}, backfill.StatusPaused)
+}
+
+func (service *Service) Resume(ctx context.Context, id uuid.UUID) (*backfill.Job, error) {
+	return service.repository.SetStatus(ctx, id, []backfill.Status{backfill.StatusPaused}, backfill.StatusRunning)
+}
+
+func (service *Service) Cancel(ctx context.Context, id uuid.UUID) (*backfill.Job, error) {
+	return service.repository.SetStatus(ctx, id, []backfill.Status{backfill.StatusRunning, backfill.StatusPaused},
+		backfill.StatusCancelled)
+}
+
+// Run publishes the batches of running jobs until ctx is cancelled.
+func (service *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(service.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			published, err := service.PublishBatch(ctx)
+			if err != nil {
+				service.logger.Warning(fmt.Sprintf("Failed to run backfill: %s", err.Error()))
+				break
+			}
+			if published == 0 {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishBatch claims a running job and publishes its next batch of users at the job's rate, one second
+// worth of them at most. It returns how many users were published; a job with none left is finished. The
+// progress is stored even if ctx is cancelled midway, so that the job resumes after the last published user.
+func (service *Service) PublishBatch(ctx context.Context) (int, error) {
+	job, err := service.repository.Claim(ctx, service.config.Lease)
+	if err != nil || job == nil {
+		return 0, err
+	}
+
+	limit := job.RatePerSecond
+	if limit > service.config.BatchSize {
+		limit = service.config.BatchSize
+	}
+	users, err := service.repository.NextUsers(ctx, job, limit)
+	if err != nil {
+		_ = service.repository.Advance(context.Background(), job, service.config.RetryDelay)
+		return 0, err
+	}
+	if len(users) == 0 {
+		if err := service.repository.Finish(context.Background(), job.ID); err != nil {
+			return 0, err
+		}
+		service.logger.Info(fmt.Sprintf("Finished backfill %s after publishing %d users", job.ID, job.Published))
+		return 0, nil
+	}
+
+	interval := time.Second / time.Duration(job.RatePerSecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	published := 0
+	job.LastError = ""
+	var retryIn time.Duration
+	for i := range users {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := service.publish(job, &users[i]); err != nil {
+			job.LastError = truncate(err.Error())
+			retryIn = service.config.RetryDelay
+			service.logger.Warning(fmt.Sprintf("Failed to publish backfill %s: %s", job.ID, err.Error()))
+			break
+		}
+		published++
+		job.Published++
+		job.Cursor = &users[i].ID
+	}
+
+	if err := service.repository.Advance(context.Background(), job, retryIn); err != nil {
+		return published, err
+	}
+	return published, nil
+}
+
+// publish sends the user as a users.created event. The event id is derived from the job, the user and its
+// version, so that republishing after a crash is dropped by the stream's and the consumers' deduplication.
+func (service *Service) publish(job *backfill.Job, u *user.User) error {
+	schema, err := service.schemas.Latest(event.SubjectUserCreated)
+	if err != nil {
+		return err
+	}
+
+	ce, err := cloudevents.New(eventSource, event.SubjectUserCreated, schema, event.UserCreated{
+		ID:        u.ID,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	ce.ID = uuid.NewSHA1(job.ID, []byte(u.ID.String()+"@"+u.UpdatedAt.UTC().Format(time.RFC3339Nano))).String()
+	ce.Subject = u.ID.String()
+	if err := service.schemas.Validate(ce); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(ce)
+	if err != nil {
+		return err
+	}
+
+	return service.publisher.Publish(&pubsub.Message{
+		ID:      ce.ID,
+		Subject: job.Subject,
+		Headers: map[string][]string{JobHeader: {job.ID.String()}},
+		Data:    data,
+	})
+}
+
+// validateSubject accepts a literal subject that is not one of the live user event subjects, so that a
+// replay never looks like a change to consumers of those.
+func validateSubject(subject string) error {
+	switch subject {
+	case event.SubjectUserCreated, event.SubjectUserUpdated, event.SubjectUserDeleted:
+		return apperrors.ErrInvalidBackfillSubject
+	}
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" || token == "*" || token == ">" || strings.ContainsAny(token, " \t\r\n") {
+			return apperrors.ErrInvalidBackfillSubject
+		}
+	}
+	return nil
+}
+
+func truncate(message string) string {
+	if len(message) > maxErrorLength {
+		return message[:maxErrorLength]
+	}
+	return message
+}
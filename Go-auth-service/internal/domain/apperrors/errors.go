@@ -12,7 +12,30 @@ var ErrInvalidIdFormat = errors.New("invalid id format (not uuid)")
 var ErrInvalidOffsetFormat = errors.New("invalid offset format")
 var ErrInvalidLimitFormat = errors.New("invalid limit format")
 var ErrInvalidDateFormat = errors.New("invalid date format")
+var ErrUnsupportedImportFormat = errors.New("unsupported import format")
+var ErrInvalidImportRow = errors.New("invalid import row")
+var ErrImportJobNotFound = errors.New("import job not found")
+var ErrImportTooLarge = errors.New("import data is too large")
+var ErrImportInterrupted = errors.New("import was interrupted")
+var ErrUnsupportedExportFormat = errors.New("unsupported export format")
+var ErrRequestValidation = errors.New("request does not match the api specification")
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+var ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+var ErrInvalidWebhookURL = errors.New("invalid webhook url")
+var ErrWebhookURLNotAllowed = errors.New("webhook url resolves to a private address")
+var ErrInvalidWebhookEventType = errors.New("invalid webhook event type")
+var ErrInvalidDeliveryStatus = errors.New("invalid delivery status")
+var ErrBackfillNotFound = errors.New("backfill job not found")
+var ErrInvalidBackfillSubject = errors.New("invalid backfill subject")
+var ErrInvalidBackfillRange = errors.New("invalid backfill range")
+var ErrInvalidBackfillRate = errors.New("invalid backfill rate")
+var ErrBackfillStateConflict = errors.New("backfill job is not in a state allowing this")
+var ErrUnauthorized = errors.New("unauthorized")
+var ErrWatcherBehind = errors.New("watcher fell behind and missed changes")
 
 var ErrInternalJsonProcessing = errors.New("failed to process json")
 var ErrNatsPublishing = errors.New("failed to publish message to NATS")
 var ErrDbQueryProcessing = errors.New("failed to execute query to db")
+var ErrImportSpooling = errors.New("failed to store import data")
+var ErrWebhookSecretGeneration = errors.New("failed to generate webhook secret")
+var ErrEventValidation = errors.New("event does not match its schema")
@@ -0,0 +1,49 @@
+package backfill
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusPaused    Status = "paused"
+	StatusFinished  Status = "finished"
+	StatusCancelled Status = "cancelled"
+)
+
+// Job republishes the current state of the users in its range as users.created events on Subject. Users
+// are published in id order and Cursor is the last one published, so a paused or interrupted job resumes
+// after it. Total is counted when the job starts; users registered later in the range are published too.
+type Job struct {
+	ID            uuid.UUID  `json:"id"`
+	Subject       string     `json:"subject"`
+	Status        Status     `json:"status"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	FromID        *uuid.UUID `json:"from_id,omitempty"`
+	ToID          *uuid.UUID `json:"to_id,omitempty"`
+	RatePerSecond int        `json:"rate_per_second"`
+	Total         int64      `json:"total"`
+	Published     int64      `json:"published"`
+	Progress      float64    `json:"progress"`
+	Cursor        *uuid.UUID `json:"cursor,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// UpdateProgress sets Progress to the published share of Total, from 0 to 1.
+func (j *Job) UpdateProgress() {
+	switch {
+	case j.Status == StatusFinished || j.Total == 0:
+		j.Progress = 1
+	case j.Published >= j.Total:
+		j.Progress = 1
+	default:
+		j.Progress = float64(j.Published) / float64(j.Total)
+	}
+}
@@ -0,0 +1,28 @@
+package backfill
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+type Repository interface {
+	// Create stores a running job and counts the users in its range as its total.
+	Create(ctx context.Context, job *Job) error
+	Get(ctx context.Context, id uuid.UUID) (*Job, error)
+	List(ctx context.Context) ([]Job, error)
+	// SetStatus moves a job that is in one of the from statuses to status, or fails with
+	// ErrBackfillStateConflict.
+	SetStatus(ctx context.Context, id uuid.UUID, from []Status, status Status) (*Job, error)
+	// Claim leases a running job, so that other instances skip it until the lease expires. It returns nil
+	// when no job is due.
+	Claim(ctx context.Context, lease time.Duration) (*Job, error)
+	// NextUsers returns up to limit users of the job's range after its cursor, in id order.
+	NextUsers(ctx context.Context, job *Job, limit int) ([]user.User, error)
+	// Advance stores the cursor, the published count and the last error of a claimed job, and releases it
+	// to be claimed again after retryIn.
+	Advance(ctx context.Context, job *Job, retryIn time.Duration) error
+	// Finish marks a running job as finished.
+	Finish(ctx context.Context, id uuid.UUID) error
+}
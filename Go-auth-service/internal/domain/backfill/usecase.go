@@ -0,0 +1,15 @@
+package backfill
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	Start(ctx context.Context, job *Job) error
+	Get(ctx context.Context, id uuid.UUID) (*Job, error)
+	List(ctx context.Context) ([]Job, error)
+	Pause(ctx context.Context, id uuid.UUID) (*Job, error)
+	Resume(ctx context.Context, id uuid.UUID) (*Job, error)
+	Cancel(ctx context.Context, id uuid.UUID) (*Job, error)
+}
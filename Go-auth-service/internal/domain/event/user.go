@@ -0,0 +1,34 @@
+package event
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	SubjectUserCreated = "users.created"
+	SubjectUserUpdated = "users.updated"
+	SubjectUserDeleted = "users.deleted"
+
+	// SubjectUsers matches every user event.
+	SubjectUsers = "users.>"
+)
+
+type UserCreated struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type UserUpdated struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type UserDeleted struct {
+	ID        uuid.UUID `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
@@ -0,0 +1,23 @@
+package outbox
+
+import "time"
+
+// Message is an event stored in the same transaction as the change it describes and published by the relay.
+type Message struct {
+	ID      int64
+	Subject string
+	// Key orders the messages: those with the same key are published one after the other.
+	Key           string
+	Payload       []byte
+	Attempts      int
+	LastError     string
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+}
+
+type Backlog struct {
+	Pending   int
+	OldestAge time.Duration
+	// Dead is the number of messages the relay gave up on.
+	Dead int
+}
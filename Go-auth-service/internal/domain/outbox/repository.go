@@ -0,0 +1,21 @@
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+type Repository interface {
+	// ClaimPending leases up to limit unsent messages whose next attempt is due, oldest first. It skips the
+	// messages behind an unsent one with the same key that is not due, failed or leased, so that the messages
+	// of a key are published in order.
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]Message, error)
+	MarkSent(ctx context.Context, ids []int64) error
+	MarkFailed(ctx context.Context, message *Message, retryIn time.Duration) error
+	// MarkDead gives up on a message, which then no longer holds back the ones after it.
+	MarkDead(ctx context.Context, message *Message) error
+	// Release gives up the lease of claimed messages that were not attempted.
+	Release(ctx context.Context, ids []int64) error
+	GetBacklog(ctx context.Context) (*Backlog, error)
+	DeleteSentBefore(ctx context.Context, age time.Duration) (int64, error)
+}
@@ -0,0 +1,17 @@
+package user
+
+import "time"
+
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+type Change struct {
+	Type       ChangeType
+	User       User
+	OccurredAt time.Time
+}
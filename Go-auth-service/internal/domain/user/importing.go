@@ -0,0 +1,51 @@
+package user
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type ImportJobStatus string
+
+const (
+	ImportJobPending  ImportJobStatus = "pending"
+	ImportJobRunning  ImportJobStatus = "running"
+	ImportJobFinished ImportJobStatus = "finished"
+	ImportJobFailed   ImportJobStatus = "failed"
+)
+
+type ImportRow struct {
+	Line     int
+	Email    string
+	Password string
+	Err      error
+}
+
+// RowSource yields import rows one by one and returns io.EOF when the input is exhausted.
+type RowSource interface {
+	Next() (*ImportRow, error)
+}
+
+type ImportRowResult struct {
+	Line  int        `json:"line"`
+	Email string     `json:"email"`
+	ID    *uuid.UUID `json:"id,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+type ImportJob struct {
+	ID         uuid.UUID       `json:"id"`
+	Status     ImportJobStatus `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Report     *ImportReport   `json:"report,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
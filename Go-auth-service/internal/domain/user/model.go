@@ -12,3 +12,23 @@ type User struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
+
+type ExportedUser struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Export returns the user without its credentials, as it is allowed to leave the service.
+func (u *User) Export() ExportedUser {
+	return ExportedUser{ID: u.ID, Email: u.Email, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt}
+}
+
+type ExportFilter struct {
+	RegisteredAfter string
+	// AfterID, with RegisteredAfter, resumes an export after the user it last returned.
+	AfterID uuid.UUID
+	Offset  int
+	Limit   int
+}
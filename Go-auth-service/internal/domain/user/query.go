@@ -0,0 +1,26 @@
+package user
+
+// Request-reply subjects of the user query API. They live outside users.>, as the event stream captures that
+// namespace and would store the queries and acknowledge them in place of the service.
+const (
+	QueryGroup             = "auth.users"
+	QueryGetById           = "get"
+	QueryGetByEmail        = "get_by_email"
+	SubjectQueryGetById    = QueryGroup + "." + QueryGetById
+	SubjectQueryGetByEmail = QueryGroup + "." + QueryGetByEmail
+)
+
+type GetByIdQuery struct {
+	ID string `json:"id"`
+}
+
+type GetByEmailQuery struct {
+	Email string `json:"email"`
+}
+
+// QueryError is the body of an error reply. Code and Message are also sent in the Nats-Service-Error-Code and
+// Nats-Service-Error headers.
+type QueryError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
@@ -1,18 +1,34 @@
 package user
 
 import (
+	"Golang-practice-2023/internal/domain/outbox"
 	"context"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"time"
 )
 
+// NewMessage builds the outbox message stored in the same transaction as a user change. It may be nil.
+type NewMessage func(user *User) (*outbox.Message, error)
+
+// TxListener is called inside the transaction of a user change, after its outbox message is stored. An error
+// rolls the change back.
+type TxListener func(ctx context.Context, tx *sqlx.Tx, change Change) error
+
 type Repository interface {
-	Create(ctx context.Context, user *User) error
+	Create(ctx context.Context, user *User, newMessage NewMessage) error
+	CreateBatch(ctx context.Context, users []*User, newMessage NewMessage) ([]error, error)
 	GetById(ctx context.Context, id uuid.UUID) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetWithOffsetAndLimit(ctx context.Context, offset int, limit int) (*[]User, error)
-	GetRegisteredLaterThen(ctx context.Context, registerDate string, limit int) (*[]User, error)
-	Update(ctx context.Context, user *User) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	GetRegisteredLaterThen(ctx context.Context, registerDate string, afterID uuid.UUID, limit int) (*[]User, error)
+	Export(ctx context.Context, filter ExportFilter, fn func(user *ExportedUser) error) error
+	Update(ctx context.Context, user *User, newMessage NewMessage) error
+	Delete(ctx context.Context, id uuid.UUID, newMessage NewMessage) error
+	CreateImportJob(ctx context.Context, job *ImportJob) error
+	UpdateImportJob(ctx context.Context, job *ImportJob) error
+	TouchImportJob(ctx context.Context, id uuid.UUID) error
+	GetImportJob(ctx context.Context, id uuid.UUID, staleAfter time.Duration) (*ImportJob, error)
+	DeleteExpiredImportJobs(ctx context.Context, ttl time.Duration) (int64, error)
 	GetDbInstance() *sqlx.DB
 }
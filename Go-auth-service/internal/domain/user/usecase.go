@@ -10,7 +10,14 @@ type Service interface {
 	GetById(ctx context.Context, id uuid.UUID) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetWithOffsetAndLimit(ctx context.Context, offset int, limit int) (*[]User, error)
-	GetRegisteredLaterThenWithLimit(ctx context.Context, registerDate string, limit int) (*[]User, error)
+	GetRegisteredLaterThenWithLimit(ctx context.Context, registerDate string, afterID uuid.UUID, limit int) (*[]User, error)
+	Export(ctx context.Context, filter ExportFilter, fn func(user *ExportedUser) error) error
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	Import(ctx context.Context, source RowSource) (*ImportReport, error)
+	StartImport(ctx context.Context, source RowSource, onDone func()) (*ImportJob, error)
+	GetImportJob(ctx context.Context, id uuid.UUID) (*ImportJob, error)
+	// Watch returns the changes made through this replica after the call. The channel is closed when ctx is
+	// done, or as soon as the watcher falls behind and misses a change.
+	Watch(ctx context.Context) <-chan Change
 }
@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventUserCreated EventType = "user.created"
+	EventUserUpdated EventType = "user.updated"
+	EventUserDeleted EventType = "user.deleted"
+)
+
+func (t EventType) IsValid() bool {
+	switch t {
+	case EventUserCreated, EventUserUpdated, EventUserDeleted:
+		return true
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+func (s DeliveryStatus) IsValid() bool {
+	switch s {
+	case DeliveryPending, DeliverySucceeded, DeliveryDead:
+		return true
+	}
+	return false
+}
+
+type Subscription struct {
+	ID         uuid.UUID   `json:"id"`
+	URL        string      `json:"url"`
+	EventTypes []EventType `json:"event_types"`
+	Secret     string      `json:"secret,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+func (s *Subscription) Wants(eventType EventType) bool {
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the body posted to subscribers.
+type Event struct {
+	ID         uuid.UUID   `json:"id"`
+	Type       EventType   `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+type Delivery struct {
+	ID             uuid.UUID       `json:"id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventType      EventType       `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	History        []Attempt       `json:"history,omitempty"`
+}
+
+// DueDelivery is a pending delivery together with the endpoint it has to be sent to.
+type DueDelivery struct {
+	Delivery
+	URL    string
+	Secret string
+}
+
+type Attempt struct {
+	Attempt     int       `json:"attempt"`
+	StatusCode  *int      `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+type DeliveryFilter struct {
+	Status DeliveryStatus
+	Offset int
+	Limit  int
+}
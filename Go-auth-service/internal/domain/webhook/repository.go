@@ -0,0 +1,28 @@
+package webhook
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+type Repository interface {
+	CreateSubscription(ctx context.Context, subscription *Subscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	GetSubscriptions(ctx context.Context) ([]Subscription, error)
+	GetSubscriptionsForEvent(ctx context.Context, eventType EventType) ([]Subscription, error)
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+	CreateDeliveries(ctx context.Context, deliveries []*Delivery) error
+	// QueueDeliveries adds a delivery of the payload for every subscription to the event type, inside the
+	// caller's transaction.
+	QueueDeliveries(ctx context.Context, tx *sqlx.Tx, eventType EventType, payload []byte) error
+	// ClaimDueDeliveries leases up to limit pending deliveries whose next attempt is due, so that
+	// other instances skip them until the lease expires.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]DueDelivery, error)
+	// RecordAttempt stores the attempt and the delivery's new state; a pending delivery is retried after retryIn.
+	RecordAttempt(ctx context.Context, delivery *Delivery, attempt Attempt, retryIn time.Duration) error
+	GetDeliveries(ctx context.Context, subscriptionId uuid.UUID, filter DeliveryFilter) ([]Delivery, error)
+	GetDelivery(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*Delivery, error)
+	ResetDelivery(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*Delivery, error)
+}
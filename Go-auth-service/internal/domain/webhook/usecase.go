@@ -0,0 +1,17 @@
+package webhook
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	Subscribe(ctx context.Context, subscription *Subscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	GetSubscriptions(ctx context.Context) ([]Subscription, error)
+	Unsubscribe(ctx context.Context, id uuid.UUID) error
+	Publish(ctx context.Context, eventType EventType, data interface{}) error
+	GetDeliveries(ctx context.Context, subscriptionId uuid.UUID, filter DeliveryFilter) ([]Delivery, error)
+	GetDelivery(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*Delivery, error)
+	Redeliver(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*Delivery, error)
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/outbox"
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"sort"
+	"time"
+)
+
+type Repository struct {
+	db     *sqlx.DB
+	logger logger.Logger
+}
+
+func New(db *sqlx.DB, logger logger.Logger) *Repository {
+	return &Repository{db: db, logger: logger}
+}
+
+// Insert adds a message inside the caller's transaction, so that it is stored if and only if the change is.
+func Insert(ctx context.Context, tx *sqlx.Tx, message *outbox.Message) error {
+	query := "INSERT INTO outbox (subject, messageKey, payload) VALUES ($1, $2, $3) RETURNING id, nextAttemptAt, createdAt"
+
+	row := tx.QueryRowContext(ctx, query, message.Subject, message.Key, message.Payload)
+	return row.Scan(&message.ID, &message.NextAttemptAt, &message.CreatedAt)
+}
+
+// ClaimPending runs under a transaction-level advisory lock, so relays of several replicas claim one after the
+// other and never publish the messages behind a leased one of the same key.
+func (r *Repository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]outbox.Message, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, "SELECT pg_try_advisory_xact_lock(hashtext('outbox_relay'))"); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	if !locked {
+		return []outbox.Message{}, nil
+	}
+
+	query := `WITH due AS (
+		SELECT id FROM outbox
+		WHERE sentAt IS NULL AND deadAt IS NULL AND nextAttemptAt <= current_timestamp
+		AND NOT EXISTS (
+			SELECT 1 FROM outbox blocking
+			WHERE blocking.messageKey = outbox.messageKey AND blocking.id < outbox.id
+			AND blocking.sentAt IS NULL AND blocking.deadAt IS NULL AND blocking.nextAttemptAt > current_timestamp
+		)
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE
+	)
+	UPDATE outbox o SET nextAttemptAt = current_timestamp + $2 * interval '1 millisecond'
+	FROM due
+	WHERE o.id = due.id
+	RETURNING o.id, o.subject, o.messageKey, o.payload, o.attempts, o.lastError, o.nextAttemptAt, o.createdAt`
+
+	rows, err := tx.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	messages := make([]outbox.Message, 0)
+	for rows.Next() {
+		var m outbox.Message
+		if err := rows.Scan(&m.ID, &m.Subject, &m.Key, &m.Payload, &m.Attempts, &m.LastError, &m.NextAttemptAt, &m.CreatedAt); err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	// UPDATE ... RETURNING does not keep the order of the CTE.
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID < messages[j].ID
+	})
+	return messages, nil
+}
+
+func (r *Repository) MarkSent(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := "UPDATE outbox SET sentAt=current_timestamp WHERE id = ANY($1)"
+	if _, err := r.db.ExecContext(ctx, query, pq.Array(ids)); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) MarkFailed(ctx context.Context, message *outbox.Message, retryIn time.Duration) error {
+	query := `UPDATE outbox SET attempts=$1, lastError=$2, nextAttemptAt=current_timestamp + $3 * interval '1 millisecond'
+		WHERE id=$4 RETURNING nextAttemptAt`
+
+	row := r.db.QueryRowContext(ctx, query, message.Attempts, message.LastError, retryIn.Milliseconds(), message.ID)
+	if err := row.Scan(&message.NextAttemptAt); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) MarkDead(ctx context.Context, message *outbox.Message) error {
+	query := "UPDATE outbox SET attempts=$1, lastError=$2, deadAt=current_timestamp WHERE id=$3"
+
+	if _, err := r.db.ExecContext(ctx, query, message.Attempts, message.LastError, message.ID); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) Release(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := "UPDATE outbox SET nextAttemptAt=current_timestamp WHERE id = ANY($1) AND sentAt IS NULL"
+	if _, err := r.db.ExecContext(ctx, query, pq.Array(ids)); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) GetBacklog(ctx context.Context) (*outbox.Backlog, error) {
+	query := `SELECT count(*) FILTER (WHERE deadAt IS NULL),
+		COALESCE(EXTRACT(EPOCH FROM current_timestamp - min(createdAt) FILTER (WHERE deadAt IS NULL)), 0),
+		count(*) FILTER (WHERE deadAt IS NOT NULL)
+		FROM outbox WHERE sentAt IS NULL`
+
+	var pending, dead int
+	var oldestAge float64
+	if err := r.db.QueryRowContext(ctx, query).Scan(&pending, &oldestAge, &dead); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return &outbox.Backlog{Pending: pending, OldestAge: time.Duration(oldestAge * float64(time.Second)), Dead: dead}, nil
+}
+
+func (r *Repository) DeleteSentBefore(ctx context.Context, age time.Duration) (int64, error) {
+	query := "DELETE FROM outbox WHERE sentAt < current_timestamp - $1 * interval '1 millisecond'"
+
+	result, err := r.db.ExecContext(ctx, query, age.Milliseconds())
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return 0, apperrors.ErrDbQueryProcessing
+	}
+
+	return result.RowsAffected()
+}
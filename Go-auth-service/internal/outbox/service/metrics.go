@@ -0,0 +1,49 @@
+package service
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type metrics struct {
+	pending   prometheus.Gauge
+	oldestAge prometheus.Gauge
+	dead      prometheus.Gauge
+	published prometheus.Counter
+	failures  prometheus.Counter
+	deaths    prometheus.Counter
+}
+
+func newMetrics(registerer prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		pending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "outbox_pending_messages",
+			Help: "Number of outbox messages that have not been published yet.",
+		}),
+		oldestAge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "outbox_oldest_pending_age_seconds",
+			Help: "Age of the oldest unpublished outbox message.",
+		}),
+		dead: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "outbox_dead_messages",
+			Help: "Number of outbox messages the relay gave up on after too many failed attempts.",
+		}),
+		published: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "outbox_published_total",
+			Help: "Number of outbox messages published.",
+		}),
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "outbox_publish_failures_total",
+			Help: "Number of failed outbox publish attempts.",
+		}),
+		deaths: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "outbox_dead_messages_total",
+			Help: "Number of outbox messages given up on by this relay.",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.pending, m.oldestAge, m.dead, m.published, m.failures, m.deaths} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
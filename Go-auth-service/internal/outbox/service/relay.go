@@ -0,0 +1,187 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/outbox"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"time"
+)
+
+const maxErrorLength = 512
+
+type Config struct {
+	BatchSize    int
+	PollInterval time.Duration
+	Lease        time.Duration
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	// MaxAttempts is the number of failed attempts after which a message is marked dead.
+	MaxAttempts int
+	Retention   time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:    100,
+		PollInterval: time.Second,
+		Lease:        30 * time.Second,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   5 * time.Minute,
+		MaxAttempts:  20,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// Relay publishes outbox messages. Delivery is at least once: a message that was published but not
+// marked as sent (crash, lost lease) is published again. Every attempt carries the same message ID, so
+// a backend with deduplication stores a republished message once.
+type Relay struct {
+	repository outbox.Repository
+	publisher  pubsub.Publisher
+	config     Config
+	metrics    *metrics
+	logger     logger.Logger
+}
+
+func NewRelay(repository outbox.Repository, publisher pubsub.Publisher, config Config, registerer prometheus.Registerer,
+	logger logger.Logger) (*Relay, error) {
+	m, err := newMetrics(registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Relay{repository: repository, publisher: publisher, config: config, metrics: m, logger: logger}, nil
+}
+
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Time{}
+	for {
+		for {
+			published, err := r.RelayPending(ctx)
+			if err != nil {
+				r.logger.Warning(fmt.Sprintf("Failed to relay outbox: %s", err.Error()))
+				break
+			}
+			if published < r.config.BatchSize {
+				break
+			}
+		}
+		r.UpdateBacklog(ctx)
+
+		if time.Since(lastCleanup) > time.Hour {
+			lastCleanup = time.Now()
+			if _, err := r.repository.DeleteSentBefore(ctx, r.config.Retention); err != nil {
+				r.logger.Warning(fmt.Sprintf("Failed to clean up outbox: %s", err.Error()))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes one batch of due messages and returns how many were claimed. Once a batch is
+// claimed its outcome is stored even if ctx is cancelled, so that a shutdown does not cause duplicates.
+// After a failed message, the later ones with the same key are released and wait for its retry, so that
+// consumers never see a later change of a user before an earlier one. A message failing MaxAttempts times is
+// marked dead and stops holding them back.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	messages, err := r.repository.ClaimPending(ctx, r.config.BatchSize, r.config.Lease)
+	if err != nil {
+		return 0, err
+	}
+	ctx = context.Background()
+
+	sent := make([]int64, 0, len(messages))
+	blocked := make([]int64, 0)
+	failedKeys := map[string]bool{}
+	for i := range messages {
+		message := &messages[i]
+		if failedKeys[message.Key] {
+			blocked = append(blocked, message.ID)
+			continue
+		}
+
+		msg := &pubsub.Message{ID: messageID(message), Subject: message.Subject, Data: message.Payload}
+		if err := r.publisher.Publish(msg); err != nil {
+			if !r.failed(ctx, message, err) {
+				failedKeys[message.Key] = true
+			}
+			continue
+		}
+
+		r.metrics.published.Inc()
+		sent = append(sent, message.ID)
+	}
+
+	if err := r.repository.Release(ctx, blocked); err != nil {
+		r.logger.Warning(fmt.Sprintf("Failed to release %d outbox messages: %s", len(blocked), err.Error()))
+	}
+	if err := r.repository.MarkSent(ctx, sent); err != nil {
+		return len(messages), err
+	}
+
+	return len(messages), nil
+}
+
+// failed reschedules a message, or marks it dead once it has failed MaxAttempts times and returns true.
+func (r *Relay) failed(ctx context.Context, message *outbox.Message, err error) bool {
+	r.metrics.failures.Inc()
+	message.Attempts++
+	message.LastError = err.Error()
+	if len(message.LastError) > maxErrorLength {
+		message.LastError = message.LastError[:maxErrorLength]
+	}
+
+	if r.config.MaxAttempts > 0 && message.Attempts >= r.config.MaxAttempts {
+		r.metrics.deaths.Inc()
+		r.logger.Error(fmt.Sprintf("Giving up on outbox message %d (%s, key %s) after %d attempts: %s", message.ID,
+			message.Subject, message.Key, message.Attempts, message.LastError))
+		if err := r.repository.MarkDead(ctx, message); err != nil {
+			r.logger.Warning(fmt.Sprintf("Failed to mark outbox message %d dead: %s", message.ID, err.Error()))
+		}
+		return true
+	}
+
+	if err := r.repository.MarkFailed(ctx, message, r.backoff(message.Attempts)); err != nil {
+		r.logger.Warning(fmt.Sprintf("Failed to reschedule outbox message %d: %s", message.ID, err.Error()))
+	}
+	return false
+}
+
+func (r *Relay) UpdateBacklog(ctx context.Context) {
+	backlog, err := r.repository.GetBacklog(ctx)
+	if err != nil {
+		r.logger.Warning(fmt.Sprintf("Failed to get outbox backlog: %s", err.Error()))
+		return
+	}
+
+	r.metrics.pending.Set(float64(backlog.Pending))
+	r.metrics.oldestAge.Set(backlog.OldestAge.Seconds())
+	r.metrics.dead.Set(float64(backlog.Dead))
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.config.BaseBackoff
+	for i := 1; i < attempts && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.config.MaxBackoff {
+		delay = r.config.MaxBackoff
+	}
+	return delay
+}
+
+func messageID(message *outbox.Message) string {
+	return "outbox-" + strconv.FormatInt(message.ID, 10)
+}
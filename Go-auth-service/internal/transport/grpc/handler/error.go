@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func HandleError(err error) error {
+	switch errors.Cause(err) {
+	case apperrors.ErrUserNotFound, apperrors.ErrImportJobNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case apperrors.ErrAlreadyRegisteredUserEmail:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case apperrors.ErrInvalidEmailFormat, apperrors.ErrInvalidPasswordFormat, apperrors.ErrInvalidRequestFormat,
+		apperrors.ErrInvalidRequestBody, apperrors.ErrInvalidIdFormat, apperrors.ErrInvalidDateFormat,
+		apperrors.ErrInvalidOffsetFormat, apperrors.ErrInvalidLimitFormat:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case apperrors.ErrWatcherBehind:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case apperrors.ErrInternalJsonProcessing, apperrors.ErrNatsPublishing, apperrors.ErrDbQueryProcessing,
+		apperrors.ErrEventValidation:
+		return status.Error(codes.Internal, "Failed to execute")
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/pkg/grpc/userpb"
+	"context"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const registeredAfterLayout = "2006-01-02 15:04:05.999999"
+
+type UserServer struct {
+	userpb.UnimplementedUserServiceServer
+	service user.Service
+	logger  logger.Logger
+}
+
+func New(service user.Service, logger logger.Logger) *UserServer {
+	return &UserServer{service: service, logger: logger}
+}
+
+func (s *UserServer) Register(server *grpc.Server) {
+	userpb.RegisterUserServiceServer(server, s)
+}
+
+func (s *UserServer) CreateUser(ctx context.Context, req *userpb.CreateUserRequest) (*userpb.User, error) {
+	u := user.User{Email: req.GetEmail(), Passwordhash: req.GetPassword()}
+	if err := s.service.Create(ctx, &u); err != nil {
+		return nil, HandleError(err)
+	}
+	return toProtoUser(&u), nil
+}
+
+func (s *UserServer) GetUser(ctx context.Context, req *userpb.GetUserRequest) (*userpb.User, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, HandleError(apperrors.ErrInvalidIdFormat)
+	}
+
+	u, err := s.service.GetById(ctx, id)
+	if err != nil {
+		return nil, HandleError(err)
+	}
+	return toProtoUser(u), nil
+}
+
+func (s *UserServer) GetUserByEmail(ctx context.Context, req *userpb.GetUserByEmailRequest) (*userpb.User, error) {
+	u, err := s.service.GetByEmail(ctx, req.GetEmail())
+	if err != nil {
+		return nil, HandleError(err)
+	}
+	return toProtoUser(u), nil
+}
+
+func (s *UserServer) UpdateUser(ctx context.Context, req *userpb.UpdateUserRequest) (*userpb.User, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, HandleError(apperrors.ErrInvalidIdFormat)
+	}
+
+	u := user.User{ID: id, Email: req.GetEmail(), Passwordhash: req.GetPassword()}
+	if err := s.service.Update(ctx, &u); err != nil {
+		return nil, HandleError(err)
+	}
+	return toProtoUser(&u), nil
+}
+
+func (s *UserServer) DeleteUser(ctx context.Context, req *userpb.DeleteUserRequest) (*emptypb.Empty, error) {
+	id, err := uuid.Parse(req.GetId())
+	if err != nil {
+		return nil, HandleError(apperrors.ErrInvalidIdFormat)
+	}
+
+	if err := s.service.Delete(ctx, id); err != nil {
+		return nil, HandleError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *UserServer) ListUsers(req *userpb.ListUsersRequest, stream userpb.UserService_ListUsersServer) error {
+	if req.GetOffset() < 0 {
+		return HandleError(apperrors.ErrInvalidOffsetFormat)
+	}
+	if req.GetLimit() < 0 {
+		return HandleError(apperrors.ErrInvalidLimitFormat)
+	}
+
+	filter := user.ExportFilter{Offset: int(req.GetOffset()), Limit: int(req.GetLimit())}
+	if req.GetRegisteredAfter() != nil {
+		filter.RegisteredAfter = req.GetRegisteredAfter().AsTime().Format(registeredAfterLayout)
+	}
+
+	err := s.service.Export(stream.Context(), filter, func(u *user.ExportedUser) error {
+		return stream.Send(&userpb.User{
+			Id:        u.ID.String(),
+			Email:     u.Email,
+			CreatedAt: timestamppb.New(u.CreatedAt),
+			UpdatedAt: timestamppb.New(u.UpdatedAt),
+		})
+	})
+	if err != nil {
+		return HandleError(err)
+	}
+	return nil
+}
+
+func (s *UserServer) WatchUsers(req *userpb.WatchUsersRequest, stream userpb.UserService_WatchUsersServer) error {
+	changes := s.service.Watch(stream.Context())
+
+	for change := range changes {
+		err := stream.Send(&userpb.UserChange{
+			Type:       toProtoChangeType(change.Type),
+			User:       toProtoUser(&change.User),
+			OccurredAt: timestamppb.New(change.OccurredAt),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The service closes the changes of a watcher that fell behind.
+	if err := stream.Context().Err(); err != nil {
+		return err
+	}
+	return HandleError(apperrors.ErrWatcherBehind)
+}
+
+func toProtoUser(u *user.User) *userpb.User {
+	return &userpb.User{
+		Id:        u.ID.String(),
+		Email:     u.Email,
+		CreatedAt: timestamppb.New(u.CreatedAt),
+		UpdatedAt: timestamppb.New(u.UpdatedAt),
+	}
+}
+
+func toProtoChangeType(changeType user.ChangeType) userpb.ChangeType {
+	switch changeType {
+	case user.ChangeCreated:
+		return userpb.ChangeType_CHANGE_TYPE_CREATED
+	case user.ChangeUpdated:
+		return userpb.ChangeType_CHANGE_TYPE_UPDATED
+	case user.ChangeDeleted:
+		return userpb.ChangeType_CHANGE_TYPE_DELETED
+	}
+	return userpb.ChangeType_CHANGE_TYPE_UNSPECIFIED
+}
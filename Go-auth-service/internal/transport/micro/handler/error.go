@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/user"
+	"encoding/json"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+)
+
+func toQueryError(err error) user.QueryError {
+	switch errors.Cause(err) {
+	case apperrors.ErrUserNotFound:
+		return user.QueryError{Code: http.StatusNotFound, Message: err.Error()}
+	case apperrors.ErrInvalidEmailFormat, apperrors.ErrInvalidRequestBody, apperrors.ErrInvalidIdFormat:
+		return user.QueryError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return user.QueryError{Code: http.StatusInternalServerError, Message: "Failed to execute"}
+}
+
+// HandleError replies with the error code and message in the micro error headers and a user.QueryError body.
+func HandleError(req micro.Request, err error) (user.QueryError, error) {
+	queryErr := toQueryError(err)
+	body, marshalErr := json.Marshal(queryErr)
+	if marshalErr != nil {
+		return queryErr, marshalErr
+	}
+	return queryErr, req.Error(strconv.Itoa(queryErr.Code), queryErr.Message, body)
+}
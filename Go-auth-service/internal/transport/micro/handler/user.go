@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"Golang-practice-2023/api"
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/user"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Name        string
+	Version     string
+	Description string
+	// Timeout bounds the lookup behind every request.
+	Timeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Name:        "go-auth-users",
+		Version:     "1.0.0",
+		Description: "User lookups of the auth service",
+		Timeout:     5 * time.Second,
+	}
+}
+
+type UserQueryHandler struct {
+	service user.Service
+	config  Config
+	logger  logger.Logger
+
+	mu sync.Mutex
+	// errors counts error replies per endpoint subject and code, reported in the STATS data of the endpoint.
+	errors map[string]map[string]int
+}
+
+func New(service user.Service, config Config, logger logger.Logger) *UserQueryHandler {
+	return &UserQueryHandler{service: service, config: config, logger: logger, errors: map[string]map[string]int{}}
+}
+
+// Start registers the query endpoints on the connection. Stop the returned service to drain them.
+func (h *UserQueryHandler) Start(nc *nats.Conn) (micro.Service, error) {
+	svc, err := micro.AddService(nc, micro.Config{
+		Name:         h.config.Name,
+		Version:      h.config.Version,
+		Description:  h.config.Description,
+		StatsHandler: h.stats,
+		ErrorHandler: func(_ micro.Service, err *micro.NATSError) {
+			h.logger.Warning(fmt.Sprintf("User query service error on %s: %s", err.Subject, err.Description))
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	group := svc.AddGroup(user.QueryGroup)
+	endpoints := map[string]micro.HandlerFunc{
+		user.QueryGetById:    h.GetById,
+		user.QueryGetByEmail: h.GetByEmail,
+	}
+	for name, handle := range endpoints {
+		request, response, err := api.QuerySchema(name)
+		if err != nil {
+			_ = svc.Stop()
+			return nil, err
+		}
+		err = group.AddEndpoint(name, handle, micro.WithEndpointSchema(&micro.Schema{Request: request, Response: response}))
+		if err != nil {
+			_ = svc.Stop()
+			return nil, err
+		}
+	}
+
+	return svc, nil
+}
+
+func (h *UserQueryHandler) GetById(req micro.Request) {
+	var query user.GetByIdQuery
+	if err := json.Unmarshal(req.Data(), &query); err != nil {
+		h.fail(req, apperrors.ErrInvalidRequestBody)
+		return
+	}
+	id, err := uuid.Parse(query.ID)
+	if err != nil {
+		h.fail(req, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+	defer cancel()
+
+	u, err := h.service.GetById(ctx, id)
+	if err != nil {
+		h.fail(req, err)
+		return
+	}
+	h.respond(req, u)
+}
+
+func (h *UserQueryHandler) GetByEmail(req micro.Request) {
+	var query user.GetByEmailQuery
+	if err := json.Unmarshal(req.Data(), &query); err != nil {
+		h.fail(req, apperrors.ErrInvalidRequestBody)
+		return
+	}
+	if query.Email == "" {
+		h.fail(req, apperrors.ErrInvalidEmailFormat)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+	defer cancel()
+
+	u, err := h.service.GetByEmail(ctx, query.Email)
+	if err != nil {
+		h.fail(req, err)
+		return
+	}
+	h.respond(req, u)
+}
+
+func (h *UserQueryHandler) respond(req micro.Request, u *user.User) {
+	if err := req.RespondJSON(u.Export()); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to reply on %s: %s", req.Subject(), err.Error()))
+	}
+}
+
+func (h *UserQueryHandler) fail(req micro.Request, err error) {
+	queryErr, replyErr := HandleError(req, err)
+	if queryErr.Code >= 500 {
+		h.logger.Error(fmt.Sprintf("Failed to serve %s: %s", req.Subject(), err.Error()))
+	}
+	if replyErr != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to reply on %s: %s", req.Subject(), replyErr.Error()))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts, ok := h.errors[req.Subject()]
+	if !ok {
+		counts = map[string]int{}
+		h.errors[req.Subject()] = counts
+	}
+	counts[strconv.Itoa(queryErr.Code)]++
+}
+
+type endpointStats struct {
+	Errors map[string]int `json:"errors"`
+}
+
+func (h *UserQueryHandler) stats(e *micro.Endpoint) interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := endpointStats{Errors: map[string]int{}}
+	for code, count := range h.errors[e.Subject] {
+		stats.Errors[code] = count
+	}
+	return stats
+}
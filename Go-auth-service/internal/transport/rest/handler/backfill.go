@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/backfill"
+	"Golang-practice-2023/internal/domain/logger"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+type BackfillHandler struct {
+	service backfill.Service
+	logger  logger.Logger
+}
+
+func NewBackfillHandler(service backfill.Service, logger logger.Logger) *BackfillHandler {
+	return &BackfillHandler{service: service, logger: logger}
+}
+
+func (h *BackfillHandler) InitRoutes(router *mux.Router) {
+	router.HandleFunc("/backfill", h.Start).Methods(http.MethodPost)
+	router.HandleFunc("/backfill", h.List).Methods(http.MethodGet)
+	router.HandleFunc("/backfill/{id}", h.Get).Methods(http.MethodGet)
+	router.HandleFunc("/backfill/{id}/pause", h.Pause).Methods(http.MethodPost)
+	router.HandleFunc("/backfill/{id}/resume", h.Resume).Methods(http.MethodPost)
+	router.HandleFunc("/backfill/{id}/cancel", h.Cancel).Methods(http.MethodPost)
+}
+
+type startBackfillRequest struct {
+	Subject       string     `json:"subject"`
+	CreatedAfter  *time.Time `json:"created_after"`
+	CreatedBefore *time.Time `json:"created_before"`
+	FromID        *uuid.UUID `json:"from_id"`
+	ToID          *uuid.UUID `json:"to_id"`
+	RatePerSecond int        `json:"rate_per_second"`
+}
+
+func (h *BackfillHandler) Start(w http.ResponseWriter, r *http.Request) {
+	if err := myHttp.ValidateRequestFormat(r, contentType); err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestFormat)
+		return
+	}
+
+	var req startBackfillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestBody)
+		return
+	}
+
+	job := &backfill.Job{
+		Subject:       req.Subject,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		FromID:        req.FromID,
+		ToID:          req.ToID,
+		RatePerSecond: req.RatePerSecond,
+	}
+	if err := h.service.Start(r.Context(), job); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, job, http.StatusAccepted)
+}
+
+func (h *BackfillHandler) List(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.service.List(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, jobs, http.StatusOK)
+}
+
+func (h *BackfillHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	job, err := h.service.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, job, http.StatusOK)
+}
+
+func (h *BackfillHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, h.service.Pause)
+}
+
+func (h *BackfillHandler) Resume(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, h.service.Resume)
+}
+
+func (h *BackfillHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, h.service.Cancel)
+}
+
+func (h *BackfillHandler) transition(w http.ResponseWriter, r *http.Request,
+	apply func(ctx context.Context, id uuid.UUID) (*backfill.Job, error)) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	job, err := apply(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, job, http.StatusOK)
+}
+
+func (h *BackfillHandler) writeResponse(w http.ResponseWriter, data interface{}, status int) {
+	if err := myHttp.WriteResponse(data, w, contentType, status); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal backfill response: %s", err.Error()))
+	}
+}
+
+func (h *BackfillHandler) writeError(w http.ResponseWriter, err error) {
+	if err := HandleError(w, err); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+	}
+}
@@ -15,14 +15,31 @@ type Error struct {
 
 func HandleError(w http.ResponseWriter, err error) error {
 	switch errors.Cause(err) {
-	case apperrors.ErrUserNotFound:
+	case apperrors.ErrUserNotFound, apperrors.ErrImportJobNotFound, apperrors.ErrWebhookNotFound, apperrors.ErrWebhookDeliveryNotFound,
+		apperrors.ErrBackfillNotFound:
 		err := myHttp.WriteResponse(Error{Code: 404, Message: err.Error()}, w, contentType, http.StatusNotFound)
 		return err
 	case apperrors.ErrInvalidEmailFormat, apperrors.ErrInvalidPasswordFormat, apperrors.ErrInvalidRequestFormat,
-		apperrors.ErrInvalidRequestBody, apperrors.ErrInvalidIdFormat, apperrors.ErrAlreadyRegisteredUserEmail, apperrors.ErrInvalidDateFormat:
+		apperrors.ErrInvalidRequestBody, apperrors.ErrInvalidIdFormat, apperrors.ErrAlreadyRegisteredUserEmail, apperrors.ErrInvalidDateFormat,
+		apperrors.ErrUnsupportedImportFormat, apperrors.ErrInvalidImportRow, apperrors.ErrInvalidOffsetFormat, apperrors.ErrInvalidLimitFormat,
+		apperrors.ErrInvalidWebhookURL, apperrors.ErrWebhookURLNotAllowed, apperrors.ErrInvalidWebhookEventType, apperrors.ErrInvalidDeliveryStatus,
+		apperrors.ErrInvalidBackfillSubject, apperrors.ErrInvalidBackfillRange, apperrors.ErrInvalidBackfillRate:
 		err := myHttp.WriteResponse(Error{Code: 400, Message: err.Error()}, w, contentType, http.StatusBadRequest)
 		return err
-	case apperrors.ErrInternalJsonProcessing, apperrors.ErrNatsPublishing, apperrors.ErrDbQueryProcessing:
+	case apperrors.ErrUnauthorized:
+		err := myHttp.WriteResponse(Error{Code: 401, Message: err.Error()}, w, contentType, http.StatusUnauthorized)
+		return err
+	case apperrors.ErrBackfillStateConflict:
+		err := myHttp.WriteResponse(Error{Code: 409, Message: err.Error()}, w, contentType, http.StatusConflict)
+		return err
+	case apperrors.ErrImportTooLarge:
+		err := myHttp.WriteResponse(Error{Code: 413, Message: err.Error()}, w, contentType, http.StatusRequestEntityTooLarge)
+		return err
+	case apperrors.ErrUnsupportedExportFormat:
+		err := myHttp.WriteResponse(Error{Code: 406, Message: err.Error()}, w, contentType, http.StatusNotAcceptable)
+		return err
+	case apperrors.ErrInternalJsonProcessing, apperrors.ErrNatsPublishing, apperrors.ErrDbQueryProcessing,
+		apperrors.ErrImportSpooling, apperrors.ErrWebhookSecretGeneration, apperrors.ErrEventValidation:
 		err := myHttp.WriteResponse(Error{Code: 500, Message: "Failed to execute"}, w, contentType, http.StatusInternalServerError)
 		return err
 	}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/user"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const exportFlushEvery = 100
+
+// The trailers of an export tell a complete one from one cut short after its status was sent.
+const (
+	exportStatusTrailer = "X-Export-Status"
+	exportCountTrailer  = "X-Export-Count"
+	exportComplete      = "complete"
+	exportTruncated     = "truncated"
+)
+
+type exportEncoder interface {
+	Encode(u *user.ExportedUser) error
+	Flush() error
+}
+
+func (h *UserHandler) Export(w http.ResponseWriter, r *http.Request) {
+	mediaType, err := negotiateExportFormat(r.Header.Get("Accept"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	filter, err := parseExportFilter(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	var encoder exportEncoder
+	written := 0
+	err = h.service.Export(r.Context(), filter, func(u *user.ExportedUser) error {
+		if encoder == nil {
+			encoder = startExport(w, mediaType)
+		}
+
+		if err := encoder.Encode(u); err != nil {
+			return err
+		}
+
+		written++
+		if written%exportFlushEvery == 0 {
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		if encoder == nil {
+			h.writeError(w, err)
+			return
+		}
+		h.logger.Warning(fmt.Sprintf("Export aborted after %d users: %s", written, err.Error()))
+		h.finishExport(w, encoder, written, exportTruncated)
+		return
+	}
+
+	if encoder == nil {
+		encoder = startExport(w, mediaType)
+	}
+	h.finishExport(w, encoder, written, exportComplete)
+}
+
+func startExport(w http.ResponseWriter, mediaType string) exportEncoder {
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Disposition", "attachment")
+	w.Header().Set("Trailer", exportStatusTrailer+", "+exportCountTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	if mediaType == csvContentType {
+		return newCsvExportEncoder(w)
+	}
+	return &ndjsonExportEncoder{encoder: json.NewEncoder(w)}
+}
+
+func (h *UserHandler) finishExport(w http.ResponseWriter, encoder exportEncoder, written int, status string) {
+	if err := encoder.Flush(); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+		status = exportTruncated
+	}
+	w.Header().Set(exportStatusTrailer, status)
+	w.Header().Set(exportCountTrailer, strconv.Itoa(written))
+}
+
+func negotiateExportFormat(accept string) (string, error) {
+	if strings.TrimSpace(accept) == "" {
+		return ndjsonContentType, nil
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case ndjsonContentType, "*/*", "application/*":
+			return ndjsonContentType, nil
+		case csvContentType, "text/*":
+			return csvContentType, nil
+		}
+	}
+
+	return "", apperrors.ErrUnsupportedExportFormat
+}
+
+func parseExportFilter(r *http.Request) (user.ExportFilter, error) {
+	query := r.URL.Query()
+	filter := user.ExportFilter{RegisteredAfter: query.Get("date")}
+
+	if filter.RegisteredAfter != "" && !isValidDate(filter.RegisteredAfter) {
+		return filter, apperrors.ErrInvalidDateFormat
+	}
+	if afterID := query.Get("after_id"); afterID != "" {
+		if filter.RegisteredAfter == "" {
+			return filter, apperrors.ErrInvalidRequestFormat
+		}
+		parsed, err := uuid.Parse(afterID)
+		if err != nil {
+			return filter, apperrors.ErrInvalidIdFormat
+		}
+		filter.AfterID = parsed
+	}
+	if offset := query.Get("offset"); offset != "" {
+		parsed, err := strconv.Atoi(offset)
+		if err != nil || parsed < 0 {
+			return filter, apperrors.ErrInvalidOffsetFormat
+		}
+		filter.Offset = parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 0 {
+			return filter, apperrors.ErrInvalidLimitFormat
+		}
+		filter.Limit = parsed
+	}
+
+	return filter, nil
+}
+
+func isValidDate(date string) bool {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999", "2006-01-02"} {
+		if _, err := time.Parse(layout, date); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+type ndjsonExportEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonExportEncoder) Encode(u *user.ExportedUser) error {
+	return e.encoder.Encode(u)
+}
+
+func (e *ndjsonExportEncoder) Flush() error {
+	return nil
+}
+
+type csvExportEncoder struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func newCsvExportEncoder(w io.Writer) *csvExportEncoder {
+	return &csvExportEncoder{writer: csv.NewWriter(w)}
+}
+
+func (e *csvExportEncoder) writeHeader() error {
+	if e.headerWritten {
+		return nil
+	}
+	e.headerWritten = true
+	return e.writer.Write([]string{"id", "email", "created_at", "updated_at"})
+}
+
+func (e *csvExportEncoder) Encode(u *user.ExportedUser) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.writer.Write([]string{
+		u.ID.String(),
+		u.Email,
+		u.CreatedAt.Format(time.RFC3339Nano),
+		u.UpdatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvExportEncoder) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/user"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+
+	// Bodies above importSyncLimit are imported as a job, and bodies above importAsyncLimit are refused.
+	importSyncLimit  = 1 << 20
+	importAsyncLimit = 64 << 20
+)
+
+func (h *UserHandler) Import(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != csvContentType && mediaType != ndjsonContentType) {
+		h.writeError(w, apperrors.ErrUnsupportedImportFormat)
+		return
+	}
+
+	if r.URL.Query().Get("async") == "true" || r.ContentLength > importSyncLimit {
+		h.startImport(w, r, mediaType, nil)
+		return
+	}
+
+	// The body is read before importing anything. A body without a declared length that turns out to be
+	// above importSyncLimit goes on as a job, starting with the part already read.
+	data, err := io.ReadAll(io.LimitReader(r.Body, importSyncLimit+1))
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestBody)
+		return
+	}
+	if len(data) > importSyncLimit {
+		h.startImport(w, r, mediaType, data)
+		return
+	}
+
+	source, err := newRowSource(mediaType, bytes.NewReader(data))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	report, err := h.service.Import(r.Context(), source)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if err := myHttp.WriteResponse(report, w, contentType, http.StatusOK); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal import report: %s", err.Error()))
+	}
+}
+
+func (h *UserHandler) GetImportJob(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	job, err := h.service.GetImportJob(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	if err := myHttp.WriteResponse(job, w, contentType, http.StatusOK); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal import job: %s", err.Error()))
+	}
+}
+
+// startImport spools the body, after head that was already read from it, and imports it as a job.
+func (h *UserHandler) startImport(w http.ResponseWriter, r *http.Request, mediaType string, head []byte) {
+	file, err := os.CreateTemp("", "user-import-*")
+	if err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to create import spool file: %s", err.Error()))
+		h.writeError(w, apperrors.ErrImportSpooling)
+		return
+	}
+	cleanup := func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+
+	body := newLimitedBody(w, r.Body, importAsyncLimit-int64(len(head)))
+	if _, err := io.Copy(file, io.MultiReader(bytes.NewReader(head), body)); err != nil {
+		cleanup()
+		h.writeError(w, body.check(apperrors.ErrInvalidRequestBody))
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		h.writeError(w, apperrors.ErrImportSpooling)
+		return
+	}
+
+	source, err := newRowSource(mediaType, file)
+	if err != nil {
+		cleanup()
+		h.writeError(w, err)
+		return
+	}
+
+	job, err := h.service.StartImport(r.Context(), source, cleanup)
+	if err != nil {
+		cleanup()
+		h.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+job.ID.String())
+	if err := myHttp.WriteResponse(job, w, contentType, http.StatusAccepted); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal import job: %s", err.Error()))
+	}
+}
+
+// limitedBody caps the request body and remembers when the cap was hit, as the row sources report any read
+// error as an invalid body.
+type limitedBody struct {
+	body     io.Reader
+	exceeded bool
+}
+
+func newLimitedBody(w http.ResponseWriter, body io.ReadCloser, limit int64) *limitedBody {
+	return &limitedBody{body: http.MaxBytesReader(w, body, limit)}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+func (b *limitedBody) check(err error) error {
+	if b.exceeded {
+		return apperrors.ErrImportTooLarge
+	}
+	return err
+}
+
+func (h *UserHandler) writeError(w http.ResponseWriter, err error) {
+	if err := HandleError(w, err); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+	}
+}
+
+func newRowSource(mediaType string, body io.Reader) (user.RowSource, error) {
+	switch mediaType {
+	case csvContentType:
+		return newCsvRowSource(body)
+	case ndjsonContentType:
+		return newNdjsonRowSource(body), nil
+	}
+	return nil, apperrors.ErrUnsupportedImportFormat
+}
+
+type csvRowSource struct {
+	reader      *csv.Reader
+	emailIdx    int
+	passwordIdx int
+}
+
+func newCsvRowSource(body io.Reader) (*csvRowSource, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, apperrors.ErrInvalidRequestBody
+	}
+
+	source := &csvRowSource{reader: reader, emailIdx: -1, passwordIdx: -1}
+	for i, column := range header {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "email":
+			source.emailIdx = i
+		case "password":
+			source.passwordIdx = i
+		}
+	}
+	if source.emailIdx == -1 || source.passwordIdx == -1 {
+		return nil, apperrors.ErrInvalidRequestBody
+	}
+
+	return source, nil
+}
+
+func (s *csvRowSource) Next() (*user.ImportRow, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &user.ImportRow{Line: parseErr.StartLine, Err: apperrors.ErrInvalidImportRow}, nil
+	}
+	if err != nil {
+		return nil, apperrors.ErrInvalidRequestBody
+	}
+
+	line, _ := s.reader.FieldPos(0)
+	if len(record) <= s.emailIdx || len(record) <= s.passwordIdx {
+		return &user.ImportRow{Line: line, Err: apperrors.ErrInvalidImportRow}, nil
+	}
+
+	return &user.ImportRow{
+		Line:     line,
+		Email:    strings.TrimSpace(record[s.emailIdx]),
+		Password: record[s.passwordIdx],
+	}, nil
+}
+
+type ndjsonRowSource struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+type ndjsonRow struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func newNdjsonRowSource(body io.Reader) *ndjsonRowSource {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	return &ndjsonRowSource{scanner: scanner}
+}
+
+func (s *ndjsonRowSource) Next() (*user.ImportRow, error) {
+	for s.scanner.Scan() {
+		s.line++
+
+		data := strings.TrimSpace(s.scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var row ndjsonRow
+		if err := json.Unmarshal([]byte(data), &row); err != nil {
+			return &user.ImportRow{Line: s.line, Err: apperrors.ErrInvalidImportRow}, nil
+		}
+
+		return &user.ImportRow{Line: s.line, Email: strings.TrimSpace(row.Email), Password: row.Password}, nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return nil, apperrors.ErrInvalidRequestBody
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/logger"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// docsPage loads a pinned Redoc release, so that a new upstream bundle never runs on the docs page unreviewed.
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>go-auth API</title>
+  <meta charset="utf-8"/>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+</head>
+<body>
+  <redoc spec-url="/openapi.json"></redoc>
+  <script src="https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js" crossorigin="anonymous"
+    referrerpolicy="no-referrer"></script>
+</body>
+</html>
+`
+
+type OpenAPIHandler struct {
+	doc    *openapi3.T
+	logger logger.Logger
+}
+
+func NewOpenAPIHandler(doc *openapi3.T, logger logger.Logger) *OpenAPIHandler {
+	return &OpenAPIHandler{doc: doc, logger: logger}
+}
+
+func (h *OpenAPIHandler) InitRoutes(router *mux.Router) {
+	router.HandleFunc("/openapi.json", h.Spec).Methods(http.MethodGet)
+	router.HandleFunc("/docs", h.Docs).Methods(http.MethodGet)
+}
+
+func (h *OpenAPIHandler) Spec(w http.ResponseWriter, r *http.Request) {
+	if err := myHttp.WriteResponse(h.doc, w, contentType, http.StatusOK); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal openapi spec: %s", err.Error()))
+	}
+}
+
+func (h *OpenAPIHandler) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(docsPage)); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+	}
+}
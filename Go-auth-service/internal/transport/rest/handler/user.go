@@ -26,6 +26,9 @@ func New(service user.Service, logger logger.Logger) *UserHandler {
 
 func (h *UserHandler) InitRoutes(router *mux.Router) {
 	router.HandleFunc("/user", h.Create).Methods(http.MethodPost)
+	router.HandleFunc("/user/import", h.Import).Methods(http.MethodPost)
+	router.HandleFunc("/user/import/{id}", h.GetImportJob).Methods(http.MethodGet)
+	router.HandleFunc("/user/export", h.Export).Methods(http.MethodGet)
 	router.HandleFunc("/user/{id}", h.Update).Methods(http.MethodPut)
 	router.HandleFunc("/user/{id}", h.GetById).Methods(http.MethodGet)
 	router.HandleFunc("/user", h.GetWithOffsetAndLimit).Methods(http.MethodGet).Queries("offset", "{offset}", "limit", "{limit}")
@@ -61,7 +64,7 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := myHttp.WriteResponse(&u, w, contentType, http.StatusCreated); err != nil {
+	if err := myHttp.WriteResponse(u.Export(), w, contentType, http.StatusCreated); err != nil {
 		h.logger.Warning(fmt.Sprintf("Error: unable to marshal order struct: %v ", u))
 	}
 }
@@ -88,7 +91,7 @@ func (h *UserHandler) GetById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := myHttp.WriteResponse(&u, w, contentType, http.StatusOK); err != nil {
+	if err := myHttp.WriteResponse(u.Export(), w, contentType, http.StatusOK); err != nil {
 		h.logger.Warning(fmt.Sprintf("Error: unable to marshal order struct: %v ", u))
 	}
 }
@@ -123,7 +126,7 @@ func (h *UserHandler) GetWithOffsetAndLimit(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := myHttp.WriteResponse(&users, w, contentType, http.StatusOK); err != nil {
+	if err := myHttp.WriteResponse(exportUsers(*users), w, contentType, http.StatusOK); err != nil {
 		h.logger.Warning(fmt.Sprintf("Error: unable to marshal order struct"))
 	}
 }
@@ -149,8 +152,20 @@ func (h *UserHandler) GetRegisteredLaterThen(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	var afterID uuid.UUID
+	if afterIDString := r.URL.Query().Get("after_id"); afterIDString != "" {
+		afterID, err = uuid.Parse(afterIDString)
+		if err != nil {
+			err := HandleError(w, apperrors.ErrInvalidIdFormat)
+			if err != nil {
+				h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+			}
+			return
+		}
+	}
+
 	var users *[]user.User
-	if users, err = h.service.GetRegisteredLaterThenWithLimit(r.Context(), registerDateString, limit); err != nil {
+	if users, err = h.service.GetRegisteredLaterThenWithLimit(r.Context(), registerDateString, afterID, limit); err != nil {
 		err := HandleError(w, err)
 		if err != nil {
 			h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
@@ -158,7 +173,7 @@ func (h *UserHandler) GetRegisteredLaterThen(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if err := myHttp.WriteResponse(&users, w, contentType, http.StatusOK); err != nil {
+	if err := myHttp.WriteResponse(exportUsers(*users), w, contentType, http.StatusOK); err != nil {
 		h.logger.Warning(fmt.Sprintf("Error: unable to marshal order struct"))
 	}
 }
@@ -203,7 +218,7 @@ func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := myHttp.WriteResponse(&u, w, contentType, http.StatusAccepted); err != nil {
+	if err := myHttp.WriteResponse(u.Export(), w, contentType, http.StatusAccepted); err != nil {
 		h.logger.Warning(fmt.Sprintf("Error: unable to marshal order struct: %v ", u))
 	}
 }
@@ -231,3 +246,12 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// exportUsers strips the credentials from a page of users before it is served.
+func exportUsers(users []user.User) []user.ExportedUser {
+	exported := make([]user.ExportedUser, 0, len(users))
+	for i := range users {
+		exported = append(exported, users[i].Export())
+	}
+	return exported
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+type RoutesInitializer func(router *mux.Router)
+
+// Version is a set of routes mounted under /{Name}. A version with a Deprecation date answers with
+// Deprecation, Sunset and successor Link headers so clients can migrate before it is removed.
+type Version struct {
+	Name        string
+	Deprecation *time.Time
+	Sunset      *time.Time
+	Successor   string
+	Routes      []RoutesInitializer
+}
+
+func (v Version) Prefix() string {
+	return "/" + v.Name
+}
+
+func InitVersionedRoutes(router *mux.Router, versions ...Version) {
+	for _, version := range versions {
+		sub := router.PathPrefix(version.Prefix()).Subrouter()
+
+		if version.Deprecation != nil {
+			successor := version.Successor
+			sub.Use(DeprecationMiddleware(*version.Deprecation, version.Sunset, func(r *http.Request) string {
+				if successor == "" {
+					return ""
+				}
+				return "/" + successor
+			}))
+		}
+
+		for _, initRoutes := range version.Routes {
+			initRoutes(sub)
+		}
+	}
+}
+
+// InitLegacyRoutes keeps the unversioned paths working as an alias of the given version. Register it after
+// every other route: it only catches requests that nothing else matched.
+func InitLegacyRoutes(router *mux.Router, version Version, deprecation time.Time, sunset *time.Time) {
+	legacy := router.NewRoute().Subrouter()
+	legacy.Use(DeprecationMiddleware(deprecation, sunset, func(r *http.Request) string {
+		return version.Prefix() + r.URL.Path
+	}))
+
+	for _, initRoutes := range version.Routes {
+		initRoutes(legacy)
+	}
+}
+
+func DeprecationMiddleware(deprecation time.Time, sunset *time.Time, successor func(r *http.Request) string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", deprecation.Unix()))
+			if sunset != nil {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			if link := successor(r); link != "" {
+				w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", link))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
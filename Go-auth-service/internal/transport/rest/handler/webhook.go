@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/webhook"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type WebhookHandler struct {
+	service webhook.Service
+	logger  logger.Logger
+}
+
+func NewWebhookHandler(service webhook.Service, logger logger.Logger) *WebhookHandler {
+	return &WebhookHandler{service: service, logger: logger}
+}
+
+func (h *WebhookHandler) InitRoutes(router *mux.Router) {
+	router.HandleFunc("/webhook", h.Subscribe).Methods(http.MethodPost)
+	router.HandleFunc("/webhook", h.GetSubscriptions).Methods(http.MethodGet)
+	router.HandleFunc("/webhook/{id}", h.GetSubscription).Methods(http.MethodGet)
+	router.HandleFunc("/webhook/{id}", h.Unsubscribe).Methods(http.MethodDelete)
+	router.HandleFunc("/webhook/{id}/delivery", h.GetDeliveries).Methods(http.MethodGet)
+	router.HandleFunc("/webhook/{id}/delivery/{deliveryId}", h.GetDelivery).Methods(http.MethodGet)
+	router.HandleFunc("/webhook/{id}/delivery/{deliveryId}/redeliver", h.Redeliver).Methods(http.MethodPost)
+}
+
+func (h *WebhookHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	if err := myHttp.ValidateRequestFormat(r, contentType); err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestFormat)
+		return
+	}
+
+	var subscription webhook.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestBody)
+		return
+	}
+
+	if err := h.service.Subscribe(r.Context(), &subscription); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, &subscription, http.StatusCreated)
+}
+
+func (h *WebhookHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := h.service.GetSubscriptions(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, subscriptions, http.StatusOK)
+}
+
+func (h *WebhookHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	subscription, err := h.service.GetSubscription(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, subscription, http.StatusOK)
+}
+
+func (h *WebhookHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	if err := h.service.Unsubscribe(r.Context(), id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	filter, err := parseDeliveryFilter(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	deliveries, err := h.service.GetDeliveries(r.Context(), id, filter)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, deliveries, http.StatusOK)
+}
+
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	id, deliveryId, err := parseDeliveryIds(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	delivery, err := h.service.GetDelivery(r.Context(), id, deliveryId)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, delivery, http.StatusOK)
+}
+
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, deliveryId, err := parseDeliveryIds(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	delivery, err := h.service.Redeliver(r.Context(), id, deliveryId)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, delivery, http.StatusAccepted)
+}
+
+func (h *WebhookHandler) writeResponse(w http.ResponseWriter, data interface{}, status int) {
+	if err := myHttp.WriteResponse(data, w, contentType, status); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal webhook response: %s", err.Error()))
+	}
+}
+
+func (h *WebhookHandler) writeError(w http.ResponseWriter, err error) {
+	if err := HandleError(w, err); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+	}
+}
+
+func parseDeliveryIds(r *http.Request) (uuid.UUID, uuid.UUID, error) {
+	vars := mux.Vars(r)
+
+	id, err := uuid.Parse(vars["id"])
+	if err != nil {
+		return uuid.Nil, uuid.Nil, apperrors.ErrInvalidIdFormat
+	}
+	deliveryId, err := uuid.Parse(vars["deliveryId"])
+	if err != nil {
+		return uuid.Nil, uuid.Nil, apperrors.ErrInvalidIdFormat
+	}
+
+	return id, deliveryId, nil
+}
+
+func parseDeliveryFilter(r *http.Request) (webhook.DeliveryFilter, error) {
+	query := r.URL.Query()
+	filter := webhook.DeliveryFilter{Status: webhook.DeliveryStatus(query.Get("status"))}
+
+	if offset := query.Get("offset"); offset != "" {
+		parsed, err := strconv.Atoi(offset)
+		if err != nil || parsed < 0 {
+			return filter, apperrors.ErrInvalidOffsetFormat
+		}
+		filter.Offset = parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 0 {
+			return filter, apperrors.ErrInvalidLimitFormat
+		}
+		filter.Limit = parsed
+	}
+
+	return filter, nil
+}
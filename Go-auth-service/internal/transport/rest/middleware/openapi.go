@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+	"mime"
+	"net/http"
+)
+
+const contentType = "application/json"
+
+var streamedContentTypes = map[string]bool{
+	"text/csv":             true,
+	"application/x-ndjson": true,
+}
+
+// OpenAPIValidator rejects requests that do not match the spec mounted under any of basePaths. Paths that are
+// not described in the spec (ping, docs) are passed through untouched.
+func OpenAPIValidator(doc *openapi3.T, logger logger.Logger, basePaths ...string) (mux.MiddlewareFunc, error) {
+	routingDoc := *doc
+	routingDoc.Servers = make(openapi3.Servers, 0, len(basePaths))
+	for _, basePath := range basePaths {
+		routingDoc.Servers = append(routingDoc.Servers, &openapi3.Server{URL: basePath})
+	}
+
+	router, err := gorillamux.NewRouter(&routingDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err == routers.ErrPathNotFound {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				writeValidationError(w, err, logger)
+				return
+			}
+
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					ExcludeRequestBody: streamedContentTypes[mediaType],
+					MultiError:         true,
+				},
+			}
+
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				writeValidationError(w, err, logger)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func writeValidationError(w http.ResponseWriter, err error, logger logger.Logger) {
+	status := http.StatusBadRequest
+	if err == routers.ErrMethodNotAllowed {
+		status = http.StatusMethodNotAllowed
+	}
+
+	resp := handler.Error{
+		Code:          int32(status),
+		Message:       apperrors.ErrRequestValidation.Error(),
+		DetailMessage: err.Error(),
+	}
+	if err := myHttp.WriteResponse(resp, w, contentType, status); err != nil {
+		logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/user"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (r *Repository) CreateImportJob(ctx context.Context, job *user.ImportJob) error {
+	query := "INSERT INTO import_job (id, status) VALUES ($1, $2) RETURNING createdAt, updatedAt"
+
+	err := r.db.QueryRowContext(ctx, query, job.ID, job.Status).Scan(&job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) UpdateImportJob(ctx context.Context, job *user.ImportJob) error {
+	var report interface{}
+	if job.Report != nil {
+		data, err := json.Marshal(job.Report)
+		if err != nil {
+			return apperrors.ErrInternalJsonProcessing
+		}
+		report = string(data)
+	}
+
+	query := `UPDATE import_job SET status=$2, error=$3, report=$4, finishedAt=$5, updatedAt=current_timestamp
+		WHERE id=$1 RETURNING updatedAt`
+
+	err := r.db.QueryRowContext(ctx, query, job.ID, job.Status, job.Error, report, job.FinishedAt).Scan(&job.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return apperrors.ErrImportJobNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+// TouchImportJob records that the job is still being worked on.
+func (r *Repository) TouchImportJob(ctx context.Context, id uuid.UUID) error {
+	query := "UPDATE import_job SET updatedAt=current_timestamp WHERE id=$1 AND finishedAt IS NULL"
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+// GetImportJob reports an unfinished job that was not touched for staleAfter as failed: the process running
+// it is gone.
+func (r *Repository) GetImportJob(ctx context.Context, id uuid.UUID, staleAfter time.Duration) (*user.ImportJob, error) {
+	query := `SELECT id, status, error, report, createdAt, updatedAt, finishedAt,
+		finishedAt IS NULL AND updatedAt < current_timestamp - make_interval(secs => $2) AS stale
+		FROM import_job WHERE id=$1`
+
+	var job user.ImportJob
+	var report []byte
+	var stale bool
+	err := r.db.QueryRowContext(ctx, query, id, staleAfter.Seconds()).Scan(&job.ID, &job.Status, &job.Error, &report,
+		&job.CreatedAt, &job.UpdatedAt, &job.FinishedAt, &stale)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrImportJobNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	if report != nil {
+		job.Report = &user.ImportReport{}
+		if err := json.Unmarshal(report, job.Report); err != nil {
+			return nil, apperrors.ErrInternalJsonProcessing
+		}
+	}
+	if stale {
+		job.Status = user.ImportJobFailed
+		job.Error = apperrors.ErrImportInterrupted.Error()
+	}
+
+	return &job, nil
+}
+
+// DeleteExpiredImportJobs deletes the jobs last updated more than ttl ago, finished or abandoned.
+func (r *Repository) DeleteExpiredImportJobs(ctx context.Context, ttl time.Duration) (int64, error) {
+	query := "DELETE FROM import_job WHERE updatedAt < current_timestamp - make_interval(secs => $1)"
+
+	result, err := r.db.ExecContext(ctx, query, ttl.Seconds())
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return 0, apperrors.ErrDbQueryProcessing
+	}
+
+	return result.RowsAffected()
+}
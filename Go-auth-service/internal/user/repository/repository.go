@@ -4,39 +4,128 @@ import (
 	"Golang-practice-2023/internal/domain/apperrors"
 	"Golang-practice-2023/internal/domain/logger"
 	"Golang-practice-2023/internal/domain/user"
+	outboxRepository "Golang-practice-2023/internal/outbox/repository"
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"time"
 )
 
 type Repository struct {
-	db     *sqlx.DB
-	logger logger.Logger
+	db        *sqlx.DB
+	logger    logger.Logger
+	listeners []user.TxListener
 }
 
 func New(db *sqlx.DB, logger logger.Logger) *Repository {
 	return &Repository{db: db, logger: logger}
 }
 
+// OnChange registers a listener called inside the transaction of every user change. Listeners are
+// registered before the repository is used.
+func (r *Repository) OnChange(listener user.TxListener) {
+	r.listeners = append(r.listeners, listener)
+}
+
 func (r *Repository) GetDbInstance() *sqlx.DB {
 	return r.db
 }
 
-func (r *Repository) Create(ctx context.Context, user *user.User) error {
-	if u, _ := r.GetByEmail(ctx, user.Email); u != nil {
+func (r *Repository) Create(ctx context.Context, u *user.User, newMessage user.NewMessage) error {
+	if existing, _ := r.GetByEmail(ctx, u.Email); existing != nil {
 		return apperrors.ErrAlreadyRegisteredUserEmail
 	}
 
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
 	query := "INSERT INTO account (email, passwordhash) VALUES ($1, $2) RETURNING id, createdAt, updatedAt"
 
-	row := r.db.QueryRowContext(ctx, query, user.Email, user.Passwordhash)
-	err := row.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	row := tx.QueryRowContext(ctx, query, u.Email, u.Passwordhash)
+	err = row.Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt)
 	if err != nil {
 		r.logger.Warning(err.Error())
+		_ = tx.Rollback()
 		return apperrors.ErrDbQueryProcessing
 	}
 
+	if err := r.recordChange(ctx, tx, user.ChangeCreated, u, newMessage); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) CreateBatch(ctx context.Context, users []*user.User, newMessage user.NewMessage) ([]error, error) {
+	rowErrors := make([]error, len(users))
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	query := "INSERT INTO account (email, passwordhash) VALUES ($1, $2) ON CONFLICT (email) DO NOTHING RETURNING id, createdAt, updatedAt"
+
+	for i, u := range users {
+		row := tx.QueryRowContext(ctx, query, u.Email, u.Passwordhash)
+		err := row.Scan(&u.ID, &u.CreatedAt, &u.UpdatedAt)
+		if err == sql.ErrNoRows {
+			rowErrors[i] = apperrors.ErrAlreadyRegisteredUserEmail
+			continue
+		}
+		if err != nil {
+			r.logger.Warning(err.Error())
+			_ = tx.Rollback()
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+
+		if err := r.recordChange(ctx, tx, user.ChangeCreated, u, newMessage); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return rowErrors, nil
+}
+
+// recordChange stores the outbox message of a change and runs the listeners, all in the change's transaction.
+func (r *Repository) recordChange(ctx context.Context, tx *sqlx.Tx, changeType user.ChangeType, u *user.User,
+	newMessage user.NewMessage) error {
+	if newMessage != nil {
+		message, err := newMessage(u)
+		if err != nil {
+			return err
+		}
+		if err := outboxRepository.Insert(ctx, tx, message); err != nil {
+			r.logger.Warning(err.Error())
+			return apperrors.ErrDbQueryProcessing
+		}
+	}
+
+	change := user.Change{Type: changeType, User: *u, OccurredAt: time.Now().UTC()}
+	for _, listener := range r.listeners {
+		if err := listener(ctx, tx, change); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -64,12 +153,20 @@ func (r *Repository) GetByEmail(ctx context.Context, email string) (*user.User,
 	return &u, nil
 }
 
-func (r *Repository) GetRegisteredLaterThen(ctx context.Context, registerDate string, limit int) (*[]user.User, error) {
+// GetRegisteredLaterThen pages through the users ordered by (createdAt, id). Without afterID it returns the users
+// registered after registerDate; with it, the users after the (registerDate, afterID) cursor, so users sharing a
+// timestamp are not skipped between pages.
+func (r *Repository) GetRegisteredLaterThen(ctx context.Context, registerDate string, afterID uuid.UUID, limit int) (*[]user.User, error) {
 	var users []user.User
 
-	query := "SELECT id, email, passwordhash, createdAt, updatedAt FROM account WHERE createdat > $1 LIMIT $2"
+	query := "SELECT id, email, passwordhash, createdAt, updatedAt FROM account WHERE createdat > $1 ORDER BY createdat, id LIMIT $2"
+	args := []interface{}{registerDate, limit}
+	if afterID != uuid.Nil {
+		query = "SELECT id, email, passwordhash, createdAt, updatedAt FROM account WHERE (createdat, id) > ($1, $2) ORDER BY createdat, id LIMIT $3"
+		args = []interface{}{registerDate, afterID, limit}
+	}
 
-	err := r.db.SelectContext(ctx, &users, query, registerDate, limit)
+	err := r.db.SelectContext(ctx, &users, query, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return &users, nil
@@ -96,16 +193,108 @@ func (r *Repository) GetWithOffsetAndLimit(ctx context.Context, offset int, limi
 	return &users, nil
 }
 
-func (r *Repository) Update(ctx context.Context, user *user.User) error {
-	if u, _ := r.GetById(ctx, user.ID); u == nil {
+const exportFetchSize = 500
+
+func (r *Repository) Export(ctx context.Context, filter user.ExportFilter, fn func(user *user.ExportedUser) error) error {
+	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := "DECLARE export_cursor NO SCROLL CURSOR FOR SELECT id, email, createdAt, updatedAt FROM account"
+	args := make([]interface{}, 0, 4)
+	if filter.RegisteredAfter != "" && filter.AfterID != uuid.Nil {
+		args = append(args, filter.RegisteredAfter, filter.AfterID)
+		query += fmt.Sprintf(" WHERE (createdat, id) > ($%d, $%d)", len(args)-1, len(args))
+	} else if filter.RegisteredAfter != "" {
+		args = append(args, filter.RegisteredAfter)
+		query += fmt.Sprintf(" WHERE createdat > $%d", len(args))
+	}
+	query += " ORDER BY createdat, id"
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	fetchQuery := fmt.Sprintf("FETCH %d FROM export_cursor", exportFetchSize)
+	for {
+		rows, err := tx.QueryxContext(ctx, fetchQuery)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			return apperrors.ErrDbQueryProcessing
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var u user.ExportedUser
+			if err := rows.StructScan(&u); err != nil {
+				_ = rows.Close()
+				r.logger.Warning(err.Error())
+				return apperrors.ErrDbQueryProcessing
+			}
+			fetched++
+
+			if err := fn(&u); err != nil {
+				_ = rows.Close()
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			r.logger.Warning(err.Error())
+			return apperrors.ErrDbQueryProcessing
+		}
+		_ = rows.Close()
+
+		if fetched < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+func (r *Repository) Update(ctx context.Context, u *user.User, newMessage user.NewMessage) error {
+	if existing, _ := r.GetById(ctx, u.ID); existing == nil {
 		return apperrors.ErrUserNotFound
 	}
 
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
 	query := "UPDATE account SET email=$1, passwordhash=$2, updatedAt=current_timestamp WHERE id=$3 RETURNING createdAt, updatedAt"
 
-	row := r.db.QueryRowContext(ctx, query, user.Email, user.Passwordhash, user.ID)
-	err := row.Scan(&user.CreatedAt, &user.UpdatedAt)
+	row := tx.QueryRowContext(ctx, query, u.Email, u.Passwordhash, u.ID)
+	err = row.Scan(&u.CreatedAt, &u.UpdatedAt)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
+		return apperrors.ErrUserNotFound
+	}
 	if err != nil {
+		r.logger.Warning(err.Error())
+		_ = tx.Rollback()
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	if err := r.recordChange(ctx, tx, user.ChangeUpdated, u, newMessage); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
 		r.logger.Warning(err.Error())
 		return apperrors.ErrDbQueryProcessing
 	}
@@ -113,23 +302,36 @@ func (r *Repository) Update(ctx context.Context, user *user.User) error {
 	return nil
 }
 
-func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := "DELETE FROM account WHERE id=$1"
-
-	result, err := r.db.ExecContext(ctx, query, id)
+func (r *Repository) Delete(ctx context.Context, id uuid.UUID, newMessage user.NewMessage) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
+		r.logger.Warning(err.Error())
 		return apperrors.ErrDbQueryProcessing
 	}
 
-	if u, _ := r.GetById(ctx, id); u == nil {
+	deleted := &user.User{ID: id}
+	query := "DELETE FROM account WHERE id=$1 RETURNING email, passwordhash, createdAt, updatedAt"
+
+	row := tx.QueryRowContext(ctx, query, id)
+	err = row.Scan(&deleted.Email, &deleted.Passwordhash, &deleted.CreatedAt, &deleted.UpdatedAt)
+	if err == sql.ErrNoRows {
+		_ = tx.Rollback()
 		return apperrors.ErrUserNotFound
 	}
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
+		r.logger.Warning(err.Error())
+		_ = tx.Rollback()
 		return apperrors.ErrDbQueryProcessing
 	}
-	if rowsAffected == 0 {
-		return apperrors.ErrUserNotFound
+
+	if err := r.recordChange(ctx, tx, user.ChangeDeleted, deleted, newMessage); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
 	}
 
 	return nil
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/outbox"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/pkg/cloudevents"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const eventSource = "/go-auth"
+
+// The messages below are stored with the account change and published to NATS by the outbox relay as
+// structured CloudEvents whose type is also the NATS subject.
+
+func (service *Service) userCreatedMessage(u *user.User) (*outbox.Message, error) {
+	return service.newMessage(event.SubjectUserCreated, u, event.UserCreated{
+		ID:        u.ID,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	})
+}
+
+func (service *Service) userUpdatedMessage(u *user.User) (*outbox.Message, error) {
+	return service.newMessage(event.SubjectUserUpdated, u, event.UserUpdated{
+		ID:        u.ID,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	})
+}
+
+func (service *Service) userDeletedMessage(u *user.User) (*outbox.Message, error) {
+	return service.newMessage(event.SubjectUserDeleted, u, event.UserDeleted{ID: u.ID, DeletedAt: time.Now().UTC()})
+}
+
+func (service *Service) newMessage(eventType string, u *user.User, payload interface{}) (*outbox.Message, error) {
+	schema, err := service.schemas.Latest(eventType)
+	if err != nil {
+		service.logger.Warning(fmt.Sprintf("No schema for %s events", eventType))
+		return nil, apperrors.ErrEventValidation
+	}
+
+	ce, err := cloudevents.New(eventSource, eventType, schema, payload)
+	if err != nil {
+		return nil, apperrors.ErrInternalJsonProcessing
+	}
+	ce.Subject = u.ID.String()
+
+	if err := service.schemas.Validate(ce); err != nil {
+		service.logger.Warning(fmt.Sprintf("Refusing to publish invalid %s event: %s", eventType, err.Error()))
+		return nil, apperrors.ErrEventValidation
+	}
+
+	data, err := json.Marshal(ce)
+	if err != nil {
+		return nil, apperrors.ErrInternalJsonProcessing
+	}
+
+	return &outbox.Message{Subject: eventType, Key: u.ID.String(), Payload: data}, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"time"
+)
+
+const (
+	importBatchSize = 100
+
+	// Import jobs are kept for importJobTTL after their last update. A running job is touched every
+	// importJobHeartbeat, and reported as failed when it was not touched for importJobStaleAfter.
+	importJobTTL        = 24 * time.Hour
+	importJobHeartbeat  = time.Minute
+	importJobStaleAfter = 5 * time.Minute
+)
+
+func (service *Service) Import(ctx context.Context, source user.RowSource) (*user.ImportReport, error) {
+	report := &user.ImportReport{Rows: make([]user.ImportRowResult, 0)}
+
+	batch := make([]*user.User, 0, importBatchSize)
+	batchResults := make([]int, 0, importBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		rowErrors, err := service.repository.CreateBatch(ctx, batch, service.userCreatedMessage)
+		for i, u := range batch {
+			result := &report.Rows[batchResults[i]]
+			rowErr := err
+			if rowErr == nil {
+				rowErr = rowErrors[i]
+			}
+			if rowErr != nil {
+				result.Error = rowErr.Error()
+				report.Failed++
+				continue
+			}
+
+			id := u.ID
+			result.ID = &id
+			report.Succeeded++
+			service.watchers.created(u)
+		}
+
+		batch = batch[:0]
+		batchResults = batchResults[:0]
+		return err
+	}
+
+	for {
+		row, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		report.Total++
+		report.Rows = append(report.Rows, user.ImportRowResult{Line: row.Line, Email: row.Email})
+		result := &report.Rows[len(report.Rows)-1]
+
+		if err := validateImportRow(row); err != nil {
+			result.Error = err.Error()
+			report.Failed++
+			continue
+		}
+
+		batch = append(batch, &user.User{Email: row.Email, Passwordhash: hashPassword(row.Password)})
+		batchResults = append(batchResults, len(report.Rows)-1)
+
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				service.logger.Warning(fmt.Sprintf("Failed to import batch: %s", err.Error()))
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		service.logger.Warning(fmt.Sprintf("Failed to import batch: %s", err.Error()))
+	}
+
+	return report, nil
+}
+
+// StartImport stores the job and runs the import in the background. The job is visible to every replica
+// sharing the database.
+func (service *Service) StartImport(ctx context.Context, source user.RowSource, onDone func()) (*user.ImportJob, error) {
+	if deleted, err := service.repository.DeleteExpiredImportJobs(ctx, importJobTTL); err != nil {
+		service.logger.Warning(fmt.Sprintf("Failed to delete expired import jobs: %s", err.Error()))
+	} else if deleted > 0 {
+		service.logger.Info(fmt.Sprintf("Deleted %d expired import jobs", deleted))
+	}
+
+	job := &user.ImportJob{ID: uuid.New(), Status: user.ImportJobPending}
+	if err := service.repository.CreateImportJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	jobCopy := *job
+	go func() {
+		defer onDone()
+		service.runImport(job, source)
+	}()
+
+	return &jobCopy, nil
+}
+
+func (service *Service) runImport(job *user.ImportJob, source user.RowSource) {
+	ctx := context.Background()
+
+	job.Status = user.ImportJobRunning
+	if err := service.repository.UpdateImportJob(ctx, job); err != nil {
+		service.logger.Warning(fmt.Sprintf("Failed to update import job %s: %s", job.ID, err.Error()))
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	heartbeatStopped := make(chan struct{})
+	go func() {
+		defer close(heartbeatStopped)
+		ticker := time.NewTicker(importJobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-ticker.C:
+				if err := service.repository.TouchImportJob(heartbeatCtx, job.ID); err != nil {
+					service.logger.Warning(fmt.Sprintf("Failed to touch import job %s: %s", job.ID, err.Error()))
+				}
+			}
+		}
+	}()
+
+	report, err := service.Import(ctx, source)
+	stopHeartbeat()
+	<-heartbeatStopped
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	if err != nil {
+		job.Status = user.ImportJobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = user.ImportJobFinished
+		job.Report = report
+	}
+	if err := service.repository.UpdateImportJob(ctx, job); err != nil {
+		service.logger.Error(fmt.Sprintf("Failed to store the result of import job %s: %s", job.ID, err.Error()))
+	}
+}
+
+func (service *Service) GetImportJob(ctx context.Context, id uuid.UUID) (*user.ImportJob, error) {
+	return service.repository.GetImportJob(ctx, id, importJobStaleAfter)
+}
+
+func validateImportRow(row *user.ImportRow) error {
+	if row.Err != nil {
+		return row.Err
+	}
+	if err := validateEmail(row.Email); err != nil {
+		return err
+	}
+	return validatePassword(row.Password)
+}
@@ -4,23 +4,23 @@ import (
 	"Golang-practice-2023/internal/domain/apperrors"
 	"Golang-practice-2023/internal/domain/logger"
 	"Golang-practice-2023/internal/domain/user"
-	"Golang-practice-2023/pkg/pubsub/nats/pub"
+	"Golang-practice-2023/pkg/cloudevents"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"github.com/google/uuid"
 	"regexp"
 )
 
 type Service struct {
 	repository user.Repository
+	schemas    *cloudevents.Registry
 	logger     logger.Logger
-	nats       *pub.NatsPublisher
+	watchers   *watchers
 }
 
-func New(repository user.Repository, logger logger.Logger, nats *pub.NatsPublisher) *Service {
-	return &Service{repository: repository, logger: logger, nats: nats}
+func New(repository user.Repository, schemas *cloudevents.Registry, logger logger.Logger) *Service {
+	return &Service{repository: repository, schemas: schemas, logger: logger, watchers: newWatchers(logger)}
 }
 
 func (service *Service) Create(ctx context.Context, user *user.User) error {
@@ -34,24 +34,13 @@ func (service *Service) Create(ctx context.Context, user *user.User) error {
 	hashedPassword := hashPassword(user.Passwordhash)
 	user.Passwordhash = hashedPassword
 
-	err := service.repository.Create(ctx, user)
+	err := service.repository.Create(ctx, user, service.userCreatedMessage)
 	if err != nil {
 		return err
 	}
 
-	createdUserData, err := json.Marshal(user)
-	if err != nil {
-		service.logger.Warning("Failed to marshal user")
-		return apperrors.ErrInternalJsonProcessing
-	}
-
-	err = service.nats.Publish("NewUser", createdUserData)
-	if err != nil {
-		service.logger.Warning("Failed to push user data to nats")
-		return apperrors.ErrNatsPublishing
-	}
-
-	return err
+	service.watchers.created(user)
+	return nil
 }
 
 func (service *Service) GetById(ctx context.Context, id uuid.UUID) (*user.User, error) {
@@ -66,8 +55,12 @@ func (service *Service) GetWithOffsetAndLimit(ctx context.Context, offset int, l
 	return service.repository.GetWithOffsetAndLimit(ctx, offset, limit)
 }
 
-func (service *Service) GetRegisteredLaterThenWithLimit(ctx context.Context, registerDate string, limit int) (*[]user.User, error) {
-	return service.repository.GetRegisteredLaterThen(ctx, registerDate, limit)
+func (service *Service) GetRegisteredLaterThenWithLimit(ctx context.Context, registerDate string, afterID uuid.UUID, limit int) (*[]user.User, error) {
+	return service.repository.GetRegisteredLaterThen(ctx, registerDate, afterID, limit)
+}
+
+func (service *Service) Export(ctx context.Context, filter user.ExportFilter, fn func(user *user.ExportedUser) error) error {
+	return service.repository.Export(ctx, filter, fn)
 }
 
 func (service *Service) Update(ctx context.Context, user *user.User) error {
@@ -86,15 +79,26 @@ func (service *Service) Update(ctx context.Context, user *user.User) error {
 	hashedPassword := hashPassword(user.Passwordhash)
 	user.Passwordhash = hashedPassword
 
-	return service.repository.Update(ctx, user)
+	if err := service.repository.Update(ctx, user, service.userUpdatedMessage); err != nil {
+		return err
+	}
+
+	service.watchers.updated(user)
+	return nil
 }
 
 func (service *Service) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := service.GetById(ctx, id)
+	deletedUser, err := service.GetById(ctx, id)
 	if err != nil {
 		return err
 	}
-	return service.repository.Delete(ctx, id)
+
+	if err := service.repository.Delete(ctx, id, service.userDeletedMessage); err != nil {
+		return err
+	}
+
+	service.watchers.deleted(deletedUser)
+	return nil
 }
 
 func validateEmail(email string) error {
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/user"
+	"context"
+	"sync"
+	"time"
+)
+
+const watcherBufferSize = 64
+
+type watchers struct {
+	mu        sync.RWMutex
+	subs      map[chan user.Change]struct{}
+	listeners []func(change user.Change)
+	logger    logger.Logger
+}
+
+func newWatchers(logger logger.Logger) *watchers {
+	return &watchers{subs: make(map[chan user.Change]struct{}), logger: logger}
+}
+
+func (w *watchers) add(ctx context.Context) <-chan user.Change {
+	ch := make(chan user.Change, watcherBufferSize)
+
+	w.mu.Lock()
+	w.subs[ch] = struct{}{}
+	w.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		w.mu.Lock()
+		w.remove(ch)
+		w.mu.Unlock()
+	}()
+
+	return ch
+}
+
+func (w *watchers) remove(ch chan user.Change) {
+	if _, ok := w.subs[ch]; ok {
+		delete(w.subs, ch)
+		close(ch)
+	}
+}
+
+func (w *watchers) listen(listener func(change user.Change)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.listeners = append(w.listeners, listener)
+}
+
+// notify never blocks a mutation on a watcher: one whose buffer is full is closed rather than silently
+// missing the change. Listeners are called synchronously and see every change.
+func (w *watchers) notify(changeType user.ChangeType, u *user.User) {
+	change := user.Change{Type: changeType, User: *u, OccurredAt: time.Now()}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, listener := range w.listeners {
+		listener(change)
+	}
+	for ch := range w.subs {
+		select {
+		case ch <- change:
+		default:
+			w.logger.Warning("Closed a user watcher that fell behind")
+			w.remove(ch)
+		}
+	}
+}
+
+func (w *watchers) created(u *user.User) {
+	w.notify(user.ChangeCreated, u)
+}
+
+func (w *watchers) updated(u *user.User) {
+	w.notify(user.ChangeUpdated, u)
+}
+
+func (w *watchers) deleted(u *user.User) {
+	w.notify(user.ChangeDeleted, u)
+}
+
+func (service *Service) Watch(ctx context.Context) <-chan user.Change {
+	return service.watchers.add(ctx)
+}
+
+// OnChange registers a listener that is called after every successful create, update and delete.
+func (service *Service) OnChange(listener func(change user.Change)) {
+	service.watchers.listen(listener)
+}
@@ -0,0 +1,372 @@
+package repository
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/webhook"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+const deliveryColumns = "id, subscriptionId, eventType, payload, status, attempts, nextAttemptAt, lastStatusCode, lastError, createdAt, updatedAt"
+
+type Repository struct {
+	db     *sqlx.DB
+	logger logger.Logger
+}
+
+func New(db *sqlx.DB, logger logger.Logger) *Repository {
+	return &Repository{db: db, logger: logger}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (r *Repository) CreateSubscription(ctx context.Context, subscription *webhook.Subscription) error {
+	query := "INSERT INTO webhook_subscription (url, eventTypes, secret) VALUES ($1, $2, $3) RETURNING id, createdAt"
+
+	row := r.db.QueryRowContext(ctx, query, subscription.URL, eventTypesToArray(subscription.EventTypes), subscription.Secret)
+	if err := row.Scan(&subscription.ID, &subscription.CreatedAt); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) GetSubscription(ctx context.Context, id uuid.UUID) (*webhook.Subscription, error) {
+	query := "SELECT id, url, eventTypes, secret, createdAt FROM webhook_subscription WHERE id=$1"
+
+	subscription, err := scanSubscription(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrWebhookNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return subscription, nil
+}
+
+func (r *Repository) GetSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	query := "SELECT id, url, eventTypes, secret, createdAt FROM webhook_subscription ORDER BY createdAt"
+	return r.selectSubscriptions(ctx, query)
+}
+
+func (r *Repository) GetSubscriptionsForEvent(ctx context.Context, eventType webhook.EventType) ([]webhook.Subscription, error) {
+	query := "SELECT id, url, eventTypes, secret, createdAt FROM webhook_subscription WHERE $1 = ANY(eventTypes)"
+	return r.selectSubscriptions(ctx, query, string(eventType))
+}
+
+func (r *Repository) selectSubscriptions(ctx context.Context, query string, args ...interface{}) ([]webhook.Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	subscriptions := make([]webhook.Subscription, 0)
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		subscriptions = append(subscriptions, *subscription)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return subscriptions, nil
+}
+
+func (r *Repository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM webhook_subscription WHERE id=$1", id)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.ErrDbQueryProcessing
+	}
+	if rowsAffected == 0 {
+		return apperrors.ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) CreateDeliveries(ctx context.Context, deliveries []*webhook.Delivery) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	query := "INSERT INTO webhook_delivery (subscriptionId, eventType, payload) VALUES ($1, $2, $3) RETURNING " + deliveryColumns
+
+	for _, delivery := range deliveries {
+		row := tx.QueryRowContext(ctx, query, delivery.SubscriptionID, string(delivery.EventType), []byte(delivery.Payload))
+		created, err := scanDelivery(row)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			_ = tx.Rollback()
+			return apperrors.ErrDbQueryProcessing
+		}
+		*delivery = *created
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) QueueDeliveries(ctx context.Context, tx *sqlx.Tx, eventType webhook.EventType, payload []byte) error {
+	query := `INSERT INTO webhook_delivery (subscriptionId, eventType, payload)
+	SELECT id, $1::text, $2::jsonb FROM webhook_subscription WHERE $1::text = ANY(eventTypes)`
+
+	if _, err := tx.ExecContext(ctx, query, string(eventType), payload); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhook.DueDelivery, error) {
+	query := fmt.Sprintf(`WITH due AS (
+		SELECT id FROM webhook_delivery
+		WHERE status = 'pending' AND nextAttemptAt <= current_timestamp
+		ORDER BY nextAttemptAt
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	UPDATE webhook_delivery d SET nextAttemptAt = current_timestamp + $2 * interval '1 millisecond'
+	FROM due, webhook_subscription s
+	WHERE d.id = due.id AND s.id = d.subscriptionId
+	RETURNING %s, s.url, s.secret`, prefixedDeliveryColumns("d"))
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Milliseconds())
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	due := make([]webhook.DueDelivery, 0)
+	for rows.Next() {
+		var d webhook.DueDelivery
+		var payload []byte
+		var statusCode sql.NullInt64
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&statusCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		d.Payload = payload
+		d.LastStatusCode = nullIntToPtr(statusCode)
+		due = append(due, d)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return due, nil
+}
+
+func (r *Repository) RecordAttempt(ctx context.Context, delivery *webhook.Delivery, attempt webhook.Attempt, retryIn time.Duration) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	attemptQuery := "INSERT INTO webhook_delivery_attempt (deliveryId, attempt, statusCode, error, durationMs) VALUES ($1, $2, $3, $4, $5)"
+	_, err = tx.ExecContext(ctx, attemptQuery, delivery.ID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMs)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		_ = tx.Rollback()
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	deliveryQuery := `UPDATE webhook_delivery SET status=$1, attempts=$2, nextAttemptAt=current_timestamp + $3 * interval '1 millisecond',
+		lastStatusCode=$4, lastError=$5, updatedAt=current_timestamp WHERE id=$6 RETURNING nextAttemptAt, updatedAt`
+	row := tx.QueryRowContext(ctx, deliveryQuery, string(delivery.Status), delivery.Attempts, retryIn.Milliseconds(),
+		delivery.LastStatusCode, delivery.LastError, delivery.ID)
+	if err := row.Scan(&delivery.NextAttemptAt, &delivery.UpdatedAt); err != nil {
+		r.logger.Warning(err.Error())
+		_ = tx.Rollback()
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) GetDeliveries(ctx context.Context, subscriptionId uuid.UUID, filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_delivery WHERE subscriptionId=$1"
+	args := []interface{}{subscriptionId}
+	if filter.Status != "" {
+		args = append(args, string(filter.Status))
+		query += fmt.Sprintf(" AND status=$%d", len(args))
+	}
+	query += " ORDER BY createdAt DESC, id"
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	deliveries := make([]webhook.Delivery, 0)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return deliveries, nil
+}
+
+func (r *Repository) GetDelivery(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*webhook.Delivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM webhook_delivery WHERE id=$1 AND subscriptionId=$2"
+
+	delivery, err := scanDelivery(r.db.QueryRowContext(ctx, query, id, subscriptionId))
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	historyQuery := "SELECT attempt, statusCode, error, durationMs, attemptedAt FROM webhook_delivery_attempt WHERE deliveryId=$1 ORDER BY id"
+	rows, err := r.db.QueryContext(ctx, historyQuery, id)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	delivery.History = make([]webhook.Attempt, 0)
+	for rows.Next() {
+		var attempt webhook.Attempt
+		var statusCode sql.NullInt64
+		if err := rows.Scan(&attempt.Attempt, &statusCode, &attempt.Error, &attempt.DurationMs, &attempt.AttemptedAt); err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		attempt.StatusCode = nullIntToPtr(statusCode)
+		delivery.History = append(delivery.History, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return delivery, nil
+}
+
+func (r *Repository) ResetDelivery(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*webhook.Delivery, error) {
+	query := `UPDATE webhook_delivery SET status='pending', attempts=0, nextAttemptAt=current_timestamp, updatedAt=current_timestamp
+		WHERE id=$1 AND subscriptionId=$2 RETURNING ` + deliveryColumns
+
+	delivery, err := scanDelivery(r.db.QueryRowContext(ctx, query, id, subscriptionId))
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return delivery, nil
+}
+
+func scanSubscription(row rowScanner) (*webhook.Subscription, error) {
+	var subscription webhook.Subscription
+	var eventTypes pq.StringArray
+	if err := row.Scan(&subscription.ID, &subscription.URL, &eventTypes, &subscription.Secret, &subscription.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	subscription.EventTypes = make([]webhook.EventType, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		subscription.EventTypes = append(subscription.EventTypes, webhook.EventType(eventType))
+	}
+
+	return &subscription, nil
+}
+
+func scanDelivery(row rowScanner) (*webhook.Delivery, error) {
+	var delivery webhook.Delivery
+	var payload []byte
+	var statusCode sql.NullInt64
+	err := row.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventType, &payload, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttemptAt, &statusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = payload
+	delivery.LastStatusCode = nullIntToPtr(statusCode)
+
+	return &delivery, nil
+}
+
+func prefixedDeliveryColumns(alias string) string {
+	return fmt.Sprintf("%[1]s.id, %[1]s.subscriptionId, %[1]s.eventType, %[1]s.payload, %[1]s.status, %[1]s.attempts, "+
+		"%[1]s.nextAttemptAt, %[1]s.lastStatusCode, %[1]s.lastError, %[1]s.createdAt, %[1]s.updatedAt", alias)
+}
+
+func eventTypesToArray(eventTypes []webhook.EventType) pq.StringArray {
+	array := make(pq.StringArray, 0, len(eventTypes))
+	for _, eventType := range eventTypes {
+		array = append(array, string(eventType))
+	}
+	return array
+}
+
+func nullIntToPtr(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	v := int(value.Int64)
+	return &v
+}
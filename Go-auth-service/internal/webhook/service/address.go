@@ -0,0 +1,77 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+func (service *Service) validateURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return apperrors.ErrInvalidWebhookURL
+	}
+	if service.config.AllowPrivateNetworks {
+		return nil
+	}
+
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return apperrors.ErrWebhookURLNotAllowed
+		}
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addresses) == 0 {
+		return apperrors.ErrInvalidWebhookURL
+	}
+	for _, address := range addresses {
+		if !isPublicIP(address.IP) {
+			return apperrors.ErrWebhookURLNotAllowed
+		}
+	}
+	return nil
+}
+
+// newHTTPClient checks the address of every connection, redirects included, as the host may resolve to another
+// address at delivery time than when the subscription was validated.
+func newHTTPClient(config Config) *http.Client {
+	dialer := &net.Dialer{Timeout: config.Timeout, KeepAlive: 30 * time.Second}
+	if !config.AllowPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", apperrors.ErrWebhookURLNotAllowed, host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: config.Timeout,
+		// No proxy: the checked address must be the one the request goes to.
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
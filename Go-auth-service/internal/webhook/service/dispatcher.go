@@ -0,0 +1,141 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/webhook"
+	signature "Golang-practice-2023/pkg/webhook"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	maxErrorLength = 512
+	leaseMargin    = 30 * time.Second
+)
+
+// Run sends due deliveries until ctx is cancelled.
+func (service *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(service.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			sent, err := service.DeliverDue(ctx)
+			if err != nil {
+				service.logger.Warning(fmt.Sprintf("Failed to deliver webhooks: %s", err.Error()))
+				break
+			}
+			if sent < service.config.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends one batch of due deliveries and returns how many were attempted.
+func (service *Service) DeliverDue(ctx context.Context) (int, error) {
+	due, err := service.repository.ClaimDueDeliveries(ctx, service.config.BatchSize, service.config.Timeout+leaseMargin)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range due {
+		wg.Add(1)
+		go func(delivery *webhook.DueDelivery) {
+			defer wg.Done()
+			service.deliver(ctx, delivery)
+		}(&due[i])
+	}
+	wg.Wait()
+
+	return len(due), nil
+}
+
+func (service *Service) deliver(ctx context.Context, due *webhook.DueDelivery) {
+	delivery := &due.Delivery
+	delivery.Attempts++
+	attempt := webhook.Attempt{Attempt: delivery.Attempts, AttemptedAt: time.Now()}
+
+	statusCode, err := service.send(ctx, due)
+	attempt.DurationMs = time.Since(attempt.AttemptedAt).Milliseconds()
+	attempt.StatusCode = statusCode
+	delivery.LastStatusCode = statusCode
+
+	var retryIn time.Duration
+	switch {
+	case err == nil:
+		delivery.Status = webhook.DeliverySucceeded
+		delivery.LastError = ""
+	case delivery.Attempts >= service.config.MaxAttempts:
+		delivery.Status = webhook.DeliveryDead
+		delivery.LastError = truncate(err.Error())
+		attempt.Error = delivery.LastError
+		service.logger.Warning(fmt.Sprintf("Webhook delivery %s is dead after %d attempts: %s", delivery.ID, delivery.Attempts, err.Error()))
+	default:
+		delivery.Status = webhook.DeliveryPending
+		delivery.LastError = truncate(err.Error())
+		attempt.Error = delivery.LastError
+		retryIn = service.backoff(delivery.Attempts)
+	}
+
+	// The outcome must be stored even if the dispatcher is shutting down, otherwise the delivery is resent.
+	if err := service.repository.RecordAttempt(context.Background(), delivery, attempt, retryIn); err != nil {
+		service.logger.Warning(fmt.Sprintf("Failed to record webhook delivery %s: %s", delivery.ID, err.Error()))
+	}
+}
+
+func (service *Service) send(ctx context.Context, due *webhook.DueDelivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, due.URL, bytes.NewReader(due.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(signature.DeliveryHeader, due.ID.String())
+	req.Header.Set(signature.EventHeader, string(due.EventType))
+	req.Header.Set(signature.TimestampHeader, fmt.Sprintf("%d", now.Unix()))
+	req.Header.Set(signature.SignatureHeader, signature.Sign(due.Secret, now, due.Payload))
+
+	resp, err := service.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	statusCode := resp.StatusCode
+	if statusCode < 200 || statusCode >= 300 {
+		return &statusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return &statusCode, nil
+}
+
+func (service *Service) backoff(attempts int) time.Duration {
+	delay := service.config.BaseBackoff
+	for i := 1; i < attempts && delay < service.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > service.config.MaxBackoff {
+		delay = service.config.MaxBackoff
+	}
+	return delay
+}
+
+func truncate(message string) string {
+	if len(message) > maxErrorLength {
+		return message[:maxErrorLength]
+	}
+	return message
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/webhook"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+type Config struct {
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	Timeout      time.Duration
+	PollInterval time.Duration
+	BatchSize    int
+	// AllowPrivateNetworks lets subscribers use private, loopback and link-local addresses. Only meant for
+	// local development and tests.
+	AllowPrivateNetworks bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:  8,
+		BaseBackoff:  10 * time.Second,
+		MaxBackoff:   time.Hour,
+		Timeout:      10 * time.Second,
+		PollInterval: time.Second,
+		BatchSize:    20,
+	}
+}
+
+type Service struct {
+	repository webhook.Repository
+	httpClient *http.Client
+	config     Config
+	logger     logger.Logger
+}
+
+func New(repository webhook.Repository, config Config, logger logger.Logger) *Service {
+	return &Service{
+		repository: repository,
+		httpClient: newHTTPClient(config),
+		config:     config,
+		logger:     logger,
+	}
+}
+
+func (service *Service) Subscribe(ctx context.Context, subscription *webhook.Subscription) error {
+	if err := service.validateURL(ctx, subscription.URL); err != nil {
+		return err
+	}
+	if len(subscription.EventTypes) == 0 {
+		return apperrors.ErrInvalidWebhookEventType
+	}
+	for _, eventType := range subscription.EventTypes {
+		if !eventType.IsValid() {
+			return apperrors.ErrInvalidWebhookEventType
+		}
+	}
+
+	if subscription.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			service.logger.Warning(err.Error())
+			return apperrors.ErrWebhookSecretGeneration
+		}
+		subscription.Secret = secret
+	}
+
+	return service.repository.CreateSubscription(ctx, subscription)
+}
+
+// GetSubscription and GetSubscriptions never return the secret, it is only shown once on creation.
+func (service *Service) GetSubscription(ctx context.Context, id uuid.UUID) (*webhook.Subscription, error) {
+	subscription, err := service.repository.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+func (service *Service) GetSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	subscriptions, err := service.repository.GetSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+func (service *Service) Unsubscribe(ctx context.Context, id uuid.UUID) error {
+	return service.repository.DeleteSubscription(ctx, id)
+}
+
+// Publish queues one delivery per subscription interested in the event. Sending happens in Run.
+func (service *Service) Publish(ctx context.Context, eventType webhook.EventType, data interface{}) error {
+	subscriptions, err := service.repository.GetSubscriptionsForEvent(ctx, eventType)
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload, err := newPayload(eventType, time.Now().UTC(), data)
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]*webhook.Delivery, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		deliveries = append(deliveries, &webhook.Delivery{
+			SubscriptionID: subscription.ID,
+			EventType:      eventType,
+			Payload:        payload,
+		})
+	}
+
+	return service.repository.CreateDeliveries(ctx, deliveries)
+}
+
+func (service *Service) GetDeliveries(ctx context.Context, subscriptionId uuid.UUID, filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return nil, apperrors.ErrInvalidDeliveryStatus
+	}
+	if _, err := service.repository.GetSubscription(ctx, subscriptionId); err != nil {
+		return nil, err
+	}
+	return service.repository.GetDeliveries(ctx, subscriptionId, filter)
+}
+
+func (service *Service) GetDelivery(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*webhook.Delivery, error) {
+	return service.repository.GetDelivery(ctx, subscriptionId, id)
+}
+
+// Redeliver puts a delivery back in the queue regardless of its state. A dead delivery gets a fresh
+// retry budget; the attempt history is kept.
+func (service *Service) Redeliver(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*webhook.Delivery, error) {
+	return service.repository.ResetDelivery(ctx, subscriptionId, id)
+}
+
+func newPayload(eventType webhook.EventType, occurredAt time.Time, data interface{}) ([]byte, error) {
+	payload, err := json.Marshal(webhook.Event{ID: uuid.New(), Type: eventType, OccurredAt: occurredAt, Data: data})
+	if err != nil {
+		return nil, apperrors.ErrInternalJsonProcessing
+	}
+	return payload, nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
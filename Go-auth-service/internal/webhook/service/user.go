@@ -0,0 +1,30 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/domain/webhook"
+	"context"
+	"github.com/jmoiron/sqlx"
+)
+
+var userEventTypes = map[user.ChangeType]webhook.EventType{
+	user.ChangeCreated: webhook.EventUserCreated,
+	user.ChangeUpdated: webhook.EventUserUpdated,
+	user.ChangeDeleted: webhook.EventUserDeleted,
+}
+
+// OnUserChange queues webhook deliveries for a user change inside the change's transaction, so that they are
+// stored if and only if the change is. Credentials never leave the service.
+func (service *Service) OnUserChange(ctx context.Context, tx *sqlx.Tx, change user.Change) error {
+	eventType, ok := userEventTypes[change.Type]
+	if !ok {
+		return nil
+	}
+
+	payload, err := newPayload(eventType, change.OccurredAt, change.User.Export())
+	if err != nil {
+		return err
+	}
+
+	return service.repository.QueueDeliveries(ctx, tx, eventType, payload)
+}
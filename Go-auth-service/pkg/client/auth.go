@@ -0,0 +1,36 @@
+package client
+
+import "net/http"
+
+// Authenticator decorates outgoing requests with credentials.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+type APIKey struct {
+	Header string
+	Key    string
+}
+
+func (a APIKey) Authenticate(req *http.Request) error {
+	if a.Key == "" {
+		return errEmptyCredentials
+	}
+
+	header := a.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+	req.Header.Set(header, a.Key)
+	return nil
+}
+
+type BearerToken string
+
+func (t BearerToken) Authenticate(req *http.Request) error {
+	if t == "" {
+		return errEmptyCredentials
+	}
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
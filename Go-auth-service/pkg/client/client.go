@@ -0,0 +1,234 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	jsonContentType = "application/json"
+	apiPrefix       = "/v1"
+
+	defaultTimeout = 10 * time.Second
+	defaultBackoff = 200 * time.Millisecond
+)
+
+// Client is a typed client for the go-auth REST API.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	auth       Authenticator
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+}
+
+type Option func(c *Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout limits every non-streaming call. Streaming calls are bounded by the caller's context only.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries retries idempotent calls on transport errors, 429 and 5xx responses with exponential backoff.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+func WithAuthenticator(auth Authenticator) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+func WithAPIKey(header string, key string) Option {
+	return WithAuthenticator(APIKey{Header: header, Key: key})
+}
+
+func WithBearerToken(token string) Option {
+	return WithAuthenticator(BearerToken(token))
+}
+
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: &http.Client{},
+		timeout:    defaultTimeout,
+		backoff:    defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        interface{}
+	rawBody     io.Reader
+	contentType string
+	accept      string
+	stream      bool
+}
+
+func (c *Client) url(path string, query url.Values) string {
+	u := *c.baseURL
+	u.Path = c.baseURL.Path + apiPrefix + path
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (c *Client) newRequest(ctx context.Context, r request, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if r.rawBody != nil {
+		reader = r.rawBody
+	} else if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, c.url(r.path, r.query), reader)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if r.accept != "" {
+		req.Header.Set("Accept", r.accept)
+	} else {
+		req.Header.Set("Accept", jsonContentType)
+	}
+
+	if c.auth != nil {
+		if err := c.auth.Authenticate(req); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+// do executes the request and returns the response for 2xx statuses. Any other status is decoded into an *Error.
+func (c *Client) do(ctx context.Context, r request) (*http.Response, context.CancelFunc, error) {
+	var body []byte
+	if r.body != nil {
+		encoded, err := json.Marshal(r.body)
+		if err != nil {
+			return nil, nil, err
+		}
+		body = encoded
+		r.contentType = jsonContentType
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if !r.stream && c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	}
+
+	attempts := 1
+	if r.rawBody == nil && isIdempotent(r.method) {
+		attempts += c.retries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff*time.Duration(1<<(attempt-1))); err != nil {
+				cancel()
+				return nil, nil, err
+			}
+		}
+
+		req, err := c.newRequest(ctx, r, body)
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, cancel, nil
+		}
+
+		lastErr = decodeError(resp)
+		_ = resp.Body.Close()
+		if !isRetryableStatus(resp.StatusCode) {
+			break
+		}
+	}
+
+	cancel()
+	return nil, nil, lastErr
+}
+
+func (c *Client) doJSON(ctx context.Context, r request, out interface{}) error {
+	resp, cancel, err := c.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Sentinel errors returned by the API. Use errors.Is to match them.
+var (
+	ErrUserNotFound               = apperrors.ErrUserNotFound
+	ErrAlreadyRegisteredUserEmail = apperrors.ErrAlreadyRegisteredUserEmail
+	ErrInvalidEmailFormat         = apperrors.ErrInvalidEmailFormat
+	ErrInvalidPasswordFormat      = apperrors.ErrInvalidPasswordFormat
+	ErrInvalidRequestFormat       = apperrors.ErrInvalidRequestFormat
+	ErrInvalidRequestBody         = apperrors.ErrInvalidRequestBody
+	ErrInvalidIdFormat            = apperrors.ErrInvalidIdFormat
+	ErrInvalidOffsetFormat        = apperrors.ErrInvalidOffsetFormat
+	ErrInvalidLimitFormat         = apperrors.ErrInvalidLimitFormat
+	ErrInvalidDateFormat          = apperrors.ErrInvalidDateFormat
+	ErrUnsupportedImportFormat    = apperrors.ErrUnsupportedImportFormat
+	ErrInvalidImportRow           = apperrors.ErrInvalidImportRow
+	ErrImportJobNotFound          = apperrors.ErrImportJobNotFound
+	ErrUnsupportedExportFormat    = apperrors.ErrUnsupportedExportFormat
+	ErrRequestValidation          = apperrors.ErrRequestValidation
+)
+
+// ErrExportTruncated is returned by ExportIterator.Err when the server failed after the export started. The
+// export resumes with the date and id of the last user received.
+var ErrExportTruncated = errors.New("export was truncated")
+
+var errEmptyCredentials = errors.New("empty credentials")
+
+var knownErrors = map[string]error{}
+
+func init() {
+	for _, err := range []error{
+		ErrUserNotFound, ErrAlreadyRegisteredUserEmail, ErrInvalidEmailFormat, ErrInvalidPasswordFormat,
+		ErrInvalidRequestFormat, ErrInvalidRequestBody, ErrInvalidIdFormat, ErrInvalidOffsetFormat,
+		ErrInvalidLimitFormat, ErrInvalidDateFormat, ErrUnsupportedImportFormat, ErrInvalidImportRow,
+		ErrImportJobNotFound, ErrUnsupportedExportFormat, ErrRequestValidation,
+	} {
+		knownErrors[err.Error()] = err
+	}
+}
+
+// Error is a non-2xx API response. It unwraps to the matching apperrors value when the message is known.
+type Error struct {
+	StatusCode int
+	Message    string
+	Detail     string
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("auth api: %d %s: %s", e.StatusCode, e.Message, e.Detail)
+	}
+	return fmt.Sprintf("auth api: %d %s", e.StatusCode, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type errorBody struct {
+	Code          int32
+	Message       string
+	DetailMessage string
+}
+
+func decodeError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if err != nil {
+		return apiErr
+	}
+
+	var body errorBody
+	if err := json.Unmarshal(data, &body); err == nil && body.Message != "" {
+		apiErr.Message = body.Message
+		apiErr.Detail = body.DetailMessage
+		apiErr.Err = knownErrors[body.Message]
+	}
+
+	return apiErr
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultPageSize = 100
+
+// UserIterator walks through users page by page:
+//
+//	it := c.Users(100)
+//	for it.Next(ctx) {
+//		u := it.User()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type UserIterator struct {
+	fetch    func(ctx context.Context) ([]User, error)
+	page     []User
+	pos      int
+	current  *User
+	err      error
+	finished bool
+}
+
+// Users iterates over all users ordered by registration date using offset pagination.
+func (c *Client) Users(pageSize int) *UserIterator {
+	pageSize = normalizePageSize(pageSize)
+	offset := 0
+	return &UserIterator{
+		fetch: func(ctx context.Context) ([]User, error) {
+			users, err := c.ListUsers(ctx, offset, pageSize)
+			if err != nil {
+				return nil, err
+			}
+			offset += len(users)
+			if len(users) < pageSize {
+				return users, io.EOF
+			}
+			return users, nil
+		},
+	}
+}
+
+// UsersRegisteredAfter iterates over users registered after date. Pages are fetched after the (createdAt, id)
+// of the last user seen, so users registered at the same time are neither skipped nor repeated.
+func (c *Client) UsersRegisteredAfter(date time.Time, pageSize int) *UserIterator {
+	pageSize = normalizePageSize(pageSize)
+	cursorDate, cursorID := date, uuid.Nil
+	return &UserIterator{
+		fetch: func(ctx context.Context) ([]User, error) {
+			users, err := c.ListUsersAfter(ctx, cursorDate, cursorID, pageSize)
+			if err != nil {
+				return nil, err
+			}
+			if len(users) > 0 {
+				last := users[len(users)-1]
+				cursorDate, cursorID = last.CreatedAt, last.ID
+			}
+			if len(users) < pageSize {
+				return users, io.EOF
+			}
+			return users, nil
+		},
+	}
+}
+
+func normalizePageSize(pageSize int) int {
+	if pageSize <= 0 {
+		return defaultPageSize
+	}
+	return pageSize
+}
+
+func (it *UserIterator) Next(ctx context.Context) bool {
+	for it.pos >= len(it.page) {
+		if it.finished || it.err != nil {
+			return false
+		}
+
+		page, err := it.fetch(ctx)
+		if err == io.EOF {
+			it.finished = true
+		} else if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = page
+		it.pos = 0
+	}
+
+	it.current = &it.page[it.pos]
+	it.pos++
+	return true
+}
+
+func (it *UserIterator) User() *User {
+	return it.current
+}
+
+func (it *UserIterator) Err() error {
+	return it.err
+}
+
+// ExportIterator decodes an NDJSON export stream one user at a time.
+type ExportIterator struct {
+	resp    *http.Response
+	cancel  context.CancelFunc
+	decoder *json.Decoder
+	current *ExportedUser
+	err     error
+}
+
+func newExportIterator(resp *http.Response, cancel context.CancelFunc) *ExportIterator {
+	return &ExportIterator{resp: resp, cancel: cancel, decoder: json.NewDecoder(resp.Body)}
+}
+
+func (it *ExportIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	var u ExportedUser
+	if err := it.decoder.Decode(&u); err != nil {
+		if err != io.EOF {
+			it.err = err
+		} else if it.resp.Trailer.Get("X-Export-Status") == "truncated" {
+			it.err = ErrExportTruncated
+		}
+		return false
+	}
+
+	it.current = &u
+	return true
+}
+
+func (it *ExportIterator) User() *ExportedUser {
+	return it.current
+}
+
+func (it *ExportIterator) Err() error {
+	return it.err
+}
+
+func (it *ExportIterator) Close() error {
+	defer it.cancel()
+	return it.resp.Body.Close()
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// QueryClient is a typed client for the user lookups the auth service serves over NATS request-reply.
+type QueryClient struct {
+	conn    *nats.Conn
+	timeout time.Duration
+}
+
+type QueryOption func(c *QueryClient)
+
+// WithQueryTimeout limits requests whose context has no deadline.
+func WithQueryTimeout(timeout time.Duration) QueryOption {
+	return func(c *QueryClient) {
+		c.timeout = timeout
+	}
+}
+
+func NewQueryClient(conn *nats.Conn, opts ...QueryOption) *QueryClient {
+	c := &QueryClient{conn: conn, timeout: defaultTimeout}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *QueryClient) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	return c.request(ctx, user.SubjectQueryGetById, user.GetByIdQuery{ID: id.String()})
+}
+
+func (c *QueryClient) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	return c.request(ctx, user.SubjectQueryGetByEmail, user.GetByEmailQuery{Email: email})
+}
+
+func (c *QueryClient) request(ctx context.Context, subject string, query interface{}) (*User, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	reply, err := c.conn.RequestWithContext(ctx, subject, data)
+	if err != nil {
+		return nil, err
+	}
+	if code := reply.Header.Get(micro.ErrorCodeHeader); code != "" {
+		return nil, decodeQueryError(code, reply)
+	}
+
+	var u User
+	if err := json.Unmarshal(reply.Data, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// decodeQueryError turns an error reply into an *Error, so both clients report failures the same way.
+func decodeQueryError(code string, reply *nats.Msg) error {
+	apiErr := &Error{Message: reply.Header.Get(micro.ErrorHeader)}
+	apiErr.StatusCode, _ = strconv.Atoi(code)
+
+	var body user.QueryError
+	if err := json.Unmarshal(reply.Data, &body); err == nil && body.Message != "" {
+		apiErr.StatusCode = body.Code
+		apiErr.Message = body.Message
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(apiErr.StatusCode)
+	}
+	apiErr.Err = knownErrors[apiErr.Message]
+
+	return apiErr
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"context"
+	"github.com/google/uuid"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatCSV    = "text/csv"
+	FormatNDJSON = "application/x-ndjson"
+
+	// DateLayout is the layout the API expects for the date query parameter.
+	DateLayout = "2006-01-02 15:04:05.999999"
+)
+
+type (
+	User         = user.ExportedUser
+	ExportedUser = user.ExportedUser
+	ImportReport = user.ImportReport
+	ImportJob    = user.ImportJob
+	ExportFilter = user.ExportFilter
+)
+
+type userInput struct {
+	Email        string `json:"email"`
+	Passwordhash string `json:"passwordhash"`
+}
+
+func (c *Client) CreateUser(ctx context.Context, email string, password string) (*User, error) {
+	var u User
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/user",
+		body:   userInput{Email: email, Passwordhash: password},
+	}, &u)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	var u User
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: "/user/" + id.String()}, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (c *Client) ListUsers(ctx context.Context, offset int, limit int) ([]User, error) {
+	query := url.Values{}
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var users []User
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: "/user", query: query}, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (c *Client) ListUsersRegisteredAfter(ctx context.Context, date time.Time, limit int) ([]User, error) {
+	query := url.Values{}
+	query.Set("date", date.UTC().Format(DateLayout))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var users []User
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: "/user", query: query}, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ListUsersAfter returns the next page of users in (created_at, id) order after the given cursor. Pass the
+// created_at and id of the last user of a page to get the following one; a zero id starts strictly after date.
+func (c *Client) ListUsersAfter(ctx context.Context, date time.Time, afterID uuid.UUID, limit int) ([]User, error) {
+	query := url.Values{}
+	query.Set("date", date.UTC().Format(DateLayout))
+	if afterID != uuid.Nil {
+		query.Set("after_id", afterID.String())
+	}
+	query.Set("limit", strconv.Itoa(limit))
+
+	var users []User
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: "/user", query: query}, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (c *Client) UpdateUser(ctx context.Context, id uuid.UUID, email string, password string) (*User, error) {
+	var u User
+	err := c.doJSON(ctx, request{
+		method: http.MethodPut,
+		path:   "/user/" + id.String(),
+		body:   userInput{Email: email, Passwordhash: password},
+	}, &u)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (c *Client) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return c.doJSON(ctx, request{method: http.MethodDelete, path: "/user/" + id.String()}, nil)
+}
+
+// ImportUsers uploads a CSV or NDJSON stream and waits for the per-row report.
+func (c *Client) ImportUsers(ctx context.Context, format string, body io.Reader) (*ImportReport, error) {
+	var report ImportReport
+	err := c.doJSON(ctx, request{
+		method:      http.MethodPost,
+		path:        "/user/import",
+		rawBody:     body,
+		contentType: format,
+		stream:      true,
+	}, &report)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// StartImport uploads a CSV or NDJSON stream as an asynchronous job. Poll it with GetImportJob.
+func (c *Client) StartImport(ctx context.Context, format string, body io.Reader) (*ImportJob, error) {
+	query := url.Values{}
+	query.Set("async", "true")
+
+	var job ImportJob
+	err := c.doJSON(ctx, request{
+		method:      http.MethodPost,
+		path:        "/user/import",
+		query:       query,
+		rawBody:     body,
+		contentType: format,
+		stream:      true,
+	}, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (c *Client) GetImportJob(ctx context.Context, id uuid.UUID) (*ImportJob, error) {
+	var job ImportJob
+	if err := c.doJSON(ctx, request{method: http.MethodGet, path: "/user/import/" + id.String()}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ExportUsers opens an NDJSON export stream. The returned iterator must be closed.
+func (c *Client) ExportUsers(ctx context.Context, filter ExportFilter) (*ExportIterator, error) {
+	query := url.Values{}
+	if filter.RegisteredAfter != "" {
+		query.Set("date", filter.RegisteredAfter)
+	}
+	if filter.AfterID != uuid.Nil {
+		query.Set("after_id", filter.AfterID.String())
+	}
+	if filter.Offset > 0 {
+		query.Set("offset", strconv.Itoa(filter.Offset))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	resp, cancel, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/user/export",
+		query:  query,
+		accept: FormatNDJSON,
+		stream: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newExportIterator(resp, cancel), nil
+}
@@ -0,0 +1,78 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	SpecVersion     = "1.0"
+	jsonContentType = "application/json"
+)
+
+var ErrNotCloudEvent = errors.New("message is not a structured CloudEvent")
+var ErrInvalidEvent = errors.New("invalid CloudEvent")
+
+// Event is a CloudEvents 1.0 event in the structured JSON format.
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func New(source string, eventType string, dataSchema string, data interface{}) (*Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		SpecVersion:     SpecVersion,
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            eventType,
+		Time:            time.Now().UTC(),
+		DataContentType: jsonContentType,
+		DataSchema:      dataSchema,
+		Data:            raw,
+	}, nil
+}
+
+// Parse decodes a structured event. Messages without specversion return ErrNotCloudEvent, so that
+// consumers can fall back to the payloads published before the envelope was introduced.
+func Parse(message []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(message, &event); err != nil {
+		return nil, ErrNotCloudEvent
+	}
+	if event.SpecVersion == "" {
+		return nil, ErrNotCloudEvent
+	}
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+func (e *Event) Validate() error {
+	if e.SpecVersion != SpecVersion || e.ID == "" || e.Source == "" || e.Type == "" {
+		return ErrInvalidEvent
+	}
+	if e.DataContentType != "" && e.DataContentType != jsonContentType {
+		return ErrInvalidEvent
+	}
+	return nil
+}
+
+func (e *Event) DecodeData(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
@@ -0,0 +1,161 @@
+package cloudevents
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+const schemaPrefix = "urn:go-practice-2023:events:"
+
+var ErrUnknownSchema = errors.New("unknown event schema")
+var ErrSchemaValidation = errors.New("event data does not match its schema")
+
+// SchemaURI is the dataschema of the given event type and version.
+func SchemaURI(eventType string, version int) string {
+	return fmt.Sprintf("%s%s:v%d", schemaPrefix, eventType, version)
+}
+
+func parseSchemaURI(uri string) (string, int, error) {
+	rest := strings.TrimPrefix(uri, schemaPrefix)
+	sep := strings.LastIndex(rest, ":v")
+	if rest == uri || sep == -1 {
+		return "", 0, ErrUnknownSchema
+	}
+	version, err := strconv.Atoi(rest[sep+2:])
+	if err != nil {
+		return "", 0, ErrUnknownSchema
+	}
+	return rest[:sep], version, nil
+}
+
+// Upcaster converts the data of one version of an event type to the next version.
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+type Registry struct {
+	schemas   map[string]*jsonschema.Schema
+	latest    map[string]int
+	upcasters map[string]Upcaster
+}
+
+// NewRegistry compiles every <type>.v<version>.json schema in schemas.
+func NewRegistry(schemas fs.FS) (*Registry, error) {
+	r := &Registry{
+		schemas:   make(map[string]*jsonschema.Schema),
+		latest:    make(map[string]int),
+		upcasters: make(map[string]Upcaster),
+	}
+
+	files, err := fs.Glob(schemas, "*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	for _, file := range files {
+		content, err := fs.ReadFile(schemas, file)
+		if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimSuffix(file, ".json")
+		sep := strings.LastIndex(name, ".v")
+		if sep == -1 {
+			return nil, fmt.Errorf("schema %s is not named <type>.v<version>.json", file)
+		}
+		eventType := name[:sep]
+		version, err := strconv.Atoi(name[sep+2:])
+		if err != nil {
+			return nil, fmt.Errorf("schema %s is not named <type>.v<version>.json", file)
+		}
+
+		uri := SchemaURI(eventType, version)
+		if err := compiler.AddResource(uri, bytes.NewReader(content)); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", file, err)
+		}
+		schema, err := compiler.Compile(uri)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", file, err)
+		}
+
+		r.schemas[uri] = schema
+		if version > r.latest[eventType] {
+			r.latest[eventType] = version
+		}
+	}
+
+	return r, nil
+}
+
+// Latest returns the dataschema that new events of the type are published with.
+func (r *Registry) Latest(eventType string) (string, error) {
+	version, ok := r.latest[eventType]
+	if !ok {
+		return "", ErrUnknownSchema
+	}
+	return SchemaURI(eventType, version), nil
+}
+
+// RegisterUpcaster registers the conversion from fromVersion to fromVersion+1.
+func (r *Registry) RegisterUpcaster(eventType string, fromVersion int, upcaster Upcaster) {
+	r.upcasters[SchemaURI(eventType, fromVersion)] = upcaster
+}
+
+func (r *Registry) Validate(event *Event) error {
+	schema, ok := r.schemas[event.DataSchema]
+	if !ok {
+		return ErrUnknownSchema
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return ErrSchemaValidation
+	}
+	if err := schema.Validate(data); err != nil {
+		return fmt.Errorf("%w: %s", ErrSchemaValidation, err.Error())
+	}
+
+	return nil
+}
+
+// Upcast validates the event against its own schema and converts its data to the latest known version.
+func (r *Registry) Upcast(event *Event) (*Event, error) {
+	if err := r.Validate(event); err != nil {
+		return nil, err
+	}
+
+	eventType, version, err := parseSchemaURI(event.DataSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	upcasted := *event
+	for version < r.latest[eventType] {
+		upcaster, ok := r.upcasters[upcasted.DataSchema]
+		if !ok {
+			return nil, fmt.Errorf("no upcaster from %s", upcasted.DataSchema)
+		}
+
+		data, err := upcaster(upcasted.Data)
+		if err != nil {
+			return nil, err
+		}
+		version++
+		upcasted.Data = data
+		upcasted.DataSchema = SchemaURI(eventType, version)
+	}
+
+	if upcasted.DataSchema != event.DataSchema {
+		if err := r.Validate(&upcasted); err != nil {
+			return nil, err
+		}
+	}
+
+	return &upcasted, nil
+}
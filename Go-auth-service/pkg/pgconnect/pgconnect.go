@@ -16,14 +16,14 @@ type ConnectionConfigData struct {
 	Host         string
 }
 
-func buildConnectionString(configData ConnectionConfigData) string {
+func ConnectionString(configData ConnectionConfigData) string {
 	connectionTemplate := "host=%s port=%d user=%s password=%s dbname=%s sslmode=disable"
 	return fmt.Sprintf(connectionTemplate, configData.Host, configData.Port, configData.Username, configData.Password,
 		configData.DatabaseName)
 }
 
 func ConnectDatabase(configData ConnectionConfigData) (*sqlx.DB, error) {
-	db, err := sqlx.Open("postgres", buildConnectionString(configData))
+	db, err := sqlx.Open("postgres", ConnectionString(configData))
 
 	if err != nil {
 		log.Fatal("Error connecting to database:", err)
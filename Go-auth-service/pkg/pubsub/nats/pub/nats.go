@@ -2,31 +2,68 @@ package pub
 
 import (
 	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"Golang-practice-2023/pkg/pubsub/nats/stream"
+	"fmt"
 	"github.com/nats-io/nats.go"
 )
 
+// NatsPublisher publishes to a JetStream stream. Messages with an ID carry it as Nats-Msg-Id, so a
+// message published again within the duplicate window of the stream is stored once.
 type NatsPublisher struct {
 	Conn   *nats.Conn
+	js     nats.JetStreamContext
 	logger logger.Logger
 }
 
-func New(natsURL string, logger logger.Logger) (*NatsPublisher, error) {
+func New(natsURL string, streamConfig stream.Config, logger logger.Logger) (*NatsPublisher, error) {
 	conn, err := nats.Connect(natsURL)
 	if err != nil {
 		return nil, err
 	}
 
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := stream.Ensure(js, streamConfig); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	return &NatsPublisher{
 		Conn:   conn,
+		js:     js,
 		logger: logger,
 	}, nil
 }
 
-func (p *NatsPublisher) Publish(topic string, data []byte) error {
-	err := p.Conn.Publish(topic, data)
+func (p *NatsPublisher) Publish(msg *pubsub.Message) error {
+	natsMsg := nats.NewMsg(msg.Subject)
+	natsMsg.Data = msg.Data
+	for key, values := range msg.Headers {
+		for _, value := range values {
+			natsMsg.Header.Add(key, value)
+		}
+	}
+
+	opts := make([]nats.PubOpt, 0, 1)
+	if msg.ID != "" {
+		opts = append(opts, nats.MsgId(msg.ID))
+	}
+
+	ack, err := p.js.PublishMsg(natsMsg, opts...)
 	if err != nil {
 		return err
 	}
+	if ack.Duplicate {
+		p.logger.Debug(fmt.Sprintf("Message %s on %s was already stored in %s", msg.ID, msg.Subject, ack.Stream))
+	}
 
 	return nil
 }
+
+func (p *NatsPublisher) Close() error {
+	return p.Conn.Drain()
+}
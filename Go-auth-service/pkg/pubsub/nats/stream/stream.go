@@ -0,0 +1,79 @@
+package stream
+
+import (
+	"errors"
+	"github.com/nats-io/nats.go"
+	"time"
+)
+
+// Config describes the JetStream stream both services declare on start. Declaring is idempotent: an
+// existing stream is only updated when its settings differ.
+type Config struct {
+	Name     string
+	Subjects []string
+	MaxAge   time.Duration
+	MaxBytes int64
+	MaxMsgs  int64
+	// DuplicateWindow is how long the server remembers Nats-Msg-Id headers to drop republished messages.
+	DuplicateWindow time.Duration
+	Replicas        int
+}
+
+func DefaultUsersConfig() Config {
+	return Config{
+		Name:            "USERS",
+		Subjects:        []string{"users.>", "NewUser"},
+		MaxAge:          7 * 24 * time.Hour,
+		MaxBytes:        1 << 30,
+		MaxMsgs:         -1,
+		DuplicateWindow: 2 * time.Minute,
+		Replicas:        1,
+	}
+}
+
+func Ensure(js nats.JetStreamContext, config Config) (*nats.StreamInfo, error) {
+	streamConfig := &nats.StreamConfig{
+		Name:       config.Name,
+		Subjects:   config.Subjects,
+		Retention:  nats.LimitsPolicy,
+		Discard:    nats.DiscardOld,
+		MaxAge:     config.MaxAge,
+		MaxBytes:   config.MaxBytes,
+		MaxMsgs:    config.MaxMsgs,
+		Duplicates: config.DuplicateWindow,
+		Storage:    nats.FileStorage,
+		Replicas:   config.Replicas,
+	}
+
+	info, err := js.StreamInfo(config.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		return js.AddStream(streamConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The storage type of an existing stream cannot be changed, keep what was declared first.
+	streamConfig.Storage = info.Config.Storage
+	if sameConfig(&info.Config, streamConfig) {
+		return info, nil
+	}
+	return js.UpdateStream(streamConfig)
+}
+
+func sameConfig(current *nats.StreamConfig, wanted *nats.StreamConfig) bool {
+	if len(current.Subjects) != len(wanted.Subjects) {
+		return false
+	}
+	for i := range current.Subjects {
+		if current.Subjects[i] != wanted.Subjects[i] {
+			return false
+		}
+	}
+	return current.Retention == wanted.Retention &&
+		current.Discard == wanted.Discard &&
+		current.MaxAge == wanted.MaxAge &&
+		current.MaxBytes == wanted.MaxBytes &&
+		current.MaxMsgs == wanted.MaxMsgs &&
+		current.Duplicates == wanted.Duplicates &&
+		current.Replicas == wanted.Replicas
+}
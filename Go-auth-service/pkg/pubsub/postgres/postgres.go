@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/pubsub"
+	subjects "Golang-practice-2023/pkg/pubsub/subject"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"sync"
+	"time"
+)
+
+// maxPayloadSize is the NOTIFY payload limit of a default Postgres build, minus a little headroom.
+const maxPayloadSize = 7900
+
+const DefaultChannel = "events"
+
+var ErrPayloadTooLarge = errors.New("message does not fit into a NOTIFY payload")
+
+// envelope carries the subject next to the data, as every message of the bus shares one channel.
+type envelope struct {
+	ID      string              `json:"id,omitempty"`
+	Subject string              `json:"subject"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Data    []byte              `json:"data"`
+}
+
+// Publisher sends messages with pg_notify. Postgres does not queue notifications for listeners that are
+// not connected, so delivery is at most once and message IDs are not deduplicated.
+type Publisher struct {
+	db      *sqlx.DB
+	channel string
+}
+
+func NewPublisher(db *sqlx.DB, channel string) *Publisher {
+	return &Publisher{db: db, channel: channel}
+}
+
+func (p *Publisher) Publish(msg *pubsub.Message) error {
+	payload, err := json.Marshal(envelope{ID: msg.ID, Subject: msg.Subject, Headers: msg.Headers, Data: msg.Data})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayloadSize {
+		return ErrPayloadTooLarge
+	}
+
+	_, err = p.db.Exec("SELECT pg_notify($1, $2)", p.channel, string(payload))
+	return err
+}
+
+// Close leaves the database open, it is owned by the caller.
+func (p *Publisher) Close() error {
+	return nil
+}
+
+// Subscriber listens on one channel over a dedicated connection and dispatches notifications to the
+// subscriptions whose subject pattern matches. Every listening process receives every notification, so
+// replicas of a service each handle all the messages.
+type Subscriber struct {
+	listener *pq.Listener
+	channel  string
+	logger   logger.Logger
+
+	mu            sync.RWMutex
+	subscriptions map[*subscription]struct{}
+	done          chan struct{}
+}
+
+type subscription struct {
+	subscriber *Subscriber
+	pattern    string
+	handler    pubsub.Handler
+}
+
+func NewSubscriber(connectionString string, channel string, logger logger.Logger) (*Subscriber, error) {
+	listener := pq.NewListener(connectionString, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warning(fmt.Sprintf("Postgres event bus listener: %s", err.Error()))
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	s := &Subscriber{
+		listener:      listener,
+		channel:       channel,
+		logger:        logger,
+		subscriptions: make(map[*subscription]struct{}),
+		done:          make(chan struct{}),
+	}
+	go s.run()
+
+	return s, nil
+}
+
+func (s *Subscriber) run() {
+	defer close(s.done)
+
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+
+	for {
+		select {
+		case notification, ok := <-s.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification means the connection was re-established; anything sent meanwhile is lost.
+			if notification == nil {
+				s.logger.Warning("Postgres event bus reconnected, notifications may have been missed")
+				continue
+			}
+			s.dispatch(notification.Extra)
+		case <-ping.C:
+			go func() {
+				_ = s.listener.Ping()
+			}()
+		}
+	}
+}
+
+func (s *Subscriber) dispatch(payload string) {
+	var message envelope
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		s.logger.Warning(fmt.Sprintf("Dropping malformed notification on %s: %s", s.channel, err.Error()))
+		return
+	}
+
+	s.mu.RLock()
+	handlers := make([]pubsub.Handler, 0)
+	for sub := range s.subscriptions {
+		if subjects.Match(sub.pattern, message.Subject) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, handler := range handlers {
+		msg := &pubsub.Message{ID: message.ID, Subject: message.Subject, Headers: message.Headers, Data: message.Data,
+			Attempt: 1, LastAttempt: true}
+		if err := handler(msg); err != nil {
+			s.logger.Warning(fmt.Sprintf("Failed to handle %s notification: %s", message.Subject, err.Error()))
+		}
+	}
+}
+
+func (s *Subscriber) Subscribe(subject string, handler pubsub.Handler) (pubsub.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := &subscription{subscriber: s, pattern: subject, handler: handler}
+	s.subscriptions[sub] = struct{}{}
+	return sub, nil
+}
+
+func (s *Subscriber) Close() error {
+	err := s.listener.Close()
+	<-s.done
+	return err
+}
+
+func (sub *subscription) Unsubscribe() error {
+	sub.subscriber.mu.Lock()
+	defer sub.subscriber.mu.Unlock()
+	delete(sub.subscriber.subscriptions, sub)
+	return nil
+}
@@ -0,0 +1,34 @@
+CREATE TABLE webhook_subscription (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    url text NOT NULL,
+    eventTypes text[] NOT NULL,
+    secret varchar(64) NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
+
+CREATE TABLE webhook_delivery (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscriptionId uuid NOT NULL REFERENCES webhook_subscription (id) ON DELETE CASCADE,
+    eventType varchar(64) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    nextAttemptAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    lastStatusCode integer,
+    lastError text NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    updatedAt TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX webhook_delivery_due_idx ON webhook_delivery (nextAttemptAt) WHERE status = 'pending';
+CREATE INDEX webhook_delivery_subscription_idx ON webhook_delivery (subscriptionId, createdAt);
+
+CREATE TABLE webhook_delivery_attempt (
+    id bigserial PRIMARY KEY,
+    deliveryId uuid NOT NULL REFERENCES webhook_delivery (id) ON DELETE CASCADE,
+    attempt integer NOT NULL,
+    statusCode integer,
+    error text NOT NULL DEFAULT '',
+    durationMs bigint NOT NULL,
+    attemptedAt TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
@@ -0,0 +1,12 @@
+CREATE TABLE outbox (
+    id bigserial PRIMARY KEY,
+    subject varchar(255) NOT NULL,
+    payload bytea NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    lastError text NOT NULL DEFAULT '',
+    nextAttemptAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    createdAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    sentAt TIMESTAMP
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (nextAttemptAt, id) WHERE sentAt IS NULL;
@@ -0,0 +1,20 @@
+CREATE TABLE backfill (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subject varchar(255) NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'running',
+    createdAfter TIMESTAMP,
+    createdBefore TIMESTAMP,
+    fromId uuid,
+    toId uuid,
+    ratePerSecond integer NOT NULL,
+    total bigint NOT NULL DEFAULT 0,
+    published bigint NOT NULL DEFAULT 0,
+    cursorId uuid,
+    lastError text NOT NULL DEFAULT '',
+    leaseUntil TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    createdAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    updatedAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    finishedAt TIMESTAMP
+);
+
+CREATE INDEX backfill_due_idx ON backfill (leaseUntil) WHERE status = 'running';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS account_createdat_id_idx;
@@ -0,0 +1,2 @@
+-- Keyset pages of GET /v1/user?date=&after_id= walk account in (createdAt, id) order.
+CREATE INDEX IF NOT EXISTS account_createdat_id_idx ON account (createdAt, id);
@@ -0,0 +1,11 @@
+CREATE TABLE import_job (
+    id uuid PRIMARY KEY,
+    status varchar(16) NOT NULL,
+    error text NOT NULL DEFAULT '',
+    report jsonb,
+    createdAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    updatedAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    finishedAt TIMESTAMP
+);
+
+CREATE INDEX import_job_updated_idx ON import_job (updatedAt);
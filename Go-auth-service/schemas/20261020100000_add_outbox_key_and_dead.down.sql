@@ -0,0 +1,6 @@
+DROP INDEX outbox_pending_key_idx;
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (nextAttemptAt, id) WHERE sentAt IS NULL;
+
+ALTER TABLE outbox DROP COLUMN deadAt;
+ALTER TABLE outbox DROP COLUMN messageKey;
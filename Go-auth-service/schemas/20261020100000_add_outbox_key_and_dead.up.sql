@@ -0,0 +1,7 @@
+-- Messages are ordered per key (the user id) only, and a message that keeps failing is set aside as dead.
+ALTER TABLE outbox ADD COLUMN messageKey varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE outbox ADD COLUMN deadAt TIMESTAMP;
+
+DROP INDEX outbox_pending_idx;
+CREATE INDEX outbox_pending_idx ON outbox (nextAttemptAt, id) WHERE sentAt IS NULL AND deadAt IS NULL;
+CREATE INDEX outbox_pending_key_idx ON outbox (messageKey, id) WHERE sentAt IS NULL AND deadAt IS NULL;
@@ -1,18 +1,21 @@
 package tests
 
 import (
+	"Golang-practice-2023/api"
 	"Golang-practice-2023/internal/domain/user"
 	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/internal/transport/rest/middleware"
+	"Golang-practice-2023/internal/user/repository"
 	"Golang-practice-2023/pkg/logger"
-	"Golang-practice-2023/pkg/pubsub/nats/pub"
 	"Golang-practice-2023/tests/data"
 	"Golang-practice-2023/tests/data/provider"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/nats-io/nats.go"
+	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -38,14 +41,16 @@ func TestApp(t *testing.T) {
 
 	userDataProvider, _ := NewUserDataProvider()
 
-	publisher, err := pub.New(nats.DefaultURL, myLogger)
-	if err != nil {
-		myLogger.Warning(err.Error())
-	}
-	userService, err := NewUserService(userRepository, myLogger, publisher)
+	userService, err := NewUserService(userRepository, myLogger)
+
+	spec, err := api.Load()
+	require.NoError(t, err)
+	specValidator, err := middleware.OpenAPIValidator(spec, myLogger, "/")
+	require.NoError(t, err)
 
 	userHandler := handler.New(userService, myLogger)
 	router := mux.NewRouter()
+	router.Use(specValidator)
 	userHandler.InitRoutes(router)
 	port := os.Getenv("PORT")
 	err = http.ListenAndServe(":"+port, router)
@@ -59,6 +64,9 @@ func TestApp(t *testing.T) {
 	t.Run("handler tests", func(t *testing.T) {
 		RunHandlerTests(router, userHandler, userService, userDataProvider, t)
 	})
+	t.Run("change listener tests", func(t *testing.T) {
+		RunChangeListenerTests(userRepository, t)
+	})
 
 	t.Cleanup(func() {
 
@@ -70,7 +78,7 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 		ctx := context.Background()
 
 		testUser := data.TestUser1()
-		err := repo.Create(ctx, testUser)
+		err := repo.Create(ctx, testUser, nil)
 		require.NoError(t, err)
 
 		query := "SELECT id, email, passwordhash FROM account WHERE id=$1"
@@ -81,13 +89,13 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 		assert.Equal(t, testUser.Email, returnedUser.Email)
 		assert.Equal(t, testUser.Passwordhash, returnedUser.Passwordhash)
 
-		repo.Delete(ctx, testUser.ID) // todo refactor
+		repo.Delete(ctx, testUser.ID, nil) // todo refactor
 	})
 	t.Run("get-by-id", func(t *testing.T) {
 		ctx := context.Background()
 
 		testUser := data.TestUser1()
-		err := repo.Create(ctx, testUser)
+		err := repo.Create(ctx, testUser, nil)
 
 		returnedUser, err := repo.GetById(ctx, testUser.ID)
 
@@ -95,7 +103,7 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 		assert.Equal(t, testUser.Email, returnedUser.Email)
 		assert.Equal(t, testUser.Passwordhash, returnedUser.Passwordhash)
 
-		repo.Delete(ctx, testUser.ID) // todo refactor
+		repo.Delete(ctx, testUser.ID, nil) // todo refactor
 	})
 	t.Run("get-by-id-with-invalid-id", func(t *testing.T) {
 		ctx := context.Background()
@@ -109,27 +117,51 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 		ctx := context.Background()
 
 		testUser := data.TestUser1()
-		_ = repo.Create(ctx, testUser)
+		_ = repo.Create(ctx, testUser, nil)
 
 		testUser2 := data.TestUser2()
 		testUser.Email = testUser2.Email
 		testUser.Passwordhash = testUser2.Passwordhash
 
-		repo.Update(ctx, testUser)
+		repo.Update(ctx, testUser, nil)
 
 		updatedTestUser, _ := repo.GetById(ctx, testUser.ID)
 		assert.Equal(t, testUser2.Email, updatedTestUser.Email)
 		assert.Equal(t, testUser2.Passwordhash, updatedTestUser.Passwordhash)
 
-		repo.Delete(ctx, testUser.ID)
+		repo.Delete(ctx, testUser.ID, nil)
+	})
+	t.Run("get-registered-after-cursor", func(t *testing.T) {
+		ctx := context.Background()
+
+		testUser := data.TestUser1()
+		testUser2 := data.TestUser2()
+		require.NoError(t, repo.Create(ctx, testUser, nil))
+		require.NoError(t, repo.Create(ctx, testUser2, nil))
+		defer repo.Delete(ctx, testUser.ID, nil)
+		defer repo.Delete(ctx, testUser2.ID, nil)
+
+		// Users sharing a timestamp are told apart by their id, so neither is skipped between pages.
+		_, err := repo.GetDbInstance().ExecContext(ctx, "UPDATE account SET createdAt='2001-01-01 00:00:00' WHERE id IN ($1, $2)",
+			testUser.ID, testUser2.ID)
+		require.NoError(t, err)
+
+		first, err := repo.GetRegisteredLaterThen(ctx, "2000-12-31 00:00:00", uuid.Nil, 1)
+		require.NoError(t, err)
+		require.Len(t, *first, 1)
+		second, err := repo.GetRegisteredLaterThen(ctx, "2001-01-01 00:00:00", (*first)[0].ID, 1)
+		require.NoError(t, err)
+		require.Len(t, *second, 1)
+
+		assert.ElementsMatch(t, []uuid.UUID{testUser.ID, testUser2.ID}, []uuid.UUID{(*first)[0].ID, (*second)[0].ID})
 	})
 	t.Run("delete-user", func(t *testing.T) {
 		ctx := context.Background()
 
 		testUser := data.TestUser1WithId()
-		_ = repo.Create(ctx, testUser)
+		_ = repo.Create(ctx, testUser, nil)
 
-		_ = repo.Delete(ctx, testUser.ID)
+		_ = repo.Delete(ctx, testUser.ID, nil)
 
 		returnedUser, _ := repo.GetById(ctx, testUser.ID)
 
@@ -137,6 +169,43 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 	})
 }
 
+// RunChangeListenerTests registers listeners for good, so it runs after the other tests.
+func RunChangeListenerTests(repo *repository.Repository, t *testing.T) {
+	var changes []user.Change
+	refused := errors.New("refused")
+	repo.OnChange(func(ctx context.Context, tx *sqlx.Tx, change user.Change) error {
+		if change.User.Email == data.TestUser2().Email {
+			return refused
+		}
+		changes = append(changes, change)
+		return nil
+	})
+
+	t.Run("call-listeners-with-the-change", func(t *testing.T) {
+		ctx := context.Background()
+		changes = nil
+
+		testUser := data.TestUser1()
+		require.NoError(t, repo.Create(ctx, testUser, nil))
+		require.NoError(t, repo.Delete(ctx, testUser.ID, nil))
+
+		require.Len(t, changes, 2)
+		assert.Equal(t, user.ChangeCreated, changes[0].Type)
+		assert.Equal(t, testUser.ID, changes[0].User.ID)
+		assert.Equal(t, user.ChangeDeleted, changes[1].Type)
+		assert.Equal(t, testUser.Email, changes[1].User.Email, "the deleted user is passed in full")
+	})
+	t.Run("roll-back-change-when-listener-fails", func(t *testing.T) {
+		ctx := context.Background()
+
+		testUser := data.TestUser2()
+		assert.ErrorIs(t, repo.Create(ctx, testUser, nil), refused)
+
+		returnedUser, _ := repo.GetByEmail(ctx, testUser.Email)
+		assert.Nil(t, returnedUser)
+	})
+}
+
 func RunServiceTests(service user.Service, provider *provider.UserDataProvider, t *testing.T) {
 	t.Run("create-user", func(t *testing.T) {
 		ctx := context.Background()
@@ -372,6 +441,76 @@ func RunHandlerTests(router *mux.Router, userHandler *handler.UserHandler, servi
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
+	t.Run("import-users", func(t *testing.T) {
+		ctx := context.Background()
+
+		valid := dataProvider.GenerateUserData(false, false)
+		invalid := dataProvider.GenerateUserData(false, false)
+		invalid.Email = "testusergmail"
+
+		var body bytes.Buffer
+		for _, u := range []*user.User{valid, invalid} {
+			line, _ := json.Marshal(map[string]string{"email": u.Email, "password": u.Passwordhash})
+			body.Write(line)
+			body.WriteString("\n")
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, "/user/import", &body)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var report user.ImportReport
+		err := json.NewDecoder(rr.Body).Decode(&report)
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, 2, report.Total)
+		assert.Equal(t, 1, report.Succeeded)
+		assert.Equal(t, 1, report.Failed)
+		require.NotNil(t, report.Rows[0].ID)
+		assert.NotEmpty(t, report.Rows[1].Error)
+
+		service.Delete(ctx, *report.Rows[0].ID)
+	})
+	t.Run("import-users-with-unsupported-content-type", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/user/import", bytes.NewBufferString("{}"))
+		req.Header.Set("Content-Type", contentType)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("export-users", func(t *testing.T) {
+		ctx := context.Background()
+
+		testUser := dataProvider.GenerateUserData(false, false)
+		_ = service.Create(ctx, testUser)
+
+		req, _ := http.NewRequest(http.MethodGet, "/user/export", nil)
+		req.Header.Set("Accept", "application/x-ndjson")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), testUser.ID.String())
+		assert.NotContains(t, rr.Body.String(), "passwordhash")
+		assert.NotContains(t, rr.Body.String(), testUser.Passwordhash)
+
+		service.Delete(ctx, testUser.ID)
+	})
+	t.Run("export-users-with-unsupported-accept", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/user/export", nil)
+		req.Header.Set("Accept", "application/xml")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNotAcceptable, rr.Code)
+	})
 	t.Run("delete-user-by-not-existing-id", func(t *testing.T) {
 		req, _ := http.NewRequest(http.MethodDelete, "/user/"+uuid.New().String(), nil)
 
@@ -0,0 +1,400 @@
+package tests
+
+import (
+	"Golang-practice-2023/api"
+	backfillService "Golang-practice-2023/internal/backfill/service"
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/backfill"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/internal/transport/rest/middleware"
+	"Golang-practice-2023/pkg/cloudevents"
+	"Golang-practice-2023/pkg/logger"
+	"Golang-practice-2023/pkg/pubsub/memory"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	config := backfillService.DefaultConfig()
+	config.BatchSize = 2
+
+	t.Run("publish-users-in-id-order-and-finish", func(t *testing.T) {
+		repository := newFakeBackfillRepository(5)
+		bus, replayed := newReplayBus(t, config.Subject)
+		service := backfillService.New(repository, bus, schemas, config, myLogger)
+
+		job := &backfill.Job{RatePerSecond: 1000}
+		require.NoError(t, service.Start(context.Background(), job))
+		assert.Equal(t, config.Subject, job.Subject)
+		assert.Equal(t, int64(5), job.Total)
+
+		drainBackfill(t, service)
+
+		messages := replayed()
+		require.Len(t, messages, 5)
+		for i, msg := range messages {
+			ce, err := cloudevents.Parse(msg.Data)
+			require.NoError(t, err)
+			assert.Equal(t, event.SubjectUserCreated, ce.Type)
+			assert.Equal(t, repository.users[i].ID.String(), ce.Subject)
+			assert.Equal(t, ce.ID, msg.ID)
+			assert.Equal(t, []string{job.ID.String()}, msg.Headers[backfillService.JobHeader])
+			require.NoError(t, schemas.Validate(ce))
+		}
+
+		finished, err := service.Get(context.Background(), job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, backfill.StatusFinished, finished.Status)
+		assert.Equal(t, int64(5), finished.Published)
+		assert.Equal(t, 1.0, finished.Progress)
+	})
+	t.Run("publish-range-only", func(t *testing.T) {
+		repository := newFakeBackfillRepository(6)
+		bus, replayed := newReplayBus(t, config.Subject)
+		service := backfillService.New(repository, bus, schemas, config, myLogger)
+
+		from, to := repository.users[1].ID, repository.users[3].ID
+		createdAfter := repository.users[1].CreatedAt
+		require.NoError(t, service.Start(context.Background(), &backfill.Job{
+			FromID: &from, ToID: &to, CreatedAfter: &createdAfter, RatePerSecond: 1000,
+		}))
+		drainBackfill(t, service)
+
+		messages := replayed()
+		require.Len(t, messages, 2, "the id range holds users 1 to 3, user 1 is not created after itself")
+		assert.Equal(t, repository.users[2].ID.String(), replayedUserID(t, messages[0]))
+		assert.Equal(t, repository.users[3].ID.String(), replayedUserID(t, messages[1]))
+	})
+	t.Run("resume-after-pause", func(t *testing.T) {
+		repository := newFakeBackfillRepository(5)
+		bus, replayed := newReplayBus(t, config.Subject)
+		service := backfillService.New(repository, bus, schemas, config, myLogger)
+
+		job := &backfill.Job{RatePerSecond: 1000}
+		require.NoError(t, service.Start(context.Background(), job))
+		published, err := service.PublishBatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 2, published)
+
+		paused, err := service.Pause(context.Background(), job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, backfill.StatusPaused, paused.Status)
+		assert.Equal(t, 0.4, paused.Progress)
+		published, err = service.PublishBatch(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, published, "a paused job is not run")
+
+		_, err = service.Pause(context.Background(), job.ID)
+		assert.ErrorIs(t, err, apperrors.ErrBackfillStateConflict)
+
+		_, err = service.Resume(context.Background(), job.ID)
+		require.NoError(t, err)
+		drainBackfill(t, service)
+
+		ids := make([]string, 0)
+		for _, msg := range replayed() {
+			ids = append(ids, replayedUserID(t, msg))
+		}
+		require.Len(t, ids, 5, "every user is published once")
+		assert.True(t, sort.StringsAreSorted(ids))
+	})
+	t.Run("keep-cursor-on-publish-failure", func(t *testing.T) {
+		repository := newFakeBackfillRepository(3)
+		publisher := &fakePublisher{err: errors.New("nats: connection closed")}
+		service := backfillService.New(repository, publisher, schemas, config, myLogger)
+
+		job := &backfill.Job{RatePerSecond: 1000}
+		require.NoError(t, service.Start(context.Background(), job))
+		published, err := service.PublishBatch(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, published)
+
+		failed, _ := service.Get(context.Background(), job.ID)
+		assert.Equal(t, backfill.StatusRunning, failed.Status)
+		assert.Equal(t, "nats: connection closed", failed.LastError)
+		assert.Nil(t, failed.Cursor)
+
+		publisher.SetErr(nil)
+		repository.ExpireLeases()
+		drainBackfill(t, service)
+		assert.Len(t, publisher.Published(), 3)
+	})
+	t.Run("limit-rate", func(t *testing.T) {
+		repository := newFakeBackfillRepository(5)
+		bus, replayed := newReplayBus(t, config.Subject)
+		rateConfig := config
+		rateConfig.BatchSize = 10
+		service := backfillService.New(repository, bus, schemas, rateConfig, myLogger)
+
+		require.NoError(t, service.Start(context.Background(), &backfill.Job{RatePerSecond: 50}))
+		started := time.Now()
+		published, err := service.PublishBatch(context.Background())
+		require.NoError(t, err)
+
+		assert.Equal(t, 5, published)
+		assert.Len(t, replayed(), 5)
+		assert.GreaterOrEqual(t, time.Since(started), 90*time.Millisecond)
+	})
+	t.Run("reject-invalid-jobs", func(t *testing.T) {
+		service := backfillService.New(newFakeBackfillRepository(0), memory.New(), schemas, config, myLogger)
+		after := time.Now()
+		before := after.Add(-time.Hour)
+		from, to := uuid.MustParse("ffffffff-0000-4000-8000-000000000000"), uuid.MustParse("00000000-0000-4000-8000-000000000000")
+
+		for name, tc := range map[string]struct {
+			job *backfill.Job
+			err error
+		}{
+			"live-subject":  {&backfill.Job{Subject: event.SubjectUserCreated}, apperrors.ErrInvalidBackfillSubject},
+			"wildcard":      {&backfill.Job{Subject: "users.>"}, apperrors.ErrInvalidBackfillSubject},
+			"empty-token":   {&backfill.Job{Subject: "users..replay"}, apperrors.ErrInvalidBackfillSubject},
+			"inverted-time": {&backfill.Job{CreatedAfter: &after, CreatedBefore: &before}, apperrors.ErrInvalidBackfillRange},
+			"inverted-ids":  {&backfill.Job{FromID: &from, ToID: &to}, apperrors.ErrInvalidBackfillRange},
+			"rate-too-high": {&backfill.Job{RatePerSecond: config.MaxRatePerSecond + 1}, apperrors.ErrInvalidBackfillRate},
+			"negative-rate": {&backfill.Job{RatePerSecond: -1}, apperrors.ErrInvalidBackfillRate},
+		} {
+			t.Run(name, func(t *testing.T) {
+				assert.ErrorIs(t, service.Start(context.Background(), tc.job), tc.err)
+			})
+		}
+	})
+	t.Run("admin-api", func(t *testing.T) {
+		service := backfillService.New(newFakeBackfillRepository(2), memory.New(), schemas, config, myLogger)
+		router := mux.NewRouter()
+		admin := router.PathPrefix("/admin").Subrouter()
+		admin.Use(middleware.AdminToken("secret", myLogger))
+		handler.NewBackfillHandler(service, myLogger).InitRoutes(admin)
+
+		body := []byte(`{"rate_per_second": 10}`)
+		req := httptest.NewRequest(http.MethodPost, "/admin/backfill", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req = httptest.NewRequest(http.MethodPost, "/admin/backfill", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusAccepted, rec.Code)
+
+		var job backfill.Job
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&job))
+		assert.Equal(t, backfill.StatusRunning, job.Status)
+		assert.Equal(t, int64(2), job.Total)
+
+		req = httptest.NewRequest(http.MethodPost, "/admin/backfill/"+job.ID.String()+"/resume", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
+
+// drainBackfill publishes batches until no job has anything left.
+func drainBackfill(t *testing.T, service *backfillService.Service) {
+	for i := 0; i < 100; i++ {
+		published, err := service.PublishBatch(context.Background())
+		require.NoError(t, err)
+		if published == 0 {
+			return
+		}
+	}
+	t.Fatal("backfill did not finish")
+}
+
+// newReplayBus returns a memory bus and the messages it delivered on subject so far.
+func newReplayBus(t *testing.T, subject string) (*memory.Bus, func() []*pubsub.Message) {
+	bus := memory.New()
+	var mu sync.Mutex
+	messages := make([]*pubsub.Message, 0)
+	_, err := bus.Subscribe(subject, func(msg *pubsub.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, msg)
+		return nil
+	})
+	require.NoError(t, err)
+
+	return bus, func() []*pubsub.Message {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*pubsub.Message(nil), messages...)
+	}
+}
+
+// replayedUserID returns the id of the user a replayed message is about.
+func replayedUserID(t *testing.T, msg *pubsub.Message) string {
+	ce, err := cloudevents.Parse(msg.Data)
+	require.NoError(t, err)
+	return ce.Subject
+}
+
+// fakeBackfillRepository keeps jobs in memory over a fixed set of users sorted by id, one registered per
+// minute.
+type fakeBackfillRepository struct {
+	mu     sync.Mutex
+	users  []user.User
+	jobs   map[uuid.UUID]*backfill.Job
+	leases map[uuid.UUID]time.Time
+}
+
+func newFakeBackfillRepository(count int) *fakeBackfillRepository {
+	r := &fakeBackfillRepository{jobs: make(map[uuid.UUID]*backfill.Job), leases: make(map[uuid.UUID]time.Time)}
+	for i := 0; i < count; i++ {
+		r.users = append(r.users, user.User{ID: uuid.New(), Email: uuid.NewString() + "@gmail.com"})
+	}
+	sort.Slice(r.users, func(i, j int) bool { return bytes.Compare(r.users[i].ID[:], r.users[j].ID[:]) < 0 })
+	registered := time.Date(2023, 4, 20, 10, 0, 0, 0, time.UTC)
+	for i := range r.users {
+		r.users[i].CreatedAt = registered.Add(time.Duration(i) * time.Minute)
+		r.users[i].UpdatedAt = r.users[i].CreatedAt
+	}
+	return r
+}
+
+func (r *fakeBackfillRepository) ExpireLeases() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := range r.leases {
+		r.leases[id] = time.Time{}
+	}
+}
+
+func (r *fakeBackfillRepository) inRange(job *backfill.Job, u *user.User) bool {
+	return (job.CreatedAfter == nil || u.CreatedAt.After(*job.CreatedAfter)) &&
+		(job.CreatedBefore == nil || u.CreatedAt.Before(*job.CreatedBefore)) &&
+		(job.FromID == nil || bytes.Compare(u.ID[:], job.FromID[:]) >= 0) &&
+		(job.ToID == nil || bytes.Compare(u.ID[:], job.ToID[:]) <= 0)
+}
+
+func (r *fakeBackfillRepository) Create(ctx context.Context, job *backfill.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.ID = uuid.New()
+	job.Status = backfill.StatusRunning
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	for i := range r.users {
+		if r.inRange(job, &r.users[i]) {
+			job.Total++
+		}
+	}
+	job.UpdateProgress()
+	stored := *job
+	r.jobs[job.ID] = &stored
+	return nil
+}
+
+func (r *fakeBackfillRepository) Get(ctx context.Context, id uuid.UUID) (*backfill.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, apperrors.ErrBackfillNotFound
+	}
+	jobCopy := *job
+	jobCopy.UpdateProgress()
+	return &jobCopy, nil
+}
+
+func (r *fakeBackfillRepository) List(ctx context.Context) ([]backfill.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := make([]backfill.Job, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs, nil
+}
+
+func (r *fakeBackfillRepository) SetStatus(ctx context.Context, id uuid.UUID, from []backfill.Status, status backfill.Status) (*backfill.Job, error) {
+	r.mu.Lock()
+	job, ok := r.jobs[id]
+	if !ok {
+		r.mu.Unlock()
+		return nil, apperrors.ErrBackfillNotFound
+	}
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || job.Status == s
+	}
+	if !allowed {
+		r.mu.Unlock()
+		return nil, apperrors.ErrBackfillStateConflict
+	}
+	job.Status = status
+	delete(r.leases, id)
+	r.mu.Unlock()
+	return r.Get(ctx, id)
+}
+
+func (r *fakeBackfillRepository) Claim(ctx context.Context, lease time.Duration) (*backfill.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, job := range r.jobs {
+		if job.Status == backfill.StatusRunning && !r.leases[id].After(time.Now()) {
+			r.leases[id] = time.Now().Add(lease)
+			jobCopy := *job
+			return &jobCopy, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeBackfillRepository) NextUsers(ctx context.Context, job *backfill.Job, limit int) ([]user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	users := make([]user.User, 0, limit)
+	for i := range r.users {
+		u := &r.users[i]
+		if len(users) < limit && r.inRange(job, u) && (job.Cursor == nil || bytes.Compare(u.ID[:], job.Cursor[:]) > 0) {
+			users = append(users, *u)
+		}
+	}
+	return users, nil
+}
+
+func (r *fakeBackfillRepository) Advance(ctx context.Context, job *backfill.Job, retryIn time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.jobs[job.ID]
+	stored.Cursor = job.Cursor
+	stored.Published = job.Published
+	stored.LastError = job.LastError
+	r.leases[job.ID] = time.Now().Add(retryIn)
+	return nil
+}
+
+func (r *fakeBackfillRepository) Finish(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job := r.jobs[id]; job.Status == backfill.StatusRunning {
+		job.Status = backfill.StatusFinished
+	}
+	return nil
+}
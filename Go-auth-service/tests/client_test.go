@@ -0,0 +1,264 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/pkg/client"
+	"Golang-practice-2023/pkg/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	t.Run("decode-api-error", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"Code":404,"Message":"user not found"}`))
+		}))
+		defer srv.Close()
+
+		c, err := client.New(srv.URL)
+		require.NoError(t, err)
+
+		_, err = c.GetUser(context.Background(), uuid.New())
+
+		var apiErr *client.Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.True(t, errors.Is(err, client.ErrUserNotFound))
+	})
+	t.Run("retry-on-server-error", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", contentType)
+			_ = json.NewEncoder(w).Encode(client.User{ID: uuid.New(), Email: "test@gmail.com"})
+		}))
+		defer srv.Close()
+
+		c, err := client.New(srv.URL, client.WithRetries(3, time.Millisecond))
+		require.NoError(t, err)
+
+		u, err := c.GetUser(context.Background(), uuid.New())
+
+		require.NoError(t, err)
+		assert.Equal(t, "test@gmail.com", u.Email)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+	t.Run("no-retry-on-create", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		c, err := client.New(srv.URL, client.WithRetries(3, time.Millisecond))
+		require.NoError(t, err)
+
+		_, err = c.CreateUser(context.Background(), "test@gmail.com", "password1")
+
+		require.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+	t.Run("bearer-auth", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		c, err := client.New(srv.URL, client.WithBearerToken("secret"))
+		require.NoError(t, err)
+
+		require.NoError(t, c.DeleteUser(context.Background(), uuid.New()))
+	})
+	t.Run("list-users-after-cursor", func(t *testing.T) {
+		afterID := uuid.New()
+		date := time.Date(2026, 10, 19, 12, 0, 0, 123456000, time.UTC)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "2026-10-19 12:00:00.123456", r.URL.Query().Get("date"))
+			assert.Equal(t, afterID.String(), r.URL.Query().Get("after_id"))
+			assert.Equal(t, "500", r.URL.Query().Get("limit"))
+			w.Header().Set("Content-Type", contentType)
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		defer srv.Close()
+
+		c, err := client.New(srv.URL)
+		require.NoError(t, err)
+
+		users, err := c.ListUsersAfter(context.Background(), date, afterID, 500)
+
+		require.NoError(t, err)
+		assert.Empty(t, users)
+	})
+	t.Run("iterate-users-registered-after", func(t *testing.T) {
+		date := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+		all := make([]client.User, 5)
+		for i := range all {
+			// Pages of 2 split the users registered at the same time.
+			all[i] = client.User{ID: uuid.New(), CreatedAt: date.Add(time.Duration(i/3+1) * time.Microsecond)}
+		}
+		sort.Slice(all, func(i, j int) bool {
+			if !all[i].CreatedAt.Equal(all[j].CreatedAt) {
+				return all[i].CreatedAt.Before(all[j].CreatedAt)
+			}
+			return all[i].ID.String() < all[j].ID.String()
+		})
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cursorDate, err := time.Parse(client.DateLayout, r.URL.Query().Get("date"))
+			require.NoError(t, err)
+			cursorID := r.URL.Query().Get("after_id")
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+			page := make([]client.User, 0)
+			for _, u := range all {
+				after := u.CreatedAt.After(cursorDate)
+				if cursorID != "" {
+					after = after || u.CreatedAt.Equal(cursorDate) && u.ID.String() > cursorID
+				}
+				if after && len(page) < limit {
+					page = append(page, u)
+				}
+			}
+			w.Header().Set("Content-Type", contentType)
+			_ = json.NewEncoder(w).Encode(page)
+		}))
+		defer srv.Close()
+
+		c, err := client.New(srv.URL)
+		require.NoError(t, err)
+
+		var ids []uuid.UUID
+		it := c.UsersRegisteredAfter(date, 2)
+		for it.Next(context.Background()) {
+			ids = append(ids, it.User().ID)
+		}
+
+		require.NoError(t, it.Err())
+		require.Len(t, ids, len(all))
+		for i, u := range all {
+			assert.Equal(t, u.ID, ids[i])
+		}
+	})
+	t.Run("iterate-users", func(t *testing.T) {
+		all := make([]client.User, 5)
+		for i := range all {
+			all[i] = client.User{ID: uuid.New(), CreatedAt: time.Now().Add(time.Duration(i) * time.Second)}
+		}
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			end := offset + limit
+			if end > len(all) {
+				end = len(all)
+			}
+			w.Header().Set("Content-Type", contentType)
+			_ = json.NewEncoder(w).Encode(all[offset:end])
+		}))
+		defer srv.Close()
+
+		c, err := client.New(srv.URL)
+		require.NoError(t, err)
+
+		var ids []uuid.UUID
+		it := c.Users(2)
+		for it.Next(context.Background()) {
+			ids = append(ids, it.User().ID)
+		}
+
+		require.NoError(t, it.Err())
+		require.Len(t, ids, len(all))
+		for i := range all {
+			assert.Equal(t, all[i].ID, ids[i])
+		}
+	})
+	t.Run("no-credentials-in-responses", func(t *testing.T) {
+		zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+		existing := &user.User{ID: uuid.New(), Email: "test@gmail.com", Passwordhash: "secret-hash"}
+		router := mux.NewRouter()
+		handler.New(&grpcStubService{users: map[uuid.UUID]*user.User{existing.ID: existing}}, myLogger).InitRoutes(router)
+		srv := httptest.NewServer(router)
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/user/" + existing.ID.String())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, "test@gmail.com", body["email"])
+		assert.NotContains(t, body, "passwordhash")
+	})
+	t.Run("report-truncated-export", func(t *testing.T) {
+		zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+		service := &exportStubService{users: 2, err: errors.New("connection reset")}
+		router := mux.NewRouter()
+		handler.InitVersionedRoutes(router, handler.Version{Name: "v1",
+			Routes: []handler.RoutesInitializer{handler.New(service, myLogger).InitRoutes}})
+		srv := httptest.NewServer(router)
+		defer srv.Close()
+
+		c, err := client.New(srv.URL)
+		require.NoError(t, err)
+		afterID := uuid.New()
+		it, err := c.ExportUsers(context.Background(), client.ExportFilter{RegisteredAfter: "2026-10-19", AfterID: afterID})
+		require.NoError(t, err)
+		defer it.Close()
+
+		received := 0
+		for it.Next() {
+			received++
+		}
+		assert.Equal(t, 2, received)
+		assert.ErrorIs(t, it.Err(), client.ErrExportTruncated)
+		assert.Equal(t, afterID, service.filter.AfterID)
+	})
+	t.Run("complete-export", func(t *testing.T) {
+		zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+		myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+		router := mux.NewRouter()
+		handler.InitVersionedRoutes(router, handler.Version{Name: "v1",
+			Routes: []handler.RoutesInitializer{handler.New(&exportStubService{users: 2}, myLogger).InitRoutes}})
+		srv := httptest.NewServer(router)
+		defer srv.Close()
+
+		c, err := client.New(srv.URL)
+		require.NoError(t, err)
+		it, err := c.ExportUsers(context.Background(), client.ExportFilter{})
+		require.NoError(t, err)
+		defer it.Close()
+
+		received := 0
+		for it.Next() {
+			received++
+		}
+		assert.Equal(t, 2, received)
+		assert.NoError(t, it.Err())
+	})
+}
@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"Golang-practice-2023/api"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/outbox"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/pkg/cloudevents"
+	"Golang-practice-2023/pkg/logger"
+	"context"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUserEvents(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	repository := &outboxCapturingRepository{}
+	userService, err := NewUserService(repository, myLogger)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	u := &user.User{Email: "events@gmail.com", Passwordhash: "password1"}
+	require.NoError(t, userService.Create(ctx, u))
+	require.NoError(t, userService.Update(ctx, &user.User{ID: u.ID, Email: "renamed@gmail.com", Passwordhash: "password2"}))
+	require.NoError(t, userService.Delete(ctx, u.ID))
+
+	require.Len(t, repository.messages, 3)
+	assert.Equal(t, event.SubjectUserCreated, repository.messages[0].Subject)
+	assert.Equal(t, event.SubjectUserUpdated, repository.messages[1].Subject)
+	assert.Equal(t, event.SubjectUserDeleted, repository.messages[2].Subject)
+	for _, message := range repository.messages {
+		assert.Equal(t, u.ID.String(), message.Key, "the changes of a user are ordered by its id")
+	}
+
+	var created event.UserCreated
+	ce := decodeEvent(t, repository.messages[0], &created)
+	assert.Equal(t, u.ID, created.ID)
+	assert.Equal(t, "events@gmail.com", created.Email)
+	assert.Equal(t, cloudevents.SpecVersion, ce.SpecVersion)
+	assert.Equal(t, event.SubjectUserCreated, ce.Type)
+	assert.Equal(t, "/go-auth", ce.Source)
+	assert.Equal(t, cloudevents.SchemaURI(event.SubjectUserCreated, 2), ce.DataSchema)
+	assert.Equal(t, u.ID.String(), ce.Subject)
+	assert.NotEmpty(t, ce.ID)
+	assert.NotContains(t, string(ce.Data), "passwordhash")
+
+	var updated event.UserUpdated
+	ce = decodeEvent(t, repository.messages[1], &updated)
+	assert.Equal(t, u.ID, updated.ID)
+	assert.Equal(t, "renamed@gmail.com", updated.Email)
+	assert.NotContains(t, string(ce.Data), "passwordhash")
+
+	var deleted event.UserDeleted
+	decodeEvent(t, repository.messages[2], &deleted)
+	assert.Equal(t, u.ID, deleted.ID)
+	assert.False(t, deleted.DeletedAt.IsZero())
+}
+
+func TestEventSchemas(t *testing.T) {
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	for _, eventType := range []string{event.SubjectUserCreated, event.SubjectUserUpdated, event.SubjectUserDeleted} {
+		_, err := schemas.Latest(eventType)
+		assert.NoError(t, err, eventType)
+	}
+
+	t.Run("reject-invalid-data", func(t *testing.T) {
+		ce, err := cloudevents.New("/test", event.SubjectUserDeleted, cloudevents.SchemaURI(event.SubjectUserDeleted, 1),
+			map[string]string{"id": "not-a-uuid"})
+		require.NoError(t, err)
+		assert.ErrorIs(t, schemas.Validate(ce), cloudevents.ErrSchemaValidation)
+	})
+	t.Run("reject-credentials", func(t *testing.T) {
+		ce, err := cloudevents.New("/test", event.SubjectUserCreated, cloudevents.SchemaURI(event.SubjectUserCreated, 2),
+			map[string]interface{}{"id": uuid.New(), "email": "v2@gmail.com", "passwordhash": "hash",
+				"created_at": time.Now(), "updated_at": time.Now()})
+		require.NoError(t, err)
+		assert.ErrorIs(t, schemas.Validate(ce), cloudevents.ErrSchemaValidation)
+	})
+	t.Run("upcast-v1-without-credentials", func(t *testing.T) {
+		ce, err := cloudevents.New("/test", event.SubjectUserUpdated, cloudevents.SchemaURI(event.SubjectUserUpdated, 1),
+			map[string]interface{}{"id": uuid.New(), "email": "v1@gmail.com", "passwordhash": "hash",
+				"created_at": time.Now(), "updated_at": time.Now()})
+		require.NoError(t, err)
+
+		upcasted, err := schemas.Upcast(ce)
+		require.NoError(t, err)
+		assert.Equal(t, cloudevents.SchemaURI(event.SubjectUserUpdated, 2), upcasted.DataSchema)
+		assert.NotContains(t, string(upcasted.Data), "passwordhash")
+		assert.Contains(t, string(upcasted.Data), "v1@gmail.com")
+	})
+	t.Run("reject-unknown-schema", func(t *testing.T) {
+		ce, err := cloudevents.New("/test", "users.renamed", cloudevents.SchemaURI("users.renamed", 1), struct{}{})
+		require.NoError(t, err)
+		assert.ErrorIs(t, schemas.Validate(ce), cloudevents.ErrUnknownSchema)
+	})
+	t.Run("reject-messages-without-envelope", func(t *testing.T) {
+		_, err := cloudevents.Parse([]byte(`{"id": "1", "email": "raw@gmail.com"}`))
+		assert.ErrorIs(t, err, cloudevents.ErrNotCloudEvent)
+	})
+}
+
+func decodeEvent(t *testing.T, message *outbox.Message, data interface{}) *cloudevents.Event {
+	ce, err := cloudevents.Parse(message.Payload)
+	require.NoError(t, err)
+	require.Equal(t, message.Subject, ce.Type)
+	require.NoError(t, ce.DecodeData(data))
+	return ce
+}
+
+// outboxCapturingRepository stores a single user and records the outbox messages written with each change.
+type outboxCapturingRepository struct {
+	user.Repository
+	stored   *user.User
+	messages []*outbox.Message
+}
+
+func (r *outboxCapturingRepository) record(u *user.User, newMessage user.NewMessage) error {
+	message, err := newMessage(u)
+	if err != nil {
+		return err
+	}
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func (r *outboxCapturingRepository) Create(ctx context.Context, u *user.User, newMessage user.NewMessage) error {
+	u.ID = uuid.New()
+	u.CreatedAt = time.Now()
+	u.UpdatedAt = u.CreatedAt
+	stored := *u
+	r.stored = &stored
+	return r.record(u, newMessage)
+}
+
+func (r *outboxCapturingRepository) GetById(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	stored := *r.stored
+	return &stored, nil
+}
+
+func (r *outboxCapturingRepository) Update(ctx context.Context, u *user.User, newMessage user.NewMessage) error {
+	u.CreatedAt = r.stored.CreatedAt
+	u.UpdatedAt = time.Now()
+	stored := *u
+	r.stored = &stored
+	return r.record(u, newMessage)
+}
+
+func (r *outboxCapturingRepository) Delete(ctx context.Context, id uuid.UUID, newMessage user.NewMessage) error {
+	return r.record(&user.User{ID: id}, newMessage)
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/pkg/logger"
+	"bufio"
+	"context"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportHandler(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	serve := func(service *exportStubService, url string, accept string) *http.Response {
+		router := mux.NewRouter()
+		handler.New(service, myLogger).InitRoutes(router)
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Result()
+	}
+	lines := func(t *testing.T, resp *http.Response) int {
+		count := 0
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			count++
+		}
+		require.NoError(t, scanner.Err())
+		return count
+	}
+
+	t.Run("mark-complete-export", func(t *testing.T) {
+		resp := serve(&exportStubService{users: 3}, "/user/export", "application/x-ndjson")
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 3, lines(t, resp))
+		assert.Equal(t, "complete", resp.Trailer.Get("X-Export-Status"))
+		assert.Equal(t, "3", resp.Trailer.Get("X-Export-Count"))
+	})
+	t.Run("mark-truncated-export", func(t *testing.T) {
+		resp := serve(&exportStubService{users: 3, err: apperrors.ErrDbQueryProcessing}, "/user/export", "application/x-ndjson")
+
+		require.Equal(t, http.StatusOK, resp.StatusCode, "the status was sent with the first user")
+		assert.Equal(t, 3, lines(t, resp))
+		assert.Equal(t, "truncated", resp.Trailer.Get("X-Export-Status"))
+		assert.Equal(t, "3", resp.Trailer.Get("X-Export-Count"))
+	})
+	t.Run("mark-truncated-csv-export", func(t *testing.T) {
+		resp := serve(&exportStubService{users: 2, err: apperrors.ErrDbQueryProcessing}, "/user/export", "text/csv")
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 3, lines(t, resp), "the header and the users written are flushed")
+		assert.Equal(t, "truncated", resp.Trailer.Get("X-Export-Status"))
+	})
+	t.Run("fail-export-before-first-user", func(t *testing.T) {
+		resp := serve(&exportStubService{err: apperrors.ErrDbQueryProcessing}, "/user/export", "application/x-ndjson")
+
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Empty(t, resp.Trailer.Get("X-Export-Status"))
+	})
+	t.Run("resume-after-cursor", func(t *testing.T) {
+		service := &exportStubService{}
+		afterID := uuid.New()
+		resp := serve(service, "/user/export?date=2026-10-19T10:00:00Z&after_id="+afterID.String(), "application/x-ndjson")
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "2026-10-19T10:00:00Z", service.filter.RegisteredAfter)
+		assert.Equal(t, afterID, service.filter.AfterID)
+	})
+	t.Run("refuse-cursor-without-date", func(t *testing.T) {
+		resp := serve(&exportStubService{}, "/user/export?after_id="+uuid.NewString(), "application/x-ndjson")
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("refuse-invalid-cursor", func(t *testing.T) {
+		resp := serve(&exportStubService{}, "/user/export?date=2026-10-19&after_id=42", "application/x-ndjson")
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+// exportStubService exports the given number of users, then fails with err if it is set.
+type exportStubService struct {
+	user.Service
+	users  int
+	err    error
+	filter user.ExportFilter
+}
+
+func (s *exportStubService) Export(ctx context.Context, filter user.ExportFilter, fn func(user *user.ExportedUser) error) error {
+	s.filter = filter
+	for i := 0; i < s.users; i++ {
+		if err := fn(&user.ExportedUser{ID: uuid.New(), Email: strings.Repeat("a", i+1) + "@gmail.com", CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/user"
+	grpcHandler "Golang-practice-2023/internal/transport/grpc/handler"
+	"Golang-practice-2023/pkg/grpc/userpb"
+	"Golang-practice-2023/pkg/logger"
+	"context"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcHealth "google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+type grpcStubService struct {
+	user.Service
+	users   map[uuid.UUID]*user.User
+	changes chan user.Change
+}
+
+func (s *grpcStubService) GetById(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	if u, ok := s.users[id]; ok {
+		return u, nil
+	}
+	return nil, apperrors.ErrUserNotFound
+}
+
+func (s *grpcStubService) Watch(ctx context.Context) <-chan user.Change {
+	return s.changes
+}
+
+func TestGrpcServer(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	existing := &user.User{ID: uuid.New(), Email: "test@gmail.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	stub := &grpcStubService{
+		users:   map[uuid.UUID]*user.User{existing.ID: existing},
+		changes: make(chan user.Change, 1),
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	grpcHandler.New(stub, myLogger).Register(srv)
+	healthSrv := grpcHealth.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, healthSrv)
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := userpb.NewUserServiceClient(conn)
+
+	t.Run("get-user", func(t *testing.T) {
+		u, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: existing.ID.String()})
+
+		require.NoError(t, err)
+		assert.Equal(t, existing.Email, u.GetEmail())
+	})
+	t.Run("get-user-by-not-existing-id", func(t *testing.T) {
+		_, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: uuid.New().String()})
+
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+	t.Run("get-user-by-invalid-id-format", func(t *testing.T) {
+		_, err := client.GetUser(context.Background(), &userpb.GetUserRequest{Id: "3457834578374535"})
+
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+	t.Run("watch-users", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		stream, err := client.WatchUsers(ctx, &userpb.WatchUsersRequest{})
+		require.NoError(t, err)
+
+		stub.changes <- user.Change{Type: user.ChangeUpdated, User: *existing, OccurredAt: time.Now()}
+
+		change, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, userpb.ChangeType_CHANGE_TYPE_UPDATED, change.GetType())
+		assert.Equal(t, existing.ID.String(), change.GetUser().GetId())
+	})
+	t.Run("end-watch-of-watcher-behind", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// The service closes the changes of a watcher that fell behind.
+		stub.changes = make(chan user.Change)
+		close(stub.changes)
+
+		stream, err := client.WatchUsers(ctx, &userpb.WatchUsersRequest{})
+		require.NoError(t, err)
+
+		_, err = stream.Recv()
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+	t.Run("health-check", func(t *testing.T) {
+		resp, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+
+		require.NoError(t, err)
+		assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.GetStatus())
+	})
+}
@@ -1,13 +1,13 @@
 package tests
 
 import (
+	"Golang-practice-2023/api"
 	"Golang-practice-2023/internal/domain/logger"
 	"Golang-practice-2023/internal/domain/user"
 	"Golang-practice-2023/internal/user/repository"
 	"Golang-practice-2023/internal/user/service"
 	"Golang-practice-2023/pkg/migration"
 	"Golang-practice-2023/pkg/pgconnect"
-	"Golang-practice-2023/pkg/pubsub/nats/pub"
 	"Golang-practice-2023/tests/data/provider"
 	"errors"
 	"github.com/golang-migrate/migrate/v4"
@@ -53,8 +53,12 @@ func NewUserRepository(db *sqlx.DB, logger logger.Logger) (*repository.Repositor
 	return repository.New(db, logger), nil
 }
 
-func NewUserService(repository user.Repository, logger logger.Logger, nats *pub.NatsPublisher) (*service.Service, error) {
-	return service.New(repository, logger, nats), nil
+func NewUserService(repository user.Repository, logger logger.Logger) (*service.Service, error) {
+	schemas, err := api.NewEventRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return service.New(repository, schemas, logger), nil
 }
 
 func NewUserDataProvider() (*provider.UserDataProvider, error) {
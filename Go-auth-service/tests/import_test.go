@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/pkg/logger"
+	"bytes"
+	"context"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestImportHandler(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	row := `{"email":"import@gmail.com","password":"password1"}` + "\n"
+	// chunked hides the length of the body, as a chunked upload does.
+	chunked := func(body io.Reader) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, "/user/import", io.MultiReader(body))
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		return req
+	}
+	serve := func(service *importStubService, req *http.Request) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		handler.New(service, myLogger).InitRoutes(router)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("import-small-chunked-body", func(t *testing.T) {
+		service := &importStubService{}
+		rr := serve(service, chunked(strings.NewReader(row)))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []int{1}, service.imported)
+		assert.Nil(t, service.started)
+	})
+	t.Run("import-large-chunked-body-as-job", func(t *testing.T) {
+		service := &importStubService{}
+		padding := strings.Repeat("\n", 2<<20)
+		rr := serve(service, chunked(io.MultiReader(strings.NewReader(padding), strings.NewReader(row))))
+
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Nil(t, service.imported)
+		assert.Equal(t, []int{2<<20 + 1}, service.started, "the job gets the whole body")
+		assert.True(t, service.done)
+		assert.True(t, strings.HasPrefix(rr.Header().Get("Location"), "/user/import/"))
+	})
+	t.Run("refuse-chunked-body-above-job-limit", func(t *testing.T) {
+		service := &importStubService{}
+		rr := serve(service, chunked(io.LimitReader(newlines{}, 64<<20+1)))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		assert.Nil(t, service.imported)
+		assert.Nil(t, service.started)
+	})
+	t.Run("import-declared-large-body-as-job", func(t *testing.T) {
+		service := &importStubService{}
+		body := strings.Repeat("\n", 2<<20) + row
+		req, _ := http.NewRequest(http.MethodPost, "/user/import", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		rr := serve(service, req)
+
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		assert.Equal(t, []int{2<<20 + 1}, service.started)
+	})
+}
+
+type newlines struct{}
+
+func (newlines) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = '\n'
+	}
+	return len(p), nil
+}
+
+// importStubService records the line numbers of the rows it is given to import, synchronously or as a job.
+type importStubService struct {
+	user.Service
+	imported []int
+	started  []int
+	done     bool
+}
+
+func readLines(source user.RowSource) []int {
+	var lines []int
+	for {
+		row, err := source.Next()
+		if err != nil {
+			return lines
+		}
+		lines = append(lines, row.Line)
+	}
+}
+
+func (s *importStubService) Import(ctx context.Context, source user.RowSource) (*user.ImportReport, error) {
+	s.imported = readLines(source)
+	return &user.ImportReport{Total: len(s.imported)}, nil
+}
+
+func (s *importStubService) StartImport(ctx context.Context, source user.RowSource, onDone func()) (*user.ImportJob, error) {
+	s.started = readLines(source)
+	onDone()
+	s.done = true
+	return &user.ImportJob{ID: uuid.New(), Status: user.ImportJobPending}, nil
+}
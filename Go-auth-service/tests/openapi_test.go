@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"Golang-practice-2023/api"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/internal/transport/rest/middleware"
+	"Golang-practice-2023/pkg/logger"
+	"bytes"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenAPISpecMatchesRouter(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	spec, err := api.Load()
+	require.NoError(t, err)
+
+	v1 := handler.Version{Name: "v1", Routes: []handler.RoutesInitializer{handler.New(nil, myLogger).InitRoutes}}
+	router := mux.NewRouter()
+	handler.InitVersionedRoutes(router, v1)
+
+	versionedOperations := make(map[string]bool)
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			versionedOperations[method+" "+path] = true
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	specOperations := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			specOperations[strings.ToUpper(method)+" "+v1.Prefix()+path] = true
+		}
+	}
+
+	assert.Equal(t, sortedKeys(specOperations), sortedKeys(versionedOperations))
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	spec, err := api.Load()
+	require.NoError(t, err)
+	specValidator, err := middleware.OpenAPIValidator(spec, myLogger, "/v1", "/")
+	require.NoError(t, err)
+
+	v1 := handler.Version{Name: "v1", Routes: []handler.RoutesInitializer{handler.New(nil, myLogger).InitRoutes}}
+	router := mux.NewRouter()
+	router.Use(specValidator)
+	handler.InitVersionedRoutes(router, v1)
+	handler.NewOpenAPIHandler(spec, myLogger).InitRoutes(router)
+	handler.InitLegacyRoutes(router, v1, time.Now(), nil)
+
+	t.Run("reject-invalid-id", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/user/not-a-uuid", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("reject-invalid-id-versioned", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/user/not-a-uuid", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("reject-missing-required-field", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodPost, "/user", bytes.NewBufferString(`{"email": "test@gmail.com"}`))
+		req.Header.Set("Content-Type", contentType)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("reject-invalid-query", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/user?offset=-1&limit=abc", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("serve-spec", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"openapi":"3.0.3"`)
+	})
+	t.Run("serve-docs-with-pinned-redoc", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/docs", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "/redoc/v2.1.5/")
+		assert.NotContains(t, rr.Body.String(), "/latest/")
+	})
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,359 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/outbox"
+	"Golang-practice-2023/internal/domain/pubsub"
+	outboxService "Golang-practice-2023/internal/outbox/service"
+	"Golang-practice-2023/pkg/logger"
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	config := outboxService.DefaultConfig()
+	config.BaseBackoff = time.Minute
+
+	t.Run("publish-in-order-and-mark-sent", func(t *testing.T) {
+		repository := newFakeOutboxRepository("first", "second", "third")
+		publisher := &fakePublisher{}
+		relay, err := outboxService.NewRelay(repository, publisher, config, prometheus.NewRegistry(), myLogger)
+		require.NoError(t, err)
+
+		claimed, err := relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 3, claimed)
+		assert.Equal(t, []string{"first", "second", "third"}, publisher.Published())
+
+		claimed, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, claimed)
+	})
+	t.Run("keep-order-after-failure", func(t *testing.T) {
+		repository := newFakeOutboxRepository("created", "updated", "deleted")
+		publisher := &fakePublisher{}
+		publisher.FailOn("updated", true)
+		relay, err := outboxService.NewRelay(repository, publisher, config, prometheus.NewRegistry(), myLogger)
+		require.NoError(t, err)
+
+		_, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"created"}, publisher.Published())
+		assert.Equal(t, 1, repository.Message(1).Attempts)
+		assert.Equal(t, 0, repository.Message(2).Attempts)
+
+		// The message after the failed one waits for its retry.
+		claimed, err := relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, claimed)
+
+		publisher.FailOn("updated", false)
+		repository.MakeDue()
+		_, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"created", "updated", "deleted"}, publisher.Published())
+	})
+	t.Run("publish-other-keys-after-failure", func(t *testing.T) {
+		repository := newFakeOutboxRepository("a-created", "b-created", "a-updated", "b-updated")
+		repository.SetKeys("a", "b", "a", "b")
+		publisher := &fakePublisher{}
+		publisher.FailOn("a-created", true)
+		relay, err := outboxService.NewRelay(repository, publisher, config, prometheus.NewRegistry(), myLogger)
+		require.NoError(t, err)
+
+		_, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b-created", "b-updated"}, publisher.Published(), "a failed key does not hold back the others")
+
+		publisher.FailOn("a-created", false)
+		repository.MakeDue()
+		_, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b-created", "b-updated", "a-created", "a-updated"}, publisher.Published())
+	})
+	t.Run("give-up-after-max-attempts", func(t *testing.T) {
+		repository := newFakeOutboxRepository("invalid", "created", "updated")
+		publisher := &fakePublisher{}
+		publisher.FailOn("invalid", true)
+		registry := prometheus.NewRegistry()
+		config := config
+		config.MaxAttempts = 2
+		relay, err := outboxService.NewRelay(repository, publisher, config, registry, myLogger)
+		require.NoError(t, err)
+
+		_, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, publisher.Published())
+		assert.False(t, repository.Dead(0))
+
+		repository.MakeDue()
+		_, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.True(t, repository.Dead(0))
+		assert.Equal(t, 2, repository.Message(0).Attempts)
+		assert.Equal(t, []string{"created", "updated"}, publisher.Published(), "a dead message stops holding back its key")
+
+		relay.UpdateBacklog(context.Background())
+		expected := `
+			# HELP outbox_dead_messages Number of outbox messages the relay gave up on after too many failed attempts.
+			# TYPE outbox_dead_messages gauge
+			outbox_dead_messages 1
+			# HELP outbox_dead_messages_total Number of outbox messages given up on by this relay.
+			# TYPE outbox_dead_messages_total counter
+			outbox_dead_messages_total 1
+			# HELP outbox_pending_messages Number of outbox messages that have not been published yet.
+			# TYPE outbox_pending_messages gauge
+			outbox_pending_messages 0
+		`
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+			"outbox_dead_messages", "outbox_dead_messages_total", "outbox_pending_messages"))
+
+		claimed, err := relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, claimed)
+	})
+	t.Run("retry-with-backoff-while-nats-is-down", func(t *testing.T) {
+		repository := newFakeOutboxRepository("user")
+		publisher := &fakePublisher{err: errors.New("nats: connection closed")}
+		registry := prometheus.NewRegistry()
+		relay, err := outboxService.NewRelay(repository, publisher, config, registry, myLogger)
+		require.NoError(t, err)
+
+		_, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+
+		message := repository.Message(0)
+		assert.Equal(t, 1, message.Attempts)
+		assert.Equal(t, "nats: connection closed", message.LastError)
+		assert.True(t, message.NextAttemptAt.After(time.Now().Add(30*time.Second)))
+
+		relay.UpdateBacklog(context.Background())
+		expected := `
+			# HELP outbox_pending_messages Number of outbox messages that have not been published yet.
+			# TYPE outbox_pending_messages gauge
+			outbox_pending_messages 1
+			# HELP outbox_publish_failures_total Number of failed outbox publish attempts.
+			# TYPE outbox_publish_failures_total counter
+			outbox_publish_failures_total 1
+		`
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+			"outbox_pending_messages", "outbox_publish_failures_total"))
+
+		publisher.SetErr(nil)
+		repository.MakeDue()
+		_, err = relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user"}, publisher.Published())
+
+		relay.UpdateBacklog(context.Background())
+		expected = `
+			# HELP outbox_pending_messages Number of outbox messages that have not been published yet.
+			# TYPE outbox_pending_messages gauge
+			outbox_pending_messages 0
+		`
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "outbox_pending_messages"))
+	})
+}
+
+type fakePublisher struct {
+	mu        sync.Mutex
+	err       error
+	failOn    map[string]bool
+	published []string
+}
+
+func (p *fakePublisher) Publish(msg *pubsub.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	if p.failOn[string(msg.Data)] {
+		return errors.New("nats: timeout")
+	}
+	p.published = append(p.published, string(msg.Data))
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	return nil
+}
+
+func (p *fakePublisher) SetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func (p *fakePublisher) FailOn(payload string, fail bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failOn == nil {
+		p.failOn = make(map[string]bool)
+	}
+	p.failOn[payload] = fail
+}
+
+func (p *fakePublisher) Published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.published...)
+}
+
+type fakeOutboxRepository struct {
+	mu       sync.Mutex
+	messages []*outbox.Message
+	sent     map[int64]bool
+	dead     map[int64]bool
+}
+
+// newFakeOutboxRepository stores one message per payload, all with the same key.
+func newFakeOutboxRepository(payloads ...string) *fakeOutboxRepository {
+	r := &fakeOutboxRepository{sent: make(map[int64]bool), dead: make(map[int64]bool)}
+	for i, payload := range payloads {
+		r.messages = append(r.messages, &outbox.Message{
+			ID:            int64(i + 1),
+			Subject:       "NewUser",
+			Key:           "user",
+			Payload:       []byte(payload),
+			NextAttemptAt: time.Now(),
+			CreatedAt:     time.Now(),
+		})
+	}
+	return r
+}
+
+func (r *fakeOutboxRepository) Message(i int) outbox.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.messages[i]
+}
+
+func (r *fakeOutboxRepository) SetKeys(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, key := range keys {
+		r.messages[i].Key = key
+	}
+}
+
+func (r *fakeOutboxRepository) Dead(i int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dead[r.messages[i].ID]
+}
+
+func (r *fakeOutboxRepository) MakeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.messages {
+		m.NextAttemptAt = time.Now()
+	}
+}
+
+func (r *fakeOutboxRepository) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]outbox.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	claimed := make([]outbox.Message, 0)
+	blockedKeys := map[string]bool{}
+	for _, m := range r.messages {
+		if len(claimed) == limit {
+			break
+		}
+		if r.sent[m.ID] || r.dead[m.ID] || blockedKeys[m.Key] {
+			continue
+		}
+		if m.NextAttemptAt.After(time.Now()) {
+			blockedKeys[m.Key] = true
+			continue
+		}
+		m.NextAttemptAt = time.Now().Add(lease)
+		claimed = append(claimed, *m)
+	}
+	return claimed, nil
+}
+
+func (r *fakeOutboxRepository) MarkSent(ctx context.Context, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		r.sent[id] = true
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepository) MarkFailed(ctx context.Context, message *outbox.Message, retryIn time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.messages {
+		if m.ID == message.ID {
+			m.Attempts = message.Attempts
+			m.LastError = message.LastError
+			m.NextAttemptAt = time.Now().Add(retryIn)
+			message.NextAttemptAt = m.NextAttemptAt
+		}
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepository) MarkDead(ctx context.Context, message *outbox.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.messages {
+		if m.ID == message.ID {
+			m.Attempts = message.Attempts
+			m.LastError = message.LastError
+			r.dead[m.ID] = true
+		}
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepository) Release(ctx context.Context, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		for _, m := range r.messages {
+			if m.ID == id && !r.sent[id] {
+				m.NextAttemptAt = time.Now()
+			}
+		}
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepository) GetBacklog(ctx context.Context) (*outbox.Backlog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	backlog := &outbox.Backlog{}
+	for _, m := range r.messages {
+		if r.sent[m.ID] {
+			continue
+		}
+		if r.dead[m.ID] {
+			backlog.Dead++
+			continue
+		}
+		backlog.Pending++
+		if age := time.Since(m.CreatedAt); age > backlog.OldestAge {
+			backlog.OldestAge = age
+		}
+	}
+	return backlog, nil
+}
+
+func (r *fakeOutboxRepository) DeleteSentBefore(ctx context.Context, age time.Duration) (int64, error) {
+	return 0, nil
+}
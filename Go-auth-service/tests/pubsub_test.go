@@ -0,0 +1,246 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/pubsub"
+	outboxService "Golang-practice-2023/internal/outbox/service"
+	"Golang-practice-2023/pkg/logger"
+	"Golang-practice-2023/pkg/pubsub/bus"
+	"Golang-practice-2023/pkg/pubsub/memory"
+	"Golang-practice-2023/pkg/pubsub/nats/pub"
+	"Golang-practice-2023/pkg/pubsub/nats/stream"
+	"Golang-practice-2023/pkg/pubsub/subject"
+	"Golang-practice-2023/pkg/pubsub/worker"
+	"context"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubjectMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		match   bool
+	}{
+		{"users.created", "users.created", true},
+		{"users.created", "users.deleted", false},
+		{"users.*", "users.created", true},
+		{"users.*", "users.created.v2", false},
+		{"users.>", "users.created.v2", true},
+		{"users.>", "users", false},
+		{"*.created", "users.created", true},
+		{"users.created", "users", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.match, subject.Match(test.pattern, test.subject), "%s ~ %s", test.pattern, test.subject)
+	}
+}
+
+func TestMemoryBus(t *testing.T) {
+	memoryBus := memory.New()
+
+	received := make([]string, 0)
+	all, err := memoryBus.Subscribe("users.>", func(msg *pubsub.Message) error {
+		received = append(received, msg.Subject)
+		return nil
+	})
+	require.NoError(t, err)
+	created := 0
+	_, err = memoryBus.Subscribe("users.created", func(msg *pubsub.Message) error {
+		created++
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, memoryBus.Publish(&pubsub.Message{Subject: "users.created"}))
+	require.NoError(t, memoryBus.Publish(&pubsub.Message{Subject: "users.deleted"}))
+	require.NoError(t, memoryBus.Publish(&pubsub.Message{Subject: "accounts.created"}))
+	assert.Equal(t, []string{"users.created", "users.deleted"}, received)
+	assert.Equal(t, 1, created)
+
+	require.NoError(t, all.Unsubscribe())
+	require.NoError(t, memoryBus.Publish(&pubsub.Message{Subject: "users.created"}))
+	assert.Len(t, received, 2)
+	assert.Equal(t, 2, created)
+
+	require.NoError(t, memoryBus.Close())
+	assert.ErrorIs(t, memoryBus.Publish(&pubsub.Message{Subject: "users.created"}), memory.ErrClosed)
+}
+
+func TestOutboxRelayOverMemoryBus(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	config := bus.Config{Backend: bus.BackendMemory, Memory: memory.New()}
+	publisher, err := bus.NewPublisher(config, myLogger)
+	require.NoError(t, err)
+	subscriber, err := bus.NewSubscriber(config, myLogger)
+	require.NoError(t, err)
+
+	received := make([]string, 0)
+	_, err = subscriber.Subscribe("NewUser", func(msg *pubsub.Message) error {
+		received = append(received, string(msg.Data))
+		return nil
+	})
+	require.NoError(t, err)
+
+	relay, err := outboxService.NewRelay(newFakeOutboxRepository("first", "second"), publisher,
+		outboxService.DefaultConfig(), prometheus.NewRegistry(), myLogger)
+	require.NoError(t, err)
+
+	_, err = relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, received)
+
+	_, err = bus.NewPublisher(bus.Config{Backend: "kafka"}, myLogger)
+	assert.Error(t, err)
+}
+
+func TestWorkerPool(t *testing.T) {
+	t.Run("bound-concurrency", func(t *testing.T) {
+		pool := worker.New(worker.Config{Workers: 3, QueueSize: 3})
+		var running, maxRunning atomic.Int32
+		for i := 0; i < 12; i++ {
+			require.NoError(t, pool.Submit(context.Background(), "", func(ctx context.Context) {
+				n := running.Add(1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+			}))
+		}
+		require.NoError(t, pool.Close(context.Background()))
+		assert.Equal(t, int32(3), maxRunning.Load())
+		assert.Equal(t, 0, pool.Pending())
+	})
+	t.Run("keep-order-per-key", func(t *testing.T) {
+		pool := worker.New(worker.Config{Workers: 4, QueueSize: 8})
+		var mu sync.Mutex
+		handled := make(map[string][]int)
+		for i := 0; i < 40; i++ {
+			key, n := "user-"+strconv.Itoa(i%3), i
+			require.NoError(t, pool.Submit(context.Background(), key, func(ctx context.Context) {
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				handled[key] = append(handled[key], n)
+				mu.Unlock()
+			}))
+		}
+		require.NoError(t, pool.Close(context.Background()))
+		for key, ns := range handled {
+			assert.IsIncreasing(t, ns, key)
+		}
+	})
+	t.Run("block-when-queue-is-full", func(t *testing.T) {
+		pool := worker.New(worker.Config{Workers: 1, QueueSize: 1})
+		release := make(chan struct{})
+		block := func(ctx context.Context) { <-release }
+		require.NoError(t, pool.Submit(context.Background(), "", block))
+		require.Eventually(t, func() bool { return pool.Pending() == 1 }, time.Second, time.Millisecond)
+		require.NoError(t, pool.Submit(context.Background(), "", block), "queued behind the running job")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, pool.Submit(ctx, "", block), context.DeadlineExceeded)
+		assert.Equal(t, 2, pool.Pending())
+
+		close(release)
+		require.NoError(t, pool.Close(context.Background()))
+		assert.ErrorIs(t, pool.Submit(context.Background(), "", block), worker.ErrClosed)
+	})
+	t.Run("time-out-jobs", func(t *testing.T) {
+		pool := worker.New(worker.Config{Workers: 1, QueueSize: 1, Timeout: 10 * time.Millisecond})
+		errs := make(chan error, 1)
+		require.NoError(t, pool.Submit(context.Background(), "", func(ctx context.Context) {
+			<-ctx.Done()
+			errs <- ctx.Err()
+		}))
+		assert.ErrorIs(t, <-errs, context.DeadlineExceeded)
+		require.NoError(t, pool.Close(context.Background()))
+	})
+	t.Run("drain-on-close", func(t *testing.T) {
+		pool := worker.New(worker.Config{Workers: 2, QueueSize: 10})
+		var handled atomic.Int32
+		for i := 0; i < 10; i++ {
+			require.NoError(t, pool.Submit(context.Background(), "", func(ctx context.Context) {
+				time.Sleep(2 * time.Millisecond)
+				handled.Add(1)
+			}))
+		}
+		require.NoError(t, pool.Close(context.Background()))
+		assert.Equal(t, int32(10), handled.Load())
+	})
+	t.Run("cancel-jobs-after-drain-timeout", func(t *testing.T) {
+		pool := worker.New(worker.Config{Workers: 1, QueueSize: 2})
+		var cancelled atomic.Int32
+		for i := 0; i < 3; i++ {
+			require.NoError(t, pool.Submit(context.Background(), "", func(ctx context.Context) {
+				select {
+				case <-ctx.Done():
+					cancelled.Add(1)
+				case <-time.After(time.Minute):
+				}
+			}))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, pool.Close(ctx), context.DeadlineExceeded)
+		assert.Equal(t, int32(3), cancelled.Load(), "queued jobs still run, with a cancelled context")
+	})
+}
+
+func TestJetStreamPublisher(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	natsServer := runJetStreamServer(t)
+
+	publisher, err := pub.New(natsServer.ClientURL(), stream.DefaultUsersConfig(), myLogger)
+	require.NoError(t, err)
+	defer func() {
+		_ = publisher.Close()
+	}()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, publisher.Publish(&pubsub.Message{ID: "outbox-1", Subject: "users.created", Data: []byte("{}")}))
+	}
+	require.NoError(t, publisher.Publish(&pubsub.Message{ID: "outbox-2", Subject: "users.deleted", Data: []byte("{}")}))
+	assert.Error(t, publisher.Publish(&pubsub.Message{Subject: "accounts.created"}), "subject outside of the stream")
+
+	js, err := publisher.Conn.JetStream()
+	require.NoError(t, err)
+	info, err := js.StreamInfo("USERS")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), info.State.Msgs)
+	assert.Equal(t, 2*time.Minute, info.Config.Duplicates)
+
+	// Declaring the stream again, as the second service does on start, keeps the stored messages.
+	again, err := pub.New(natsServer.ClientURL(), stream.DefaultUsersConfig(), myLogger)
+	require.NoError(t, err)
+	require.NoError(t, again.Close())
+	info, err = js.StreamInfo("USERS")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), info.State.Msgs)
+}
+
+func runJetStreamServer(t *testing.T) *server.Server {
+	natsServer, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	require.NoError(t, err)
+	go natsServer.Start()
+	require.True(t, natsServer.ReadyForConnections(5*time.Second))
+	t.Cleanup(natsServer.Shutdown)
+	return natsServer
+}
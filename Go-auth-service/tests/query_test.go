@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/user"
+	queryHandler "Golang-practice-2023/internal/transport/micro/handler"
+	"Golang-practice-2023/pkg/client"
+	"Golang-practice-2023/pkg/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+const brokenEmail = "broken@gmail.com"
+
+type queryStubService struct {
+	user.Service
+	users map[uuid.UUID]*user.User
+}
+
+func (s *queryStubService) GetById(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	if u, ok := s.users[id]; ok {
+		return u, nil
+	}
+	return nil, apperrors.ErrUserNotFound
+}
+
+func (s *queryStubService) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	if email == brokenEmail {
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, apperrors.ErrUserNotFound
+}
+
+func TestUserQueryApi(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	existing := &user.User{ID: uuid.New(), Email: "test@gmail.com", Passwordhash: "hash", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	stub := &queryStubService{users: map[uuid.UUID]*user.User{existing.ID: existing}}
+
+	natsServer := runJetStreamServer(t)
+	nc, err := nats.Connect(natsServer.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	config := queryHandler.DefaultConfig()
+	svc, err := queryHandler.New(stub, config, myLogger).Start(nc)
+	require.NoError(t, err)
+	defer svc.Stop()
+
+	queries := client.NewQueryClient(nc, client.WithQueryTimeout(2*time.Second))
+
+	t.Run("get-user", func(t *testing.T) {
+		u, err := queries.GetUser(context.Background(), existing.ID)
+
+		require.NoError(t, err)
+		assert.Equal(t, existing.ID, u.ID)
+		assert.Equal(t, existing.Email, u.Email)
+	})
+	t.Run("get-user-by-email", func(t *testing.T) {
+		u, err := queries.GetUserByEmail(context.Background(), existing.Email)
+
+		require.NoError(t, err)
+		assert.Equal(t, existing.ID, u.ID)
+	})
+	t.Run("reply-without-credentials", func(t *testing.T) {
+		reply, err := nc.Request(user.SubjectQueryGetById, []byte(`{"id":"`+existing.ID.String()+`"}`), 2*time.Second)
+		require.NoError(t, err)
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(reply.Data, &body))
+		assert.NotContains(t, body, "passwordhash")
+	})
+	t.Run("get-user-by-not-existing-id", func(t *testing.T) {
+		_, err := queries.GetUser(context.Background(), uuid.New())
+
+		var apiErr *client.Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.True(t, errors.Is(err, client.ErrUserNotFound))
+	})
+	t.Run("structured-error-reply", func(t *testing.T) {
+		reply, err := nc.Request(user.SubjectQueryGetById, []byte(`{"id":"not-a-uuid"}`), 2*time.Second)
+		require.NoError(t, err)
+
+		assert.Equal(t, "400", reply.Header.Get(micro.ErrorCodeHeader))
+		assert.Equal(t, apperrors.ErrInvalidIdFormat.Error(), reply.Header.Get(micro.ErrorHeader))
+		var body user.QueryError
+		require.NoError(t, json.Unmarshal(reply.Data, &body))
+		assert.Equal(t, user.QueryError{Code: http.StatusBadRequest, Message: apperrors.ErrInvalidIdFormat.Error()}, body)
+	})
+	t.Run("invalid-request-body", func(t *testing.T) {
+		reply, err := nc.Request(user.SubjectQueryGetByEmail, []byte(`not json`), 2*time.Second)
+		require.NoError(t, err)
+
+		assert.Equal(t, "400", reply.Header.Get(micro.ErrorCodeHeader))
+		assert.Equal(t, apperrors.ErrInvalidRequestBody.Error(), reply.Header.Get(micro.ErrorHeader))
+	})
+	t.Run("hide-internal-errors", func(t *testing.T) {
+		_, err := queries.GetUserByEmail(context.Background(), brokenEmail)
+
+		var apiErr *client.Error
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusInternalServerError, apiErr.StatusCode)
+		assert.Equal(t, "Failed to execute", apiErr.Message)
+	})
+	t.Run("discover-service", func(t *testing.T) {
+		subject, err := micro.ControlSubject(micro.InfoVerb, config.Name, "")
+		require.NoError(t, err)
+		reply, err := nc.Request(subject, nil, 2*time.Second)
+		require.NoError(t, err)
+
+		var info micro.Info
+		require.NoError(t, json.Unmarshal(reply.Data, &info))
+		assert.Equal(t, config.Version, info.Version)
+		assert.ElementsMatch(t, []string{user.SubjectQueryGetById, user.SubjectQueryGetByEmail}, info.Subjects)
+	})
+	t.Run("endpoint-schemas", func(t *testing.T) {
+		subject, err := micro.ControlSubject(micro.SchemaVerb, config.Name, "")
+		require.NoError(t, err)
+		reply, err := nc.Request(subject, nil, 2*time.Second)
+		require.NoError(t, err)
+
+		var schemas micro.SchemaResp
+		require.NoError(t, json.Unmarshal(reply.Data, &schemas))
+		require.Len(t, schemas.Endpoints, 2)
+		for _, endpoint := range schemas.Endpoints {
+			assert.True(t, json.Valid([]byte(endpoint.Schema.Request)), endpoint.Subject)
+			assert.True(t, json.Valid([]byte(endpoint.Schema.Response)), endpoint.Subject)
+		}
+	})
+	t.Run("error-stats", func(t *testing.T) {
+		subject, err := micro.ControlSubject(micro.StatsVerb, config.Name, "")
+		require.NoError(t, err)
+		reply, err := nc.Request(subject, nil, 2*time.Second)
+		require.NoError(t, err)
+
+		var stats micro.Stats
+		require.NoError(t, json.Unmarshal(reply.Data, &stats))
+		errorsBySubject := map[string]map[string]int{}
+		for _, endpoint := range stats.Endpoints {
+			var data struct {
+				Errors map[string]int `json:"errors"`
+			}
+			require.NoError(t, json.Unmarshal(endpoint.Data, &data))
+			errorsBySubject[endpoint.Subject] = data.Errors
+			assert.Positive(t, endpoint.NumRequests)
+		}
+		assert.Equal(t, map[string]int{"404": 1, "400": 1}, errorsBySubject[user.SubjectQueryGetById])
+		assert.Equal(t, map[string]int{"400": 1, "500": 1}, errorsBySubject[user.SubjectQueryGetByEmail])
+	})
+}
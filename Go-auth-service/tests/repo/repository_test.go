@@ -17,7 +17,7 @@ type TestComponent struct {
 
 func (tc *TestComponent) TestRepositoryCreate(ctx context.Context, repository user.Repository, t *testing.T) {
 	testUser := testUser1()
-	err := tc.repository.Create(ctx, testUser)
+	err := tc.repository.Create(ctx, testUser, nil)
 	require.NoError(t, err)
 
 	query := "SELECT id, email, passwordhash FROM account WHERE id=$1"
@@ -31,7 +31,7 @@ func (tc *TestComponent) TestRepositoryCreate(ctx context.Context, repository us
 
 func (tc *TestComponent) TestRepositoryGetById(ctx context.Context, t *testing.T) {
 	testUser := testUser1()
-	err := tc.repository.Create(ctx, testUser)
+	err := tc.repository.Create(ctx, testUser, nil)
 
 	query := "SELECT id, email, passwordhash FROM account WHERE id=$1"
 	var returnedUser user.User
@@ -54,7 +54,7 @@ func (tc *TestComponent) TestRepositoryGetByIdFailOnInvalidId(ctx context.Contex
 
 func (tc *TestComponent) TestRepositoryUpdate(ctx context.Context, t *testing.T) {
 	testUser := testUser1()
-	err := tc.repository.Create(ctx, testUser)
+	err := tc.repository.Create(ctx, testUser, nil)
 	testUser2 := testUser2()
 
 	query := "UPDATE account SET email=$1, passwordhash=$2 WHERE id=$3"
@@ -68,7 +68,7 @@ func (tc *TestComponent) TestRepositoryUpdate(ctx context.Context, t *testing.T)
 
 func (tc *TestComponent) TestRepositoryDelete(ctx context.Context, t *testing.T) {
 	testUser := testUser1WithId()
-	err := tc.repository.Create(ctx, testUser)
+	err := tc.repository.Create(ctx, testUser, nil)
 
 	query := "DELETE FROM account WHERE id=$3"
 	var returnedUser user.User
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+	deprecation := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, 4, 30, 0, 0, 0, 0, time.UTC)
+
+	handle := func(name string) handler.RoutesInitializer {
+		return func(router *mux.Router) {
+			router.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(name))
+			}).Methods(http.MethodGet)
+		}
+	}
+	v1 := handler.Version{
+		Name:        "v1",
+		Deprecation: &deprecation,
+		Sunset:      &sunset,
+		Successor:   "v2",
+		Routes:      []handler.RoutesInitializer{handle("v1")},
+	}
+	v2 := handler.Version{Name: "v2", Routes: []handler.RoutesInitializer{handle("v2")}}
+
+	router := mux.NewRouter()
+	handler.InitVersionedRoutes(router, v1, v2)
+	router.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {})
+	handler.InitLegacyRoutes(router, v1, deprecation, &sunset)
+
+	t.Run("current-version", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/v2/user", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "v2", rr.Body.String())
+		assert.Empty(t, rr.Header().Get("Deprecation"))
+	})
+	t.Run("deprecated-version", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/user", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "v1", rr.Body.String())
+		assert.Equal(t, "@1792368000", rr.Header().Get("Deprecation"))
+		assert.Equal(t, "Fri, 30 Apr 2027 00:00:00 GMT", rr.Header().Get("Sunset"))
+		assert.Equal(t, `</v2>; rel="successor-version"`, rr.Header().Get("Link"))
+	})
+	t.Run("legacy-path", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/user", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "v1", rr.Body.String())
+		assert.Equal(t, "@1792368000", rr.Header().Get("Deprecation"))
+		assert.Equal(t, `</v1/user>; rel="successor-version"`, rr.Header().Get("Link"))
+	})
+	t.Run("unversioned-route-untouched", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("Deprecation"))
+	})
+	t.Run("unknown-path", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/v3/user", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
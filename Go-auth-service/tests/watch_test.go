@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/pkg/logger"
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestUserWatch(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	t.Run("close-watcher-that-falls-behind", func(t *testing.T) {
+		userService, err := NewUserService(&outboxCapturingRepository{}, myLogger)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		changes := userService.Watch(ctx)
+
+		u := &user.User{Email: "watch@gmail.com", Passwordhash: "password1"}
+		require.NoError(t, userService.Create(ctx, u))
+		for i := 0; i < 64; i++ {
+			require.NoError(t, userService.Update(ctx, &user.User{ID: u.ID, Email: "watch@gmail.com", Passwordhash: "password1"}))
+		}
+
+		received := 0
+		for range changes {
+			received++
+		}
+		assert.Equal(t, 64, received, "the buffered changes are kept, the watcher is closed instead of skipping one")
+	})
+	t.Run("keep-watcher-that-keeps-up", func(t *testing.T) {
+		userService, err := NewUserService(&outboxCapturingRepository{}, myLogger)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		changes := userService.Watch(ctx)
+
+		u := &user.User{Email: "watch@gmail.com", Passwordhash: "password1"}
+		require.NoError(t, userService.Create(ctx, u))
+		assert.Equal(t, user.ChangeCreated, (<-changes).Type)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, userService.Update(ctx, &user.User{ID: u.ID, Email: "watch@gmail.com", Passwordhash: "password1"}))
+			change, ok := <-changes
+			require.True(t, ok)
+			assert.Equal(t, user.ChangeUpdated, change.Type)
+		}
+
+		cancel()
+		_, ok := <-changes
+		assert.False(t, ok, "the changes are closed with the context")
+	})
+}
@@ -0,0 +1,454 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/domain/webhook"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/internal/transport/rest/middleware"
+	webhookService "Golang-practice-2023/internal/webhook/service"
+	"Golang-practice-2023/pkg/logger"
+	signature "Golang-practice-2023/pkg/webhook"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	config := webhookService.DefaultConfig()
+	config.MaxAttempts = 3
+	config.BaseBackoff = 0
+	config.Timeout = time.Second
+	config.AllowPrivateNetworks = true
+
+	t.Run("deliver-signed-event", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusOK)
+		defer receiver.Close()
+		service := webhookService.New(newFakeWebhookRepository(), config, myLogger)
+
+		subscription := &webhook.Subscription{URL: receiver.URL, EventTypes: []webhook.EventType{webhook.EventUserCreated}}
+		require.NoError(t, service.Subscribe(context.Background(), subscription))
+		require.NotEmpty(t, subscription.Secret)
+
+		u := user.User{ID: uuid.New(), Email: "hook@gmail.com", Passwordhash: "secret-hash"}
+		require.NoError(t, service.OnUserChange(context.Background(), nil, user.Change{Type: user.ChangeCreated, User: u,
+			OccurredAt: time.Now()}))
+
+		sent, err := service.DeliverDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, sent)
+
+		requests := receiver.Requests()
+		require.Len(t, requests, 1)
+		assert.NoError(t, signature.Verify(subscription.Secret, requests[0].header, requests[0].body, time.Minute))
+		assert.Equal(t, string(webhook.EventUserCreated), requests[0].header.Get(signature.EventHeader))
+		assert.NotContains(t, string(requests[0].body), "secret-hash")
+
+		var event webhook.Event
+		require.NoError(t, json.Unmarshal(requests[0].body, &event))
+		assert.Equal(t, webhook.EventUserCreated, event.Type)
+
+		deliveries, err := service.GetDeliveries(context.Background(), subscription.ID, webhook.DeliveryFilter{})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, webhook.DeliverySucceeded, deliveries[0].Status)
+		assert.Equal(t, requests[0].header.Get(signature.DeliveryHeader), deliveries[0].ID.String())
+	})
+	t.Run("skip-unsubscribed-event-types", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusOK)
+		defer receiver.Close()
+		service := webhookService.New(newFakeWebhookRepository(), config, myLogger)
+
+		subscription := &webhook.Subscription{URL: receiver.URL, EventTypes: []webhook.EventType{webhook.EventUserDeleted}}
+		require.NoError(t, service.Subscribe(context.Background(), subscription))
+
+		require.NoError(t, service.OnUserChange(context.Background(), nil, user.Change{Type: user.ChangeCreated,
+			User: user.User{ID: uuid.New()}}))
+
+		sent, err := service.DeliverDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+	})
+	t.Run("retry-then-dead-letter-then-redeliver", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusInternalServerError)
+		defer receiver.Close()
+		service := webhookService.New(newFakeWebhookRepository(), config, myLogger)
+
+		subscription := &webhook.Subscription{URL: receiver.URL, EventTypes: []webhook.EventType{webhook.EventUserUpdated}}
+		require.NoError(t, service.Subscribe(context.Background(), subscription))
+		require.NoError(t, service.Publish(context.Background(), webhook.EventUserUpdated, map[string]string{"id": "1"}))
+
+		for i := 0; i < config.MaxAttempts; i++ {
+			sent, err := service.DeliverDue(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, sent)
+		}
+		sent, err := service.DeliverDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, sent)
+		assert.Len(t, receiver.Requests(), config.MaxAttempts)
+
+		deliveries, err := service.GetDeliveries(context.Background(), subscription.ID, webhook.DeliveryFilter{Status: webhook.DeliveryDead})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, http.StatusInternalServerError, *deliveries[0].LastStatusCode)
+
+		receiver.SetStatus(http.StatusNoContent)
+		redelivered, err := service.Redeliver(context.Background(), subscription.ID, deliveries[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, webhook.DeliveryPending, redelivered.Status)
+
+		sent, err = service.DeliverDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, sent)
+
+		delivery, err := service.GetDelivery(context.Background(), subscription.ID, deliveries[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, webhook.DeliverySucceeded, delivery.Status)
+		assert.Len(t, delivery.History, config.MaxAttempts+1)
+	})
+	t.Run("reject-tampered-signature", func(t *testing.T) {
+		body := []byte(`{"type":"user.created"}`)
+		header := http.Header{}
+		now := time.Now()
+		header.Set(signature.TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+		header.Set(signature.SignatureHeader, signature.Sign("secret", now, body))
+
+		assert.NoError(t, signature.Verify("secret", header, body, time.Minute))
+		assert.ErrorIs(t, signature.Verify("secret", header, []byte(`{"type":"user.deleted"}`), time.Minute), signature.ErrInvalidSignature)
+		assert.ErrorIs(t, signature.Verify("other", header, body, time.Minute), signature.ErrInvalidSignature)
+
+		old := now.Add(-time.Hour)
+		header.Set(signature.TimestampHeader, strconv.FormatInt(old.Unix(), 10))
+		header.Set(signature.SignatureHeader, signature.Sign("secret", old, body))
+		assert.ErrorIs(t, signature.Verify("secret", header, body, time.Minute), signature.ErrStaleTimestamp)
+	})
+	t.Run("reject-private-addresses", func(t *testing.T) {
+		service := webhookService.New(newFakeWebhookRepository(), webhookService.DefaultConfig(), myLogger)
+
+		for _, url := range []string{
+			"http://127.0.0.1/hook",
+			"http://localhost:8080/hook",
+			"http://10.0.0.1/hook",
+			"http://192.168.1.1/hook",
+			"http://169.254.169.254/latest/meta-data",
+			"http://0.0.0.0/hook",
+			"http://[::1]/hook",
+			"http://[fe80::1]/hook",
+			"http://[::ffff:127.0.0.1]/hook",
+		} {
+			subscription := &webhook.Subscription{URL: url, EventTypes: []webhook.EventType{webhook.EventUserCreated}}
+			assert.ErrorIs(t, service.Subscribe(context.Background(), subscription), apperrors.ErrWebhookURLNotAllowed, url)
+		}
+	})
+	t.Run("refuse-private-address-on-delivery", func(t *testing.T) {
+		receiver := newWebhookReceiver(http.StatusOK)
+		defer receiver.Close()
+		deliveryConfig := config
+		deliveryConfig.AllowPrivateNetworks = false
+		repository := newFakeWebhookRepository()
+		service := webhookService.New(repository, deliveryConfig, myLogger)
+
+		// Stored directly, like a subscription whose host was rebound to a private address after validation.
+		subscription := &webhook.Subscription{URL: receiver.URL, EventTypes: []webhook.EventType{webhook.EventUserCreated}, Secret: "secret"}
+		require.NoError(t, repository.CreateSubscription(context.Background(), subscription))
+
+		require.NoError(t, service.OnUserChange(context.Background(), nil, user.Change{Type: user.ChangeCreated,
+			User: user.User{ID: uuid.New()}, OccurredAt: time.Now()}))
+
+		sent, err := service.DeliverDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, sent)
+		assert.Empty(t, receiver.Requests())
+
+		deliveries, err := service.GetDeliveries(context.Background(), subscription.ID, webhook.DeliveryFilter{})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Contains(t, deliveries[0].LastError, apperrors.ErrWebhookURLNotAllowed.Error())
+	})
+	t.Run("handler-reject-invalid-subscription", func(t *testing.T) {
+		service := webhookService.New(newFakeWebhookRepository(), config, myLogger)
+		router := mux.NewRouter()
+		handler.NewWebhookHandler(service, myLogger).InitRoutes(router)
+
+		for _, body := range []string{
+			`{"url": "not a url", "event_types": ["user.created"]}`,
+			`{"url": "http://localhost/hook", "event_types": ["user.renamed"]}`,
+			`{"url": "http://localhost/hook", "event_types": []}`,
+		} {
+			req, _ := http.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", contentType)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusBadRequest, rr.Code, body)
+		}
+	})
+	t.Run("handler-unknown-subscription", func(t *testing.T) {
+		service := webhookService.New(newFakeWebhookRepository(), config, myLogger)
+		router := mux.NewRouter()
+		handler.NewWebhookHandler(service, myLogger).InitRoutes(router)
+
+		req, _ := http.NewRequest(http.MethodGet, "/webhook/"+uuid.NewString()+"/delivery", nil)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+	t.Run("handler-require-admin-token", func(t *testing.T) {
+		service := webhookService.New(newFakeWebhookRepository(), config, myLogger)
+		router := mux.NewRouter()
+		admin := router.PathPrefix("/admin").Subrouter()
+		admin.Use(middleware.AdminToken("secret", myLogger))
+		handler.NewWebhookHandler(service, myLogger).InitRoutes(admin)
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/webhook", nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		for _, authorization := range []string{"secret", "Basic secret", "Bearer secret2", "Bearer  secret"} {
+			req = httptest.NewRequest(http.MethodGet, "/admin/webhook", nil)
+			req.Header.Set("Authorization", authorization)
+			rec = httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, authorization)
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/admin/webhook", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedWebhook
+}
+
+func newWebhookReceiver(status int) *webhookReceiver {
+	receiver := &webhookReceiver{status: status}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		receiver.mu.Lock()
+		receiver.requests = append(receiver.requests, receivedWebhook{header: r.Header.Clone(), body: body})
+		status := receiver.status
+		receiver.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	return receiver
+}
+
+func (r *webhookReceiver) SetStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *webhookReceiver) Requests() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+// fakeWebhookRepository keeps subscriptions and deliveries in memory so that the dispatcher can be
+// tested without Postgres.
+type fakeWebhookRepository struct {
+	mu            sync.Mutex
+	subscriptions []*webhook.Subscription
+	deliveries    []*webhook.Delivery
+}
+
+func newFakeWebhookRepository() *fakeWebhookRepository {
+	return &fakeWebhookRepository{}
+}
+
+func (r *fakeWebhookRepository) CreateSubscription(ctx context.Context, subscription *webhook.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscription.ID = uuid.New()
+	subscription.CreatedAt = time.Now()
+	stored := *subscription
+	r.subscriptions = append(r.subscriptions, &stored)
+	return nil
+}
+
+func (r *fakeWebhookRepository) GetSubscription(ctx context.Context, id uuid.UUID) (*webhook.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.subscriptions {
+		if s.ID == id {
+			subscription := *s
+			return &subscription, nil
+		}
+	}
+	return nil, apperrors.ErrWebhookNotFound
+}
+
+func (r *fakeWebhookRepository) GetSubscriptions(ctx context.Context) ([]webhook.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscriptions := make([]webhook.Subscription, 0, len(r.subscriptions))
+	for _, s := range r.subscriptions {
+		subscriptions = append(subscriptions, *s)
+	}
+	return subscriptions, nil
+}
+
+func (r *fakeWebhookRepository) GetSubscriptionsForEvent(ctx context.Context, eventType webhook.EventType) ([]webhook.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscriptions := make([]webhook.Subscription, 0)
+	for _, s := range r.subscriptions {
+		if s.Wants(eventType) {
+			subscriptions = append(subscriptions, *s)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (r *fakeWebhookRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, s := range r.subscriptions {
+		if s.ID == id {
+			r.subscriptions = append(r.subscriptions[:i], r.subscriptions[i+1:]...)
+			return nil
+		}
+	}
+	return apperrors.ErrWebhookNotFound
+}
+
+func (r *fakeWebhookRepository) CreateDeliveries(ctx context.Context, deliveries []*webhook.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range deliveries {
+		d.ID = uuid.New()
+		d.Status = webhook.DeliveryPending
+		d.CreatedAt = time.Now()
+		d.UpdatedAt = d.CreatedAt
+		d.NextAttemptAt = d.CreatedAt
+		stored := *d
+		r.deliveries = append(r.deliveries, &stored)
+	}
+	return nil
+}
+
+// QueueDeliveries ignores the transaction, the tests call it with none.
+func (r *fakeWebhookRepository) QueueDeliveries(ctx context.Context, tx *sqlx.Tx, eventType webhook.EventType, payload []byte) error {
+	subscriptions, _ := r.GetSubscriptionsForEvent(ctx, eventType)
+	deliveries := make([]*webhook.Delivery, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		deliveries = append(deliveries, &webhook.Delivery{SubscriptionID: subscription.ID, EventType: eventType, Payload: payload})
+	}
+	return r.CreateDeliveries(ctx, deliveries)
+}
+
+func (r *fakeWebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]webhook.DueDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	due := make([]webhook.DueDelivery, 0)
+	now := time.Now()
+	for _, d := range r.deliveries {
+		if len(due) == limit {
+			break
+		}
+		if d.Status != webhook.DeliveryPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		for _, s := range r.subscriptions {
+			if s.ID == d.SubscriptionID {
+				d.NextAttemptAt = now.Add(lease)
+				due = append(due, webhook.DueDelivery{Delivery: *d, URL: s.URL, Secret: s.Secret})
+			}
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeWebhookRepository) RecordAttempt(ctx context.Context, delivery *webhook.Delivery, attempt webhook.Attempt, retryIn time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		if d.ID == delivery.ID {
+			history := append(d.History, attempt)
+			delivery.NextAttemptAt = time.Now().Add(retryIn)
+			delivery.UpdatedAt = time.Now()
+			*d = *delivery
+			d.History = history
+			return nil
+		}
+	}
+	return apperrors.ErrWebhookDeliveryNotFound
+}
+
+func (r *fakeWebhookRepository) GetDeliveries(ctx context.Context, subscriptionId uuid.UUID, filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deliveries := make([]webhook.Delivery, 0)
+	for _, d := range r.deliveries {
+		if d.SubscriptionID == subscriptionId && (filter.Status == "" || d.Status == filter.Status) {
+			delivery := *d
+			delivery.History = nil
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *fakeWebhookRepository) GetDelivery(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*webhook.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		if d.ID == id && d.SubscriptionID == subscriptionId {
+			delivery := *d
+			return &delivery, nil
+		}
+	}
+	return nil, apperrors.ErrWebhookDeliveryNotFound
+}
+
+func (r *fakeWebhookRepository) ResetDelivery(ctx context.Context, subscriptionId uuid.UUID, id uuid.UUID) (*webhook.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		if d.ID == id && d.SubscriptionID == subscriptionId {
+			d.Status = webhook.DeliveryPending
+			d.Attempts = 0
+			d.NextAttemptAt = time.Now()
+			delivery := *d
+			return &delivery, nil
+		}
+	}
+	return nil, apperrors.ErrWebhookDeliveryNotFound
+}
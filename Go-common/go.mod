@@ -0,0 +1,3 @@
+module Go-common
+
+go 1.19
@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+const bearerPrefix = "Bearer "
+
+// BearerToken only lets requests through whose Authorization header is exactly "Bearer <token>"; the others are
+// answered by unauthorized. An empty token refuses every request.
+func BearerToken(token string, unauthorized http.Handler) func(http.Handler) http.Handler {
+	expected := []byte(bearerPrefix + token)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := []byte(r.Header.Get("Authorization"))
+			if token == "" || subtle.ConstantTimeCompare(provided, expected) != 1 {
+				unauthorized.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	jobRepository "Go-scheduler-service/internal/job/repository"
+	"Go-scheduler-service/internal/user/job"
 	"Go-scheduler-service/internal/user/repository"
 	"Go-scheduler-service/internal/user/service"
 	"Go-scheduler-service/pkg/health"
 	"Go-scheduler-service/pkg/logger"
 	"Go-scheduler-service/pkg/migration"
 	"Go-scheduler-service/pkg/pgconnect"
-	scheduler2 "Go-scheduler-service/pkg/scheduler"
+	"Go-scheduler-service/pkg/scheduler"
+	"Golang-practice-2023/pkg/client"
 	"context"
 	"errors"
 	"fmt"
@@ -82,9 +85,37 @@ func main() {
 	userRepository := repository.New(db, myLogger)
 	userService := service.New(userRepository, myLogger)
 
-	scheduler := scheduler2.New(userService, "go-auth", 8080, "/user", 1, 5, myLogger)
+	authClientOptions := []client.Option{client.WithTimeout(5 * time.Second), client.WithRetries(3, time.Second)}
+	if apiKey := os.Getenv("AUTH_API_KEY"); apiKey != "" {
+		authClientOptions = append(authClientOptions, client.WithAPIKey("", apiKey))
+	}
+	authClient, err := client.New(fmt.Sprintf("http://%s:%s", os.Getenv("AUTH_HOST"), os.Getenv("AUTH_PORT")), authClientOptions...)
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to create auth client: %s", err.Error()))
+	}
+
+	registry := scheduler.NewRegistry()
+	if err := registry.Register(job.NewUserSync(userService, authClient, 500, myLogger)); err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to register job: %s", err.Error()))
+	}
+
+	jobsConfigPath := os.Getenv("JOBS_CONFIG")
+	if jobsConfigPath == "" {
+		jobsConfigPath = "jobs.yaml"
+	}
+	jobsConfig, err := scheduler.LoadConfig(jobsConfigPath)
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to load jobs config: %s", err.Error()))
+	}
+	jobScheduler, err := scheduler.New(jobsConfig, registry, jobRepository.New(db, myLogger), myLogger)
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to create scheduler: %s", err.Error()))
+	}
+	schedulerCtx, stopScheduler := context.WithCancel(ctx)
+	schedulerStopped := make(chan struct{})
 	go func() {
-		scheduler.ScheduleUsers(ctx)
+		jobScheduler.Run(schedulerCtx)
+		close(schedulerStopped)
 	}()
 
 	srv := &http.Server{
@@ -134,4 +165,12 @@ func main() {
 	if err != nil {
 		myLogger.Fatal("Could not shutdown the server (after getting signal): " + err.Error())
 	}
+
+	// Running jobs are cancelled and get until the shutdown timeout to return.
+	stopScheduler()
+	select {
+	case <-schedulerStopped:
+	case <-ctx2.Done():
+		myLogger.Warning("Jobs did not stop in time")
+	}
 }
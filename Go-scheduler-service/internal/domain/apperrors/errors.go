@@ -4,8 +4,9 @@ import "errors"
 
 var ErrUserNotFound = errors.New("user not found")
 var ErrAlreadyRegisteredUserEmail = errors.New("user with the email already exists")
+var ErrStaleUser = errors.New("user is older than the stored copy")
+var ErrCheckpointNotFound = errors.New("sync checkpoint not found")
 var ErrInvalidEmailFormat = errors.New("email validation failed")
-var ErrInvalidPasswordFormat = errors.New("password validation failed")
 var ErrInvalidRequestFormat = errors.New("invalid request format")
 var ErrInvalidRequestBody = errors.New("invalid request body")
 var ErrInvalidIdFormat = errors.New("invalid id format (not uuid)")
@@ -0,0 +1,17 @@
+package user
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// SourceAuthUsers is the checkpoint of the users copied from the auth service.
+const SourceAuthUsers = "auth-users"
+
+// Checkpoint is the (CreatedAt, ID) cursor of the last user synced from a source.
+type Checkpoint struct {
+	Source    string    `db:"source"`
+	CreatedAt time.Time `db:"createdat"`
+	ID        uuid.UUID `db:"userid"`
+	UpdatedAt time.Time `db:"updatedat"`
+}
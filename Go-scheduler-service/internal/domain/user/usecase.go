@@ -8,6 +8,8 @@ import (
 type Service interface {
 	Create(ctx context.Context, user *User) error
 	Save(ctx context.Context, user *User) error
+	SaveBatch(ctx context.Context, users []User, checkpoint Checkpoint) (int, error)
+	GetCheckpoint(ctx context.Context, source string) (*Checkpoint, error)
 	GetById(ctx context.Context, id uuid.UUID) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetWithOffsetAndLimit(ctx context.Context, offset int, limit int) (*[]User, error)
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"Go-scheduler-service/internal/domain/apperrors"
+	"Go-scheduler-service/internal/domain/logger"
+	"Go-scheduler-service/pkg/scheduler"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Repository keeps the scheduler state in the job_state table. Times are stored in UTC.
+type Repository struct {
+	db     *sqlx.DB
+	logger logger.Logger
+}
+
+func New(db *sqlx.DB, logger logger.Logger) *Repository {
+	return &Repository{db: db, logger: logger}
+}
+
+func (r *Repository) LastFire(ctx context.Context, job string) (time.Time, error) {
+	query := "SELECT lastFireAt FROM job_state WHERE name=$1"
+
+	var lastFire time.Time
+	err := r.db.GetContext(ctx, &lastFire, query, job)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return time.Time{}, apperrors.ErrDbQueryProcessing
+	}
+
+	return lastFire, nil
+}
+
+func (r *Repository) RecordFire(ctx context.Context, job string, scheduledAt time.Time) error {
+	query := `INSERT INTO job_state (name, lastFireAt) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET lastFireAt=EXCLUDED.lastFireAt, updatedAt=current_timestamp
+		WHERE job_state.lastFireAt < EXCLUDED.lastFireAt`
+
+	if _, err := r.db.ExecContext(ctx, query, job, scheduledAt.UTC()); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+// RecordRun upserts the state, as the activation of the run may not have been recorded when RecordFire failed.
+func (r *Repository) RecordRun(ctx context.Context, job string, run scheduler.Run) error {
+	query := `INSERT INTO job_state (name, lastFireAt, lastScheduledAt, lastStartedAt, lastFinishedAt, lastError)
+		VALUES ($1, $2, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET lastScheduledAt=EXCLUDED.lastScheduledAt, lastStartedAt=EXCLUDED.lastStartedAt,
+		lastFinishedAt=EXCLUDED.lastFinishedAt, lastError=EXCLUDED.lastError, updatedAt=current_timestamp`
+
+	lastError := ""
+	if run.Err != nil {
+		lastError = run.Err.Error()
+	}
+	result, err := r.db.ExecContext(ctx, query, job, run.ScheduledAt.UTC(), run.StartedAt.UTC(), run.FinishedAt.UTC(), lastError)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	if rowsAffected == 0 {
+		r.logger.Warning(fmt.Sprintf("The run of job %s was not recorded", job))
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package job
+
+import (
+	"Go-scheduler-service/internal/domain/apperrors"
+	"Go-scheduler-service/internal/domain/logger"
+	"Go-scheduler-service/internal/domain/user"
+	"Golang-practice-2023/pkg/client"
+	"context"
+	"fmt"
+)
+
+const UserSyncName = "user-sync"
+
+// UserSync copies the users registered in the auth service into the local account table.
+type UserSync struct {
+	userService user.Service
+	authClient  *client.Client
+	pageSize    int
+	logger      logger.Logger
+}
+
+func NewUserSync(userService user.Service, authClient *client.Client, pageSize int, logger logger.Logger) *UserSync {
+	return &UserSync{
+		userService: userService,
+		authClient:  authClient,
+		pageSize:    pageSize,
+		logger:      logger,
+	}
+}
+
+func (j *UserSync) Name() string {
+	return UserSyncName
+}
+
+// Run copies the users registered after the checkpoint, page by page until it is caught up. Every page is saved
+// together with the checkpoint at its last user, so an interrupted sync resumes after the last saved page.
+func (j *UserSync) Run(ctx context.Context) error {
+	checkpoint, err := j.userService.GetCheckpoint(ctx, user.SourceAuthUsers)
+	if err == apperrors.ErrCheckpointNotFound {
+		checkpoint = &user.Checkpoint{Source: user.SourceAuthUsers}
+	} else if err != nil {
+		return err
+	}
+
+	fetched, saved := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		users, err := j.getNewUsers(ctx, checkpoint)
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		last := users[len(users)-1]
+		next := user.Checkpoint{Source: checkpoint.Source, CreatedAt: last.CreatedAt, ID: last.ID}
+		n, err := j.userService.SaveBatch(ctx, users, next)
+		if err != nil {
+			return err
+		}
+		checkpoint = &next
+		fetched += len(users)
+		saved += n
+
+		if len(users) < j.pageSize {
+			break
+		}
+	}
+
+	if fetched > 0 {
+		j.logger.Info(fmt.Sprintf("Synced %d users (%d written), checkpoint at %s / %s", fetched, saved,
+			checkpoint.CreatedAt, checkpoint.ID))
+	} else {
+		j.logger.Debug("No more users")
+	}
+	return nil
+}
+
+func (j *UserSync) getNewUsers(ctx context.Context, checkpoint *user.Checkpoint) ([]user.User, error) {
+	j.logger.Debug(fmt.Sprintf("Send query to get users registered after %s / %s ...", checkpoint.CreatedAt, checkpoint.ID))
+
+	authUsers, err := j.authClient.ListUsersAfter(ctx, checkpoint.CreatedAt, checkpoint.ID, j.pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]user.User, 0, len(authUsers))
+	for _, u := range authUsers {
+		users = append(users, user.User{
+			ID:        u.ID,
+			Email:     u.Email,
+			CreatedAt: u.CreatedAt,
+			UpdatedAt: u.UpdatedAt,
+		})
+	}
+
+	return users, nil
+}
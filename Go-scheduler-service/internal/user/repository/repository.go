@@ -6,8 +6,11 @@ import (
 	"Go-scheduler-service/internal/domain/user"
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type Repository struct {
@@ -28,9 +31,9 @@ func (r *Repository) Create(ctx context.Context, user *user.User) error {
 		return apperrors.ErrAlreadyRegisteredUserEmail
 	}
 
-	query := "INSERT INTO account (email, passwordhash) VALUES ($1, $2) RETURNING id, createdAt, updatedAt"
+	query := "INSERT INTO account (email) VALUES ($1) RETURNING id, createdAt, updatedAt"
 
-	row := r.db.QueryRowContext(ctx, query, user.Email, user.Passwordhash)
+	row := r.db.QueryRowContext(ctx, query, user.Email)
 	err := row.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		r.logger.Warning(err.Error())
@@ -40,25 +43,108 @@ func (r *Repository) Create(ctx context.Context, user *user.User) error {
 	return nil
 }
 
+// Save upserts a user copied from the auth service under its source id, keeping its timestamps. A copy
+// older than the stored one fails with ErrStaleUser and leaves the row as is.
 func (r *Repository) Save(ctx context.Context, user *user.User) error {
-	if u, _ := r.GetByEmail(ctx, user.Email); u != nil {
-		return apperrors.ErrAlreadyRegisteredUserEmail
-	}
+	return r.save(ctx, r.db, user)
+}
 
-	query := "INSERT INTO account (email, passwordhash, createdat, updatedat) VALUES ($1, $2, $3, $4) RETURNING id"
+func (r *Repository) save(ctx context.Context, db sqlx.ExecerContext, user *user.User) error {
+	query := `INSERT INTO account (id, email, createdAt, updatedAt) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET email=EXCLUDED.email, createdAt=EXCLUDED.createdAt, updatedAt=EXCLUDED.updatedAt
+		WHERE account.updatedAt <= EXCLUDED.updatedAt`
 
-	row := r.db.QueryRowContext(ctx, query, user.Email, user.Passwordhash, user.CreatedAt, user.UpdatedAt)
-	err := row.Scan(&user.ID)
+	result, err := db.ExecContext(ctx, query, user.ID, user.Email, user.CreatedAt, user.UpdatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "account_email_key" {
+		return apperrors.ErrAlreadyRegisteredUserEmail
+	}
 	if err != nil {
 		r.logger.Warning(err.Error())
 		return apperrors.ErrDbQueryProcessing
 	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.ErrDbQueryProcessing
+	}
+	if rowsAffected == 0 {
+		return apperrors.ErrStaleUser
+	}
+
 	return nil
 }
 
+// SaveBatch saves a page of synced users and moves the checkpoint of their source to the end of the page in
+// one transaction, so a crash never leaves the checkpoint ahead of the users. Stale copies are left as they
+// are and users whose email is taken are skipped with a warning. It returns the number of users written.
+func (r *Repository) SaveBatch(ctx context.Context, users []user.User, checkpoint user.Checkpoint) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return 0, apperrors.ErrDbQueryProcessing
+	}
+	defer tx.Rollback()
+
+	saved := 0
+	for i := range users {
+		// The savepoint keeps the transaction usable after a unique violation.
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT sync_user"); err != nil {
+			r.logger.Warning(err.Error())
+			return 0, apperrors.ErrDbQueryProcessing
+		}
+		err := r.save(ctx, tx, &users[i])
+		release := "RELEASE SAVEPOINT sync_user"
+		switch err {
+		case nil:
+			saved++
+		case apperrors.ErrStaleUser:
+		case apperrors.ErrAlreadyRegisteredUserEmail:
+			r.logger.Warning(fmt.Sprintf("Skipping synced user %s: %s", users[i].ID, err))
+			release = "ROLLBACK TO SAVEPOINT sync_user; RELEASE SAVEPOINT sync_user"
+		default:
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, release); err != nil {
+			r.logger.Warning(err.Error())
+			return 0, apperrors.ErrDbQueryProcessing
+		}
+	}
+
+	query := `INSERT INTO sync_checkpoint (source, createdAt, userId) VALUES ($1, $2, $3)
+		ON CONFLICT (source) DO UPDATE SET createdAt=EXCLUDED.createdAt, userId=EXCLUDED.userId, updatedAt=current_timestamp
+		WHERE (sync_checkpoint.createdAt, sync_checkpoint.userId) < (EXCLUDED.createdAt, EXCLUDED.userId)`
+	if _, err := tx.ExecContext(ctx, query, checkpoint.Source, checkpoint.CreatedAt, checkpoint.ID); err != nil {
+		r.logger.Warning(err.Error())
+		return 0, apperrors.ErrDbQueryProcessing
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return 0, apperrors.ErrDbQueryProcessing
+	}
+
+	return saved, nil
+}
+
+func (r *Repository) GetCheckpoint(ctx context.Context, source string) (*user.Checkpoint, error) {
+	query := "SELECT source, createdAt, userId, updatedAt FROM sync_checkpoint WHERE source=$1"
+
+	var checkpoint user.Checkpoint
+	err := r.db.GetContext(ctx, &checkpoint, query, source)
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrCheckpointNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return &checkpoint, nil
+}
+
 func (r *Repository) GetById(ctx context.Context, id uuid.UUID) (*user.User, error) {
-	query := "SELECT id, email, passwordhash, createdAt, updatedAt FROM account WHERE id=$1"
+	query := "SELECT id, email, createdAt, updatedAt FROM account WHERE id=$1"
 
 	var u user.User
 	err := r.db.GetContext(ctx, &u, query, id)
@@ -70,7 +156,7 @@ func (r *Repository) GetById(ctx context.Context, id uuid.UUID) (*user.User, err
 }
 
 func (r *Repository) GetByEmail(ctx context.Context, email string) (*user.User, error) {
-	query := "SELECT id, email, passwordhash, createdAt, updatedAt FROM account WHERE email=$1"
+	query := "SELECT id, email, createdAt, updatedAt FROM account WHERE email=$1"
 
 	var u user.User
 	err := r.db.GetContext(ctx, &u, query, email)
@@ -82,7 +168,7 @@ func (r *Repository) GetByEmail(ctx context.Context, email string) (*user.User,
 }
 
 func (r *Repository) GetLastRegisteredUser(ctx context.Context) (*user.User, error) {
-	query := "SELECT id, email, passwordhash, createdAt, updatedAt FROM account ORDER BY createdAt DESC LIMIT 1"
+	query := "SELECT id, email, createdAt, updatedAt FROM account ORDER BY createdAt DESC LIMIT 1"
 
 	var u user.User
 	err := r.db.GetContext(ctx, &u, query)
@@ -96,7 +182,7 @@ func (r *Repository) GetLastRegisteredUser(ctx context.Context) (*user.User, err
 func (r *Repository) GetRegisteredLaterThen(ctx context.Context, registerDate string, limit int) (*[]user.User, error) {
 	var users []user.User
 
-	query := "SELECT id, email, passwordhash, createdAt, updatedAt FROM account WHERE createdat > $1 LIMIT $2"
+	query := "SELECT id, email, createdAt, updatedAt FROM account WHERE createdat > $1 LIMIT $2"
 
 	err := r.db.SelectContext(ctx, &users, query, registerDate, limit)
 	if err != nil {
@@ -112,7 +198,7 @@ func (r *Repository) GetRegisteredLaterThen(ctx context.Context, registerDate st
 func (r *Repository) GetWithOffsetAndLimit(ctx context.Context, offset int, limit int) (*[]user.User, error) {
 	var users []user.User
 
-	query := "SELECT id, email, passwordhash, createdAt, updatedAt FROM account ORDER BY createdat OFFSET $1 LIMIT $2"
+	query := "SELECT id, email, createdAt, updatedAt FROM account ORDER BY createdat OFFSET $1 LIMIT $2"
 
 	err := r.db.SelectContext(ctx, &users, query, offset, limit)
 	if err != nil {
@@ -130,9 +216,9 @@ func (r *Repository) Update(ctx context.Context, user *user.User) error {
 		return apperrors.ErrUserNotFound
 	}
 
-	query := "UPDATE account SET email=$1, passwordhash=$2, updatedAt=current_timestamp WHERE id=$3 RETURNING createdAt, updatedAt"
+	query := "UPDATE account SET email=$1, updatedAt=current_timestamp WHERE id=$2 RETURNING createdAt, updatedAt"
 
-	row := r.db.QueryRowContext(ctx, query, user.Email, user.Passwordhash, user.ID)
+	row := r.db.QueryRowContext(ctx, query, user.Email, user.ID)
 	err := row.Scan(&user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		r.logger.Warning(err.Error())
@@ -5,8 +5,6 @@ import (
 	"Go-scheduler-service/internal/domain/logger"
 	"Go-scheduler-service/internal/domain/user"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"github.com/google/uuid"
 	"regexp"
 )
@@ -24,12 +22,6 @@ func (service *Service) Create(ctx context.Context, user *user.User) error {
 	if err := validateEmail(user.Email); err != nil {
 		return err
 	}
-	if err := validatePassword(user.Passwordhash); err != nil {
-		return err
-	}
-
-	hashedPassword := hashPassword(user.Passwordhash)
-	user.Passwordhash = hashedPassword
 
 	err := service.repository.Create(ctx, user)
 	if err != nil {
@@ -44,6 +36,14 @@ func (service *Service) Save(ctx context.Context, user *user.User) error {
 	return createdUser
 }
 
+func (service *Service) SaveBatch(ctx context.Context, users []user.User, checkpoint user.Checkpoint) (int, error) {
+	return service.repository.SaveBatch(ctx, users, checkpoint)
+}
+
+func (service *Service) GetCheckpoint(ctx context.Context, source string) (*user.Checkpoint, error) {
+	return service.repository.GetCheckpoint(ctx, source)
+}
+
 func (service *Service) GetById(ctx context.Context, id uuid.UUID) (*user.User, error) {
 	return service.repository.GetById(ctx, id)
 }
@@ -73,12 +73,6 @@ func (service *Service) Update(ctx context.Context, user *user.User) error {
 	if err := validateEmail(user.Email); err != nil {
 		return err
 	}
-	if err := validatePassword(user.Passwordhash); err != nil {
-		return err
-	}
-
-	hashedPassword := hashPassword(user.Passwordhash)
-	user.Passwordhash = hashedPassword
 
 	return service.repository.Update(ctx, user)
 }
@@ -103,21 +97,3 @@ func validateEmail(email string) error {
 
 	return nil
 }
-
-func validatePassword(password string) error {
-	if password == "" {
-		return apperrors.ErrInvalidPasswordFormat
-	}
-
-	passwordRegex := regexp.MustCompile("^[a-zA-Z0-9@#$%!]{8,60}$") // fixme reg exp
-	if !passwordRegex.MatchString(password) {
-		return apperrors.ErrInvalidPasswordFormat
-	}
-
-	return nil
-}
-
-func hashPassword(password string) string {
-	hashed := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hashed[:])
-}
@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"time"
+	_ "time/tzdata"
+)
+
+// Concurrency decides what happens when a job is due while its previous run is still going.
+type Concurrency string
+
+const (
+	// ConcurrencySkip drops the new activation.
+	ConcurrencySkip Concurrency = "skip"
+	// ConcurrencyQueue runs the new activation after the current one, keeping up to MaxQueued of them.
+	ConcurrencyQueue Concurrency = "queue"
+	// ConcurrencyReplace cancels the current run and starts the new activation once it has returned.
+	ConcurrencyReplace Concurrency = "replace"
+)
+
+// Misfire decides what happens with the activations missed while the scheduler was down or late.
+type Misfire string
+
+const (
+	// MisfireSkip drops the missed activations and waits for the next one.
+	MisfireSkip Misfire = "skip"
+	// MisfireRunOnce runs once for all the missed activations.
+	MisfireRunOnce Misfire = "run_once"
+)
+
+const (
+	DefaultMisfireGrace = 5 * time.Second
+	DefaultMaxQueued    = 1
+)
+
+type JobConfig struct {
+	// Name is the name the job is registered under.
+	Name     string `yaml:"name"`
+	Schedule string `yaml:"schedule"`
+	// TimeZone is an IANA time zone the schedule is evaluated in. Defaults to UTC. The zone database is embedded,
+	// as the image has none.
+	TimeZone string `yaml:"time_zone"`
+	// Timeout cancels the context of a run that takes longer. Zero means no timeout.
+	Timeout     time.Duration `yaml:"timeout"`
+	Concurrency Concurrency   `yaml:"concurrency"`
+	MaxQueued   int           `yaml:"max_queued"`
+	Misfire     Misfire       `yaml:"misfire"`
+	// MisfireGrace is how late an activation may start before it counts as missed.
+	MisfireGrace time.Duration `yaml:"misfire_grace"`
+	Disabled     bool          `yaml:"disabled"`
+}
+
+type Config struct {
+	Jobs []JobConfig `yaml:"jobs"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i := range config.Jobs {
+		config.Jobs[i].setDefaults()
+	}
+
+	return &config, nil
+}
+
+func (c *JobConfig) setDefaults() {
+	if c.TimeZone == "" {
+		c.TimeZone = "UTC"
+	}
+	if c.Concurrency == "" {
+		c.Concurrency = ConcurrencySkip
+	}
+	if c.MaxQueued <= 0 {
+		c.MaxQueued = DefaultMaxQueued
+	}
+	if c.Misfire == "" {
+		c.Misfire = MisfireRunOnce
+	}
+	if c.MisfireGrace <= 0 {
+		c.MisfireGrace = DefaultMisfireGrace
+	}
+}
+
+func (c *JobConfig) validate() (Schedule, error) {
+	switch c.Concurrency {
+	case ConcurrencySkip, ConcurrencyQueue, ConcurrencyReplace:
+	default:
+		return nil, fmt.Errorf("job %s: unknown concurrency policy %q", c.Name, c.Concurrency)
+	}
+	switch c.Misfire {
+	case MisfireSkip, MisfireRunOnce:
+	default:
+		return nil, fmt.Errorf("job %s: unknown misfire policy %q", c.Name, c.Misfire)
+	}
+	if c.Timeout < 0 {
+		return nil, fmt.Errorf("job %s: negative timeout", c.Name)
+	}
+
+	location, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %w", c.Name, err)
+	}
+	schedule, err := ParseSchedule(c.Schedule, location)
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %w", c.Name, err)
+	}
+	return schedule, nil
+}
@@ -0,0 +1,298 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule gives the next activation strictly after t, or the zero time if there is none.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	allHours = uint64(1)<<24 - 1
+
+	secondBounds = bounds{0, 59, nil}
+	minuteBounds = bounds{0, 59, nil}
+	hourBounds   = bounds{0, 23, nil}
+	domBounds    = bounds{1, 31, nil}
+	monthBounds  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is accepted for Sunday as well and folded into 0.
+	dowBounds = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// CronSchedule is a cron expression with seconds, evaluated in a time zone.
+type CronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	// A day matches on either day field when both are restricted, as in cron.
+	domStar, dowStar bool
+	location         *time.Location
+}
+
+// EverySchedule activates at a fixed interval, whatever the time zone.
+type EverySchedule struct {
+	Interval time.Duration
+}
+
+func (s EverySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.Interval - time.Duration(t.Nanosecond())%time.Second)
+}
+
+// ParseSchedule parses "second minute hour day-of-month month day-of-week", a five field expression without
+// seconds (which then fire at second 0), a descriptor such as @daily, or "@every <duration>". Fields take *, ?,
+// lists, ranges, steps and three-letter month and day names. Times are evaluated in location.
+func ParseSchedule(spec string, location *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval below one second", spec)
+		}
+		return EverySchedule{Interval: interval.Truncate(time.Second)}, nil
+	}
+	if expanded, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 or 6 fields, got %d", spec, len(fields))
+	}
+	if location == nil {
+		location = time.UTC
+	}
+
+	s := &CronSchedule{location: location}
+	var err error
+	parsed := []struct {
+		bits   *uint64
+		bounds bounds
+	}{
+		{&s.second, secondBounds}, {&s.minute, minuteBounds}, {&s.hour, hourBounds},
+		{&s.dom, domBounds}, {&s.month, monthBounds}, {&s.dow, dowBounds},
+	}
+	for i, p := range parsed {
+		if *p.bits, err = parseField(fields[i], p.bounds); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = isStar(fields[3])
+	s.dowStar = isStar(fields[5])
+
+	return s, nil
+}
+
+func isStar(field string) bool {
+	return field == "*" || field == "?"
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			parsedStep, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || parsedStep == 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], uint(parsedStep)
+		}
+
+		var low, high uint
+		switch {
+		case isStar(rangePart):
+			low, high = b.min, b.max
+		case strings.Contains(rangePart, "-"):
+			bound := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = parseValue(bound[0], b); err != nil {
+				return 0, err
+			}
+			if high, err = parseValue(bound[1], b); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if low, err = parseValue(rangePart, b); err != nil {
+				return 0, err
+			}
+			high = low
+			// "a/n" runs from a to the end of the range.
+			if step > 1 {
+				high = b.max
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range %q", rangePart)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if uint(v) < b.min || uint(v) > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return uint(v), nil
+}
+
+// Next walks field by field, from the month down to the second, resetting the smaller fields whenever a
+// larger one moves. Moving by calendar units in the schedule's location keeps wall-clock times across DST.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	original := t.Location()
+	t = t.In(s.location)
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+
+	added := false
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.location)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+		}
+		t = t.AddDate(0, 0, 1)
+		// Midnight may not exist on a DST change; Date moved it to another hour of the same day.
+		if t.Hour() != 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.location)
+		}
+		before := t.Hour()
+		t = t.Add(time.Hour)
+		if t.Hour() < before {
+			goto wrap
+		}
+		// The clock jumped over an hour of the schedule: that activation runs when the jump is over, as in cron.
+		for h := before + 1; h < t.Hour(); h++ {
+			if s.hour&(1<<uint(h)) != 0 {
+				return t.In(original)
+			}
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	for s.second&(1<<uint(t.Second())) == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+
+	// When the clock is set back, the hours it repeats match again. Only a schedule running every hour
+	// fires in them a second time.
+	if s.hour != allHours {
+		if end := repeatedUntil(t); !end.IsZero() {
+			return s.Next(end.Add(-time.Second).In(original))
+		}
+	}
+
+	return t.In(original)
+}
+
+// repeatedUntil returns the end of the wall-clock times t shares with the hour before the clock was set back, or
+// the zero time if t is not one of them.
+func repeatedUntil(t time.Time) time.Time {
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return time.Time{}
+	}
+	_, offset := t.Zone()
+	_, previousOffset := start.Add(-time.Second).Zone()
+	end := start.Add(time.Duration(previousOffset-offset) * time.Second)
+	if !t.Before(end) {
+		return time.Time{}
+	}
+	return end
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
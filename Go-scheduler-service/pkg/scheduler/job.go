@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrJobNotRegistered = errors.New("job is not registered")
+var ErrJobAlreadyRegistered = errors.New("job is already registered")
+
+// Job is a unit of work the scheduler runs on a schedule. Run must return when ctx is done, which happens on
+// timeout, on replacement by a newer activation and on shutdown.
+type Job interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+// Run is one execution of a job.
+type Run struct {
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Err         error
+}
+
+// Store keeps the last activation of every job, so the activations missed during downtime are known on start.
+type Store interface {
+	// LastFire returns the last activation consumed for the job, or the zero time if there was none.
+	LastFire(ctx context.Context, job string) (time.Time, error)
+	// RecordFire stores an activation as consumed, whether it was run, queued or dropped.
+	RecordFire(ctx context.Context, job string, scheduledAt time.Time) error
+	RecordRun(ctx context.Context, job string, run Run) error
+}
+
+// Registry holds the jobs the configuration can schedule, by name.
+type Registry struct {
+	jobs map[string]Job
+}
+
+func NewRegistry() *Registry {
+	return &Registry{jobs: map[string]Job{}}
+}
+
+func (r *Registry) Register(job Job) error {
+	if _, ok := r.jobs[job.Name()]; ok {
+		return fmt.Errorf("%w: %s", ErrJobAlreadyRegistered, job.Name())
+	}
+	r.jobs[job.Name()] = job
+	return nil
+}
+
+func (r *Registry) Get(name string) (Job, error) {
+	job, ok := r.jobs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotRegistered, name)
+	}
+	return job, nil
+}
@@ -1,98 +1,247 @@
 package scheduler
 
 import (
-	"Go-scheduler-service/internal/domain/apperrors"
 	"Go-scheduler-service/internal/domain/logger"
-	"Go-scheduler-service/internal/domain/user"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
 type Scheduler struct {
-	userService       user.Service
-	host              string
-	port              int
-	url               string
-	usersFreqInterval int
-	limit             int
-	logger            logger.Logger
+	entries []*entry
+	logger  logger.Logger
 }
 
-func New(userService user.Service, host string, port int, url string, usersFreqInterval int, limit int, logger logger.Logger) *Scheduler {
-	return &Scheduler{
-		userService:       userService,
-		host:              host,
-		port:              port,
-		url:               url,
-		usersFreqInterval: usersFreqInterval,
-		limit:             limit,
-		logger:            logger,
+// New schedules the configured jobs, which must all be registered. Registered jobs missing from the
+// configuration, or disabled in it, are not run.
+func New(config *Config, registry *Registry, store Store, logger logger.Logger) (*Scheduler, error) {
+	s := &Scheduler{logger: logger}
+	seen := map[string]bool{}
+	for _, jobConfig := range config.Jobs {
+		jobConfig.setDefaults()
+		if seen[jobConfig.Name] {
+			return nil, fmt.Errorf("job %s is configured twice", jobConfig.Name)
+		}
+		seen[jobConfig.Name] = true
+
+		job, err := registry.Get(jobConfig.Name)
+		if err != nil {
+			return nil, err
+		}
+		schedule, err := jobConfig.validate()
+		if err != nil {
+			return nil, err
+		}
+		if jobConfig.Disabled {
+			logger.Info(fmt.Sprintf("Job %s is disabled", jobConfig.Name))
+			continue
+		}
+
+		queueSize := 1
+		if jobConfig.Concurrency == ConcurrencyQueue {
+			queueSize = jobConfig.MaxQueued
+		}
+		s.entries = append(s.entries, &entry{
+			job:      job,
+			config:   jobConfig,
+			schedule: schedule,
+			store:    store,
+			logger:   logger,
+			fires:    make(chan time.Time, queueSize),
+		})
+	}
+	for name := range registry.jobs {
+		if !seen[name] {
+			logger.Warning(fmt.Sprintf("Job %s is registered but not configured", name))
+		}
+	}
+
+	return s, nil
+}
+
+// Run schedules the jobs until ctx is done, then cancels the runs in progress and waits for them to return.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range s.entries {
+		e := e
+		s.logger.Info(fmt.Sprintf("Scheduling job %s at %q (%s)", e.config.Name, e.config.Schedule, e.config.TimeZone))
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			e.runFires(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			e.scheduleFires(ctx)
+		}()
 	}
+	wg.Wait()
 }
 
-func (s *Scheduler) ScheduleUsers(ctx context.Context) {
-	pingTimer := time.NewTicker(time.Duration(s.usersFreqInterval) * time.Minute)
-	defer pingTimer.Stop()
+type entry struct {
+	job      Job
+	config   JobConfig
+	schedule Schedule
+	store    Store
+	logger   logger.Logger
+
+	// fires holds the activations waiting for the run in progress.
+	fires chan time.Time
+
+	mu        sync.Mutex
+	running   bool
+	cancelRun context.CancelFunc
+}
+
+func (e *entry) scheduleFires(ctx context.Context) {
+	last, err := e.store.LastFire(ctx, e.config.Name)
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Failed to get the last activation of job %s: %s", e.config.Name, err))
+	}
+	if last.IsZero() {
+		last = time.Now()
+	}
 
 	for {
+		next := e.schedule.Next(last)
+		if next.IsZero() {
+			e.logger.Warning(fmt.Sprintf("Job %s has no more activations", e.config.Name))
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
 		select {
-		case <-pingTimer.C:
-			lastRegisteredUser, err := s.userService.GetLastRegisteredUser(ctx)
-			var lastRegisteredUserDate string
-			if err == apperrors.ErrUserNotFound {
-				lastRegisteredUserDate = "2000-04-23 10:03:32.670268"
-			} else {
-				lastRegisteredUserDate = lastRegisteredUser.CreatedAt.String()[0:26]
-				s.logger.Info(fmt.Sprintf("Last registered user register date: %s", lastRegisteredUserDate))
-			}
-
-			users, err := s.getNewUsers(lastRegisteredUserDate)
-			if err != nil {
-				s.logger.Error(fmt.Sprintf("Error getting users in scheduler: %s", err.Error()))
-				continue
-			}
-
-			if users != nil {
-				s.logger.Info(fmt.Sprintf("%v", users))
-				for _, u := range users {
-					err := s.userService.Save(ctx, &u)
-					if err != nil {
-						s.logger.Warning(fmt.Sprintf("Error while saving new user [got in scheduler]: %s", err))
-					}
-				}
-			} else {
-				s.logger.Info("No more users")
-			}
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		if now.Sub(next) <= e.config.MisfireGrace {
+			last = next
+			e.dispatch(ctx, next)
+			continue
+		}
+
+		// Missed activations, after downtime or a stalled process: only the latest one is kept.
+		missed := 0
+		for ; !next.IsZero() && !next.After(now); next = e.schedule.Next(next) {
+			last = next
+			missed++
 		}
+		if e.config.Misfire == MisfireRunOnce {
+			e.logger.Warning(fmt.Sprintf("Job %s missed %d activations since %s, running once", e.config.Name, missed, last))
+			e.dispatch(ctx, last)
+			continue
+		}
+		e.logger.Warning(fmt.Sprintf("Job %s missed %d activations, skipping to the next one", e.config.Name, missed))
+		e.recordFire(ctx, last)
 	}
 }
 
-func (s *Scheduler) getNewUsers(lastRegisteredUserDate string) ([]user.User, error) {
-	url := "http://" + s.host + ":" + strconv.Itoa(s.port) + s.url + "?date=" + lastRegisteredUserDate + "&limit=" + strconv.Itoa(s.limit)
-	url = strings.Replace(url, " ", "%20", -1)
+// dispatch hands an activation to the runner according to the concurrency policy.
+func (e *entry) dispatch(ctx context.Context, scheduledAt time.Time) {
+	e.recordFire(ctx, scheduledAt)
 
-	s.logger.Info(fmt.Sprintf("Send query to get users %s ...", url))
+	e.mu.Lock()
+	running, cancelRun := e.running, e.cancelRun
+	e.mu.Unlock()
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(url)
+	switch e.config.Concurrency {
+	case ConcurrencySkip:
+		if running {
+			e.logger.Warning(fmt.Sprintf("Job %s is still running, skipping the activation at %s", e.config.Name, scheduledAt))
+			return
+		}
+	case ConcurrencyReplace:
+		if running {
+			e.logger.Warning(fmt.Sprintf("Job %s is still running, replacing it with the activation at %s", e.config.Name, scheduledAt))
+			cancelRun()
+		}
+		// A newer activation supersedes the one waiting.
+		select {
+		case <-e.fires:
+		default:
+		}
+	}
 
-	if err != nil {
-		return nil, err
+	select {
+	case e.fires <- scheduledAt:
+	default:
+		e.logger.Warning(fmt.Sprintf("Job %s has %d activations waiting, dropping the one at %s", e.config.Name,
+			len(e.fires), scheduledAt))
 	}
-	defer resp.Body.Close()
+}
 
-	var users []user.User
+func (e *entry) recordFire(ctx context.Context, scheduledAt time.Time) {
+	if err := e.store.RecordFire(ctx, e.config.Name, scheduledAt); err != nil {
+		e.logger.Warning(fmt.Sprintf("Failed to record the activation of job %s: %s", e.config.Name, err))
+	}
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&users)
-	if err != nil {
-		s.logger.Warning(fmt.Sprintf("Error decoding users in scheduler: %s", err.Error()))
-		return nil, err
+func (e *entry) runFires(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case scheduledAt := <-e.fires:
+			e.run(ctx, scheduledAt)
+		}
+	}
+}
+
+func (e *entry) run(ctx context.Context, scheduledAt time.Time) {
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if e.config.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, e.config.Timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	e.mu.Lock()
+	e.running, e.cancelRun = true, cancel
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.running, e.cancelRun = false, nil
+		e.mu.Unlock()
+	}()
+
+	run := Run{ScheduledAt: scheduledAt, StartedAt: time.Now()}
+	run.Err = e.call(runCtx)
+	run.FinishedAt = time.Now()
+
+	switch {
+	case run.Err == nil:
+		e.logger.Debug(fmt.Sprintf("Job %s finished in %s", e.config.Name, run.FinishedAt.Sub(run.StartedAt)))
+	case ctx.Err() != nil:
+		e.logger.Info(fmt.Sprintf("Job %s was stopped by the shutdown: %s", e.config.Name, run.Err))
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		e.logger.Error(fmt.Sprintf("Job %s timed out after %s: %s", e.config.Name, e.config.Timeout, run.Err))
+	case errors.Is(runCtx.Err(), context.Canceled):
+		e.logger.Warning(fmt.Sprintf("Job %s was replaced: %s", e.config.Name, run.Err))
+	default:
+		e.logger.Error(fmt.Sprintf("Job %s failed: %s", e.config.Name, run.Err))
+	}
+
+	// The run is recorded even when the scheduler is shutting down.
+	recordCtx, cancelRecord := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelRecord()
+	if err := e.store.RecordRun(recordCtx, e.config.Name, run); err != nil {
+		e.logger.Warning(fmt.Sprintf("Failed to record the run of job %s: %s", e.config.Name, err))
 	}
+}
 
-	return users, nil
+func (e *entry) call(ctx context.Context) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return e.job.Run(ctx)
 }
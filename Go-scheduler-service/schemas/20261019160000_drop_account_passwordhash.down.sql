@@ -0,0 +1 @@
+ALTER TABLE account ADD COLUMN passwordHash varchar(64) NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- No checkpoint is seeded: the first sync drains the auth service from the start, picking up the users the
+-- createdAt-only watermark skipped.
+CREATE TABLE sync_checkpoint (
+    source varchar(64) PRIMARY KEY,
+    createdAt TIMESTAMP NOT NULL,
+    userId uuid NOT NULL,
+    updatedAt TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
@@ -0,0 +1,9 @@
+CREATE TABLE job_state (
+    name varchar(64) PRIMARY KEY,
+    lastFireAt TIMESTAMP NOT NULL,
+    lastScheduledAt TIMESTAMP,
+    lastStartedAt TIMESTAMP,
+    lastFinishedAt TIMESTAMP,
+    lastError text NOT NULL DEFAULT '',
+    updatedAt TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
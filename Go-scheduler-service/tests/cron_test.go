@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"Go-scheduler-service/pkg/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCronSchedule(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	utc := func(year int, month time.Month, day, hour, minute, second int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	}
+	est := time.FixedZone("EST", -5*60*60)
+	edt := time.FixedZone("EDT", -4*60*60)
+
+	testTable := []struct {
+		name     string
+		spec     string
+		location *time.Location
+		from     time.Time
+		// next are the activations following from, in order.
+		next []time.Time
+	}{
+		{
+			name: "seconds-field",
+			spec: "*/15 * * * * *",
+			from: utc(2026, 10, 19, 12, 0, 7),
+			next: []time.Time{utc(2026, 10, 19, 12, 0, 15), utc(2026, 10, 19, 12, 0, 30), utc(2026, 10, 19, 12, 0, 45),
+				utc(2026, 10, 19, 12, 1, 0)},
+		},
+		{
+			name: "five-fields-fire-at-second-zero",
+			spec: "30 * * * *",
+			from: utc(2026, 10, 19, 12, 30, 0),
+			next: []time.Time{utc(2026, 10, 19, 13, 30, 0), utc(2026, 10, 19, 14, 30, 0)},
+		},
+		{
+			name: "strictly-after",
+			spec: "0 0 12 * * *",
+			from: utc(2026, 10, 19, 12, 0, 0).Add(-time.Millisecond),
+			next: []time.Time{utc(2026, 10, 19, 12, 0, 0), utc(2026, 10, 20, 12, 0, 0)},
+		},
+		{
+			name: "range",
+			spec: "0 0 9-11 * * *",
+			from: utc(2026, 10, 19, 10, 30, 0),
+			next: []time.Time{utc(2026, 10, 19, 11, 0, 0), utc(2026, 10, 20, 9, 0, 0)},
+		},
+		{
+			name: "range-with-step",
+			spec: "0 0-30/10 * * * *",
+			from: utc(2026, 10, 19, 12, 25, 0),
+			next: []time.Time{utc(2026, 10, 19, 12, 30, 0), utc(2026, 10, 19, 13, 0, 0), utc(2026, 10, 19, 13, 10, 0)},
+		},
+		{
+			name: "start-with-step",
+			spec: "0 5/20 * * * *",
+			from: utc(2026, 10, 19, 12, 6, 0),
+			next: []time.Time{utc(2026, 10, 19, 12, 25, 0), utc(2026, 10, 19, 12, 45, 0), utc(2026, 10, 19, 13, 5, 0)},
+		},
+		{
+			name: "list",
+			spec: "0 0 0 1,15 * *",
+			from: utc(2026, 10, 2, 0, 0, 0),
+			next: []time.Time{utc(2026, 10, 15, 0, 0, 0), utc(2026, 11, 1, 0, 0, 0)},
+		},
+		{
+			name: "month-names",
+			spec: "0 0 0 1 JAN,jul *",
+			from: utc(2026, 2, 10, 0, 0, 0),
+			next: []time.Time{utc(2026, 7, 1, 0, 0, 0), utc(2027, 1, 1, 0, 0, 0)},
+		},
+		{
+			name: "weekday-names",
+			spec: "0 0 8 * * mon-fri",
+			from: utc(2026, 10, 23, 9, 0, 0),
+			next: []time.Time{utc(2026, 10, 26, 8, 0, 0), utc(2026, 10, 27, 8, 0, 0)},
+		},
+		{
+			name: "sunday-as-seven",
+			spec: "0 0 0 * * 7",
+			from: utc(2026, 10, 19, 0, 0, 0),
+			next: []time.Time{utc(2026, 10, 25, 0, 0, 0), utc(2026, 11, 1, 0, 0, 0)},
+		},
+		{
+			name: "day-of-month-or-day-of-week",
+			spec: "0 0 0 13 * fri",
+			from: utc(2026, 12, 10, 0, 0, 0),
+			next: []time.Time{utc(2026, 12, 11, 0, 0, 0), utc(2026, 12, 13, 0, 0, 0), utc(2026, 12, 18, 0, 0, 0)},
+		},
+		{
+			name: "day-of-month-with-any-weekday",
+			spec: "0 0 0 31 * ?",
+			from: utc(2026, 4, 1, 0, 0, 0),
+			next: []time.Time{utc(2026, 5, 31, 0, 0, 0), utc(2026, 7, 31, 0, 0, 0)},
+		},
+		{
+			name: "leap-day",
+			spec: "0 0 0 29 feb *",
+			from: utc(2026, 3, 1, 0, 0, 0),
+			next: []time.Time{utc(2028, 2, 29, 0, 0, 0)},
+		},
+		{
+			name: "no-activation",
+			spec: "0 0 0 30 2 *",
+			from: utc(2026, 10, 19, 0, 0, 0),
+			next: []time.Time{{}},
+		},
+		{
+			name: "descriptor",
+			spec: "@weekly",
+			from: utc(2026, 10, 19, 0, 0, 0),
+			next: []time.Time{utc(2026, 10, 25, 0, 0, 0), utc(2026, 11, 1, 0, 0, 0)},
+		},
+		{
+			name: "every",
+			spec: "@every 90s",
+			from: utc(2026, 10, 19, 12, 0, 0).Add(500 * time.Millisecond),
+			next: []time.Time{utc(2026, 10, 19, 12, 1, 30), utc(2026, 10, 19, 12, 3, 0)},
+		},
+		{
+			name:     "time-zone",
+			spec:     "0 0 9 * * *",
+			location: newYork,
+			from:     utc(2026, 10, 19, 12, 0, 0),
+			next:     []time.Time{utc(2026, 10, 19, 13, 0, 0), utc(2026, 10, 20, 13, 0, 0)},
+		},
+		{
+			name:     "daily-across-dst-gap",
+			spec:     "0 0 9 * * *",
+			location: newYork,
+			from:     time.Date(2026, 3, 7, 10, 0, 0, 0, est),
+			next:     []time.Time{time.Date(2026, 3, 8, 9, 0, 0, 0, edt), time.Date(2026, 3, 9, 9, 0, 0, 0, edt)},
+		},
+		{
+			name:     "activation-in-dst-gap-runs-when-it-ends",
+			spec:     "0 30 2 * * *",
+			location: newYork,
+			from:     time.Date(2026, 3, 7, 2, 30, 0, 0, est),
+			next:     []time.Time{time.Date(2026, 3, 8, 3, 0, 0, 0, edt), time.Date(2026, 3, 9, 2, 30, 0, 0, edt)},
+		},
+		{
+			name:     "hourly-across-dst-gap",
+			spec:     "0 30 * * * *",
+			location: newYork,
+			from:     time.Date(2026, 3, 8, 1, 0, 0, 0, est),
+			next:     []time.Time{time.Date(2026, 3, 8, 1, 30, 0, 0, est), time.Date(2026, 3, 8, 3, 30, 0, 0, edt)},
+		},
+		{
+			name:     "activation-in-dst-overlap-runs-once",
+			spec:     "0 30 1 * * *",
+			location: newYork,
+			from:     time.Date(2026, 10, 31, 12, 0, 0, 0, edt),
+			next: []time.Time{time.Date(2026, 11, 1, 1, 30, 0, 0, edt), time.Date(2026, 11, 2, 1, 30, 0, 0, est),
+				time.Date(2026, 11, 3, 1, 30, 0, 0, est)},
+		},
+		{
+			name:     "hourly-across-dst-overlap",
+			spec:     "0 30 * * * *",
+			location: newYork,
+			from:     time.Date(2026, 11, 1, 1, 0, 0, 0, edt),
+			next: []time.Time{time.Date(2026, 11, 1, 1, 30, 0, 0, edt), time.Date(2026, 11, 1, 1, 30, 0, 0, est),
+				time.Date(2026, 11, 1, 2, 30, 0, 0, est)},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			schedule, err := scheduler.ParseSchedule(testCase.spec, testCase.location)
+			require.NoError(t, err)
+
+			from := testCase.from
+			for i, expected := range testCase.next {
+				next := schedule.Next(from)
+				assert.Truef(t, expected.Equal(next), "activation %d: expected %s, got %s", i, expected, next)
+				from = next
+			}
+		})
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	testTable := []struct {
+		name string
+		spec string
+	}{
+		{"too-few-fields", "* * * *"},
+		{"too-many-fields", "* * * * * * *"},
+		{"value-out-of-range", "0 60 * * * *"},
+		{"zero-day-of-month", "0 0 0 0 * *"},
+		{"unknown-name", "0 0 0 * foo *"},
+		{"reversed-range", "0 0 17-9 * * *"},
+		{"zero-step", "*/0 * * * * *"},
+		{"invalid-interval", "@every soon"},
+		{"interval-below-one-second", "@every 500ms"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := scheduler.ParseSchedule(testCase.spec, time.UTC)
+			assert.Error(t, err)
+		})
+	}
+}
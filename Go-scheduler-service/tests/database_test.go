@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"Go-scheduler-service/pkg/migration"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"os"
+	"testing"
+	"time"
+)
+
+// connectTestDatabase connects to the database of the POSTGRES_* variables and migrates it, skipping the test
+// when there is no database to connect to.
+func connectTestDatabase(t *testing.T) *sqlx.DB {
+	if os.Getenv("POSTGRES_HOST") == "" {
+		t.Skip("POSTGRES_HOST is not set")
+	}
+
+	db, err := sqlx.Open("postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_PORT"), os.Getenv("POSTGRES_USERNAME"),
+		os.Getenv("POSTGRES_PASSWORD"), os.Getenv("POSTGRES_DATABASE")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		t.Skip(fmt.Sprintf("Database is not available: %s", err))
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrationData, err := migration.New(db.DB, "file://../schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrationData.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatal(err)
+	}
+
+	return db
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"Go-scheduler-service/internal/domain/apperrors"
+	"Go-scheduler-service/internal/domain/user"
+	jobRepository "Go-scheduler-service/internal/job/repository"
+	"Go-scheduler-service/internal/user/repository"
+	"Go-scheduler-service/pkg/logger"
+	"Go-scheduler-service/pkg/scheduler"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUserRepository(t *testing.T) {
+	db := connectTestDatabase(t)
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+	userRepository := repository.New(db, myLogger)
+	ctx := context.Background()
+
+	t.Run("save-batch-skips-taken-email", func(t *testing.T) {
+		source := "test-" + uuid.NewString()
+		t.Cleanup(func() {
+			_, _ = db.Exec("DELETE FROM sync_checkpoint WHERE source=$1", source)
+		})
+
+		createdAt := time.Now().UTC().Truncate(time.Microsecond)
+		taken := user.User{ID: uuid.New(), Email: uuid.NewString() + "@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt}
+		require.NoError(t, userRepository.Save(ctx, &taken))
+
+		users := []user.User{
+			{ID: uuid.New(), Email: uuid.NewString() + "@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt},
+			{ID: uuid.New(), Email: taken.Email, CreatedAt: createdAt, UpdatedAt: createdAt},
+			{ID: uuid.New(), Email: uuid.NewString() + "@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt},
+		}
+		t.Cleanup(func() {
+			for _, u := range append(users, taken) {
+				_, _ = db.Exec("DELETE FROM account WHERE id=$1", u.ID)
+			}
+		})
+		checkpoint := user.Checkpoint{Source: source, CreatedAt: users[2].CreatedAt, ID: users[2].ID}
+
+		saved, err := userRepository.SaveBatch(ctx, users, checkpoint)
+		require.NoError(t, err)
+		assert.Equal(t, 2, saved)
+
+		for _, u := range []user.User{users[0], users[2]} {
+			_, err := userRepository.GetById(ctx, u.ID)
+			assert.NoError(t, err, "the users around the conflict are saved")
+		}
+		_, err = userRepository.GetById(ctx, users[1].ID)
+		assert.ErrorIs(t, err, apperrors.ErrUserNotFound)
+
+		stored, err := userRepository.GetCheckpoint(ctx, source)
+		require.NoError(t, err)
+		assert.Equal(t, users[2].ID, stored.ID)
+		assert.True(t, users[2].CreatedAt.Equal(stored.CreatedAt))
+
+		// A checkpoint behind the stored one does not move it back.
+		older := user.Checkpoint{Source: source, CreatedAt: createdAt.Add(-time.Hour), ID: users[0].ID}
+		_, err = userRepository.SaveBatch(ctx, nil, older)
+		require.NoError(t, err)
+		stored, err = userRepository.GetCheckpoint(ctx, source)
+		require.NoError(t, err)
+		assert.Equal(t, users[2].ID, stored.ID)
+	})
+}
+
+func TestJobRepository(t *testing.T) {
+	db := connectTestDatabase(t)
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+	store := jobRepository.New(db, myLogger)
+	ctx := context.Background()
+
+	t.Run("record-run-without-fire", func(t *testing.T) {
+		name := "test-" + uuid.NewString()[:8]
+		t.Cleanup(func() {
+			_, _ = db.Exec("DELETE FROM job_state WHERE name=$1", name)
+		})
+
+		scheduledAt := time.Now().UTC().Truncate(time.Second)
+		run := scheduler.Run{ScheduledAt: scheduledAt, StartedAt: scheduledAt, FinishedAt: scheduledAt.Add(time.Second),
+			Err: errors.New("failed")}
+		require.NoError(t, store.RecordRun(ctx, name, run))
+
+		lastFire, err := store.LastFire(ctx, name)
+		require.NoError(t, err)
+		assert.True(t, scheduledAt.Equal(lastFire))
+		var lastError string
+		require.NoError(t, db.Get(&lastError, "SELECT lastError FROM job_state WHERE name=$1", name))
+		assert.Equal(t, "failed", lastError)
+
+		// A later run updates the state without moving the last activation back.
+		require.NoError(t, store.RecordFire(ctx, name, scheduledAt.Add(time.Minute)))
+		require.NoError(t, store.RecordRun(ctx, name, scheduler.Run{ScheduledAt: scheduledAt, StartedAt: scheduledAt,
+			FinishedAt: scheduledAt}))
+		lastFire, err = store.LastFire(ctx, name)
+		require.NoError(t, err)
+		assert.True(t, scheduledAt.Add(time.Minute).Equal(lastFire))
+		require.NoError(t, db.Get(&lastError, "SELECT lastError FROM job_state WHERE name=$1", name))
+		assert.Empty(t, lastError)
+	})
+}
@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"Go-scheduler-service/pkg/logger"
+	"Go-scheduler-service/pkg/scheduler"
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// everySecond keeps the tests short; activations are at whole seconds.
+const everySecond = "* * * * * *"
+
+func TestScheduler(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	start := func(t *testing.T, jobConfig scheduler.JobConfig, job scheduler.Job, store *memoryStore) {
+		registry := scheduler.NewRegistry()
+		require.NoError(t, registry.Register(job))
+		s, err := scheduler.New(&scheduler.Config{Jobs: []scheduler.JobConfig{jobConfig}}, registry, store, myLogger)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.Run(ctx)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+	}
+
+	t.Run("misfire-run-once", func(t *testing.T) {
+		t.Parallel()
+		store := newMemoryStore(time.Now().Add(-time.Hour))
+		job := newBlockingJob("misfire-run-once")
+		close(job.release)
+		start(t, scheduler.JobConfig{Name: job.Name(), Schedule: everySecond, Misfire: scheduler.MisfireRunOnce}, job, store)
+
+		job.waitStarted(t)
+		runs := store.waitRuns(t, 1)
+		fires := store.Fires()
+		assert.Equal(t, fires[0], runs[0].ScheduledAt, "one run for all the missed activations")
+		assert.False(t, fires[0].After(runs[0].StartedAt), "the run does not wait for the next activation")
+		assert.WithinDuration(t, runs[0].StartedAt, fires[0], time.Second, "the latest missed activation is run")
+	})
+	t.Run("misfire-skip", func(t *testing.T) {
+		t.Parallel()
+		store := newMemoryStore(time.Now().Add(-time.Hour))
+		job := newBlockingJob("misfire-skip")
+		close(job.release)
+		started := time.Now()
+		start(t, scheduler.JobConfig{Name: job.Name(), Schedule: everySecond, Misfire: scheduler.MisfireSkip}, job, store)
+
+		job.waitStarted(t)
+		runs := store.waitRuns(t, 1)
+		fires := store.Fires()
+		require.GreaterOrEqual(t, len(fires), 2)
+		assert.WithinDuration(t, started, fires[0], 2*time.Second, "the missed activations are consumed")
+		assert.Equal(t, fires[1], runs[0].ScheduledAt, "only the next activation is run")
+		assert.True(t, runs[0].ScheduledAt.After(started))
+	})
+	t.Run("misfire-first-start", func(t *testing.T) {
+		t.Parallel()
+		store := newMemoryStore(time.Time{})
+		job := newBlockingJob("misfire-first-start")
+		close(job.release)
+		started := time.Now()
+		start(t, scheduler.JobConfig{Name: job.Name(), Schedule: everySecond}, job, store)
+
+		runs := store.waitRuns(t, 1)
+		assert.True(t, runs[0].ScheduledAt.After(started), "nothing is missed without a previous activation")
+	})
+	t.Run("concurrency-skip", func(t *testing.T) {
+		t.Parallel()
+		store := newMemoryStore(time.Time{})
+		job := newBlockingJob("concurrency-skip")
+		start(t, scheduler.JobConfig{Name: job.Name(), Schedule: everySecond, Concurrency: scheduler.ConcurrencySkip}, job, store)
+
+		job.waitStarted(t)
+		store.waitFires(t, 3)
+		released := time.Now()
+		job.release <- struct{}{}
+		job.waitStarted(t)
+		job.release <- struct{}{}
+
+		runs := store.waitRuns(t, 2)
+		assert.Equal(t, store.Fires()[0], runs[0].ScheduledAt)
+		assert.True(t, runs[1].ScheduledAt.After(released), "the activations during the run are dropped")
+	})
+	t.Run("concurrency-queue", func(t *testing.T) {
+		t.Parallel()
+		store := newMemoryStore(time.Time{})
+		job := newBlockingJob("concurrency-queue")
+		start(t, scheduler.JobConfig{Name: job.Name(), Schedule: everySecond, Concurrency: scheduler.ConcurrencyQueue,
+			MaxQueued: 1}, job, store)
+
+		job.waitStarted(t)
+		// The third activation is dropped well before the fourth is recorded.
+		store.waitFires(t, 4)
+		released := time.Now()
+		job.release <- struct{}{}
+		job.waitStarted(t)
+		job.release <- struct{}{}
+
+		runs := store.waitRuns(t, 2)
+		fires := store.Fires()
+		assert.Equal(t, fires[0], runs[0].ScheduledAt)
+		assert.Equal(t, fires[1], runs[1].ScheduledAt, "the first activation during the run is queued")
+		assert.True(t, runs[1].StartedAt.After(released))
+		close(job.release)
+		for _, run := range store.Runs() {
+			assert.NotEqual(t, fires[2], run.ScheduledAt, "activations beyond the queue are dropped")
+		}
+	})
+	t.Run("concurrency-replace", func(t *testing.T) {
+		t.Parallel()
+		store := newMemoryStore(time.Time{})
+		job := newBlockingJob("concurrency-replace")
+		start(t, scheduler.JobConfig{Name: job.Name(), Schedule: everySecond, Concurrency: scheduler.ConcurrencyReplace},
+			job, store)
+
+		job.waitStarted(t)
+		job.waitStarted(t)
+
+		runs := store.waitRuns(t, 1)
+		fires := store.Fires()
+		assert.Equal(t, fires[0], runs[0].ScheduledAt)
+		assert.ErrorIs(t, runs[0].Err, context.Canceled, "the running activation is cancelled")
+		close(job.release)
+		runs = store.waitRuns(t, 2)
+		assert.Equal(t, fires[1], runs[1].ScheduledAt, "the newer activation replaces it")
+		assert.NoError(t, runs[1].Err)
+	})
+}
+
+// blockingJob runs until it is released or its context is done.
+type blockingJob struct {
+	name    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingJob(name string) *blockingJob {
+	return &blockingJob{name: name, started: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (j *blockingJob) Name() string {
+	return j.name
+}
+
+func (j *blockingJob) Run(ctx context.Context) error {
+	j.started <- struct{}{}
+	select {
+	case <-j.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *blockingJob) waitStarted(t *testing.T) {
+	select {
+	case <-j.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not start")
+	}
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	lastFire time.Time
+	fires    []time.Time
+	runs     []scheduler.Run
+}
+
+func newMemoryStore(lastFire time.Time) *memoryStore {
+	return &memoryStore{lastFire: lastFire}
+}
+
+func (s *memoryStore) LastFire(ctx context.Context, job string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastFire, nil
+}
+
+func (s *memoryStore) RecordFire(ctx context.Context, job string, scheduledAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastFire = scheduledAt
+	s.fires = append(s.fires, scheduledAt)
+	return nil
+}
+
+func (s *memoryStore) RecordRun(ctx context.Context, job string, run scheduler.Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = append(s.runs, run)
+	return nil
+}
+
+func (s *memoryStore) Fires() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.fires...)
+}
+
+func (s *memoryStore) Runs() []scheduler.Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]scheduler.Run(nil), s.runs...)
+}
+
+func (s *memoryStore) waitFires(t *testing.T, n int) []time.Time {
+	require.Eventually(t, func() bool { return len(s.Fires()) >= n }, time.Duration(n+3)*time.Second, 10*time.Millisecond)
+	return s.Fires()
+}
+
+func (s *memoryStore) waitRuns(t *testing.T, n int) []scheduler.Run {
+	require.Eventually(t, func() bool { return len(s.Runs()) >= n }, 5*time.Second, 10*time.Millisecond)
+	return s.Runs()
+}
@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"Go-scheduler-service/internal/domain/apperrors"
+	"Go-scheduler-service/internal/domain/user"
+	"Go-scheduler-service/internal/user/job"
+	"Go-scheduler-service/pkg/logger"
+	"Golang-practice-2023/pkg/client"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUserSync(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	// Pages of 2 split the users registered at the same time.
+	registeredAt := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	authUsers := make([]client.User, 5)
+	for i := range authUsers {
+		createdAt := registeredAt.Add(time.Duration(i/3) * time.Second)
+		authUsers[i] = client.User{ID: uuid.New(), Email: "sync-" + strconv.Itoa(i) + "@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt}
+	}
+	sort.Slice(authUsers, func(i, j int) bool {
+		if !authUsers[i].CreatedAt.Equal(authUsers[j].CreatedAt) {
+			return authUsers[i].CreatedAt.Before(authUsers[j].CreatedAt)
+		}
+		return authUsers[i].ID.String() < authUsers[j].ID.String()
+	})
+
+	t.Run("drain-all-pages-in-one-run", func(t *testing.T) {
+		auth := newFakeAuthService(t, authUsers)
+		defer auth.Close()
+		service := newMemorySyncService()
+
+		require.NoError(t, job.NewUserSync(service, auth.Client(t), 2, myLogger).Run(context.Background()))
+
+		assert.Equal(t, ids(authUsers), service.SavedIds())
+		assert.Equal(t, 3, service.Batches())
+		assert.Len(t, auth.Requests(), 3, "the last page is shorter than the page size")
+		checkpoint := service.Checkpoint()
+		assert.Equal(t, authUsers[4].ID, checkpoint.ID)
+		assert.True(t, authUsers[4].CreatedAt.Equal(checkpoint.CreatedAt))
+	})
+	t.Run("advance-checkpoint-only-after-commit", func(t *testing.T) {
+		auth := newFakeAuthService(t, authUsers)
+		defer auth.Close()
+		service := newMemorySyncService()
+		service.FailBatch(2, errors.New("connection reset"))
+		sync := job.NewUserSync(service, auth.Client(t), 2, myLogger)
+
+		require.Error(t, sync.Run(context.Background()))
+		assert.Equal(t, ids(authUsers[:2]), service.SavedIds(), "the failed page is not saved")
+		assert.Equal(t, authUsers[1].ID, service.Checkpoint().ID, "the checkpoint stays at the last saved page")
+
+		require.NoError(t, sync.Run(context.Background()))
+		assert.Equal(t, ids(authUsers), service.SavedIds())
+		requests := auth.Requests()
+		assert.Equal(t, authUsers[1].ID.String(), requests[2].afterID, "the retry starts after the saved page")
+	})
+	t.Run("resume-from-stored-checkpoint", func(t *testing.T) {
+		auth := newFakeAuthService(t, authUsers)
+		defer auth.Close()
+		service := newMemorySyncService()
+		service.checkpoint = &user.Checkpoint{Source: user.SourceAuthUsers, CreatedAt: authUsers[2].CreatedAt, ID: authUsers[2].ID}
+
+		require.NoError(t, job.NewUserSync(service, auth.Client(t), 10, myLogger).Run(context.Background()))
+
+		assert.Equal(t, ids(authUsers[3:]), service.SavedIds())
+		requests := auth.Requests()
+		require.NotEmpty(t, requests)
+		assert.Equal(t, authUsers[2].ID.String(), requests[0].afterID)
+		assert.True(t, authUsers[2].CreatedAt.Equal(requests[0].date))
+	})
+	t.Run("stop-when-caught-up", func(t *testing.T) {
+		auth := newFakeAuthService(t, authUsers[:4])
+		defer auth.Close()
+		service := newMemorySyncService()
+
+		require.NoError(t, job.NewUserSync(service, auth.Client(t), 2, myLogger).Run(context.Background()))
+
+		assert.Equal(t, ids(authUsers[:4]), service.SavedIds())
+		assert.Len(t, auth.Requests(), 3, "a full last page needs one more request to see the end")
+		assert.Equal(t, 2, service.Batches())
+	})
+}
+
+func ids(users []client.User) []uuid.UUID {
+	result := make([]uuid.UUID, 0, len(users))
+	for _, u := range users {
+		result = append(result, u.ID)
+	}
+	return result
+}
+
+type authRequest struct {
+	date    time.Time
+	afterID string
+	limit   int
+}
+
+// fakeAuthService serves users ordered by (createdAt, id) the way the auth service pages them.
+type fakeAuthService struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []authRequest
+}
+
+func newFakeAuthService(t *testing.T, users []client.User) *fakeAuthService {
+	s := &fakeAuthService{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		date, err := time.Parse(client.DateLayout, r.URL.Query().Get("date"))
+		require.NoError(t, err)
+		request := authRequest{date: date, afterID: r.URL.Query().Get("after_id")}
+		request.limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+		s.mu.Lock()
+		s.requests = append(s.requests, request)
+		s.mu.Unlock()
+
+		page := make([]client.User, 0)
+		for _, u := range users {
+			after := u.CreatedAt.After(date)
+			if request.afterID != "" {
+				after = after || u.CreatedAt.Equal(date) && u.ID.String() > request.afterID
+			}
+			if after && len(page) < request.limit {
+				page = append(page, u)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	return s
+}
+
+func (s *fakeAuthService) Client(t *testing.T) *client.Client {
+	c, err := client.New(s.URL)
+	require.NoError(t, err)
+	return c
+}
+
+func (s *fakeAuthService) Requests() []authRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]authRequest(nil), s.requests...)
+}
+
+// memorySyncService implements the sync part of user.Service. A batch is saved with its checkpoint or not at
+// all, like the repository transaction.
+type memorySyncService struct {
+	user.Service
+	mu         sync.Mutex
+	saved      []uuid.UUID
+	checkpoint *user.Checkpoint
+	batches    int
+	failBatch  int
+	failErr    error
+}
+
+func newMemorySyncService() *memorySyncService {
+	return &memorySyncService{}
+}
+
+// FailBatch makes the n-th call to SaveBatch fail with err.
+func (s *memorySyncService) FailBatch(n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failBatch, s.failErr = n, err
+}
+
+func (s *memorySyncService) SaveBatch(ctx context.Context, users []user.User, checkpoint user.Checkpoint) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	if s.batches == s.failBatch {
+		return 0, s.failErr
+	}
+	for _, u := range users {
+		s.saved = append(s.saved, u.ID)
+	}
+	s.checkpoint = &checkpoint
+	return len(users), nil
+}
+
+func (s *memorySyncService) GetCheckpoint(ctx context.Context, source string) (*user.Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checkpoint == nil || s.checkpoint.Source != source {
+		return nil, apperrors.ErrCheckpointNotFound
+	}
+	checkpoint := *s.checkpoint
+	return &checkpoint, nil
+}
+
+func (s *memorySyncService) SavedIds() []uuid.UUID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]uuid.UUID(nil), s.saved...)
+}
+
+func (s *memorySyncService) Checkpoint() user.Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.checkpoint
+}
+
+func (s *memorySyncService) Batches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/pkg/cloudevents"
+	"embed"
+	"encoding/json"
+	"io/fs"
+)
+
+//go:embed events/*.json
+var eventSchemas embed.FS
+
+// EventSchemas holds one JSON Schema per event type and version, named <type>.v<version>.json. The schemas
+// are owned by the auth service (Go-auth-service/api/events); keep every published version here.
+func EventSchemas() fs.FS {
+	sub, _ := fs.Sub(eventSchemas, "events")
+	return sub
+}
+
+// NewEventRegistry loads the event schemas together with the upcasters between their versions.
+func NewEventRegistry() (*cloudevents.Registry, error) {
+	registry, err := cloudevents.NewRegistry(EventSchemas())
+	if err != nil {
+		return nil, err
+	}
+
+	registry.RegisterUpcaster(event.SubjectUserCreated, 1, dropCredentials)
+	registry.RegisterUpcaster(event.SubjectUserUpdated, 1, dropCredentials)
+
+	return registry, nil
+}
+
+// dropCredentials upcasts the version 1 user payloads, which still carried the password hash.
+func dropCredentials(data json.RawMessage) (json.RawMessage, error) {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	delete(payload, "passwordhash")
+	return json.Marshal(payload)
+}
@@ -1,22 +1,31 @@
 package main
 
 import (
-	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/api"
+	deadLetterRepository "Golang-practice-2023/internal/deadletter/repository"
+	deadLetterService "Golang-practice-2023/internal/deadletter/service"
+	profileRepository "Golang-practice-2023/internal/profile/repository"
+	profileService "Golang-practice-2023/internal/profile/service"
+	eventHandler "Golang-practice-2023/internal/transport/pubsub/handler"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/internal/transport/rest/middleware"
 	"Golang-practice-2023/internal/user/repository"
 	"Golang-practice-2023/internal/user/service"
+	"Golang-practice-2023/pkg/blobstore/filesystem"
 	"Golang-practice-2023/pkg/health"
 	"Golang-practice-2023/pkg/logger"
 	"Golang-practice-2023/pkg/migration"
 	"Golang-practice-2023/pkg/pgconnect"
+	"Golang-practice-2023/pkg/pubsub/bus"
 	"Golang-practice-2023/pkg/pubsub/nats/sub"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
-	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"log"
 	"net/http"
@@ -51,13 +60,14 @@ func main() {
 	if err != nil {
 		myLogger.Fatal(fmt.Sprintf("Failed to get Postgresql port: %s", err))
 	}
-	db, err := pgconnect.ConnectDatabase(pgconnect.ConnectionConfigData{
+	pgConfig := pgconnect.ConnectionConfigData{
 		Username:     os.Getenv("POSTGRES_USERNAME"),
 		Password:     os.Getenv("POSTGRES_PASSWORD"),
 		DatabaseName: os.Getenv("POSTGRES_DATABASE"),
 		Port:         pgPort,
 		Host:         os.Getenv("POSTGRES_HOST"),
-	})
+	}
+	db, err := pgconnect.ConnectDatabase(pgConfig)
 	_ = db
 
 	migrationData, err := migration.New(db.DB, "file://schemas")
@@ -73,30 +83,99 @@ func main() {
 	userRepository := repository.New(db, myLogger)
 	userService := service.New(userRepository, myLogger)
 
-	ctx := context.Background()
+	blobPath := os.Getenv("BLOB_STORE_PATH")
+	if blobPath == "" {
+		blobPath = "blobs"
+	}
+	blobs, err := filesystem.New(blobPath)
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to open blob store: %s", err.Error()))
+	}
+	profileConfig := profileService.DefaultConfig()
+	if maxAvatarBytes := os.Getenv("AVATAR_MAX_BYTES"); maxAvatarBytes != "" {
+		profileConfig.MaxAvatarBytes, err = strconv.ParseInt(maxAvatarBytes, 10, 64)
+		if err != nil {
+			myLogger.Fatal(fmt.Sprintf("Failed to get avatar size limit: %s", err.Error()))
+		}
+	}
+	profiles := profileService.New(profileRepository.New(db, myLogger), blobs, profileConfig, myLogger)
+	userService.OnRemove(profiles.OnUserRemoved)
 
-	subscriber, err := sub.New(fmt.Sprintf("nats://%s:%s", os.Getenv("NATS_HOST"), os.Getenv("NATS_PORT")), myLogger)
-	_, err = subscriber.Subscribe("NewUser", func(msg *nats.Msg) {
-		fmt.Println("Received message: " + string(msg.Data))
+	busConfig := bus.Config{
+		Backend:                  os.Getenv("EVENT_BUS"),
+		NatsURL:                  fmt.Sprintf("nats://%s:%s", os.Getenv("NATS_HOST"), os.Getenv("NATS_PORT")),
+		Group:                    os.Getenv("EVENT_GROUP"),
+		PostgresConnectionString: os.Getenv("EVENT_BUS_POSTGRES_URL"),
+		PostgresChannel:          os.Getenv("EVENT_BUS_POSTGRES_CHANNEL"),
+	}
+	// Replicas of the service share the group, so each event is applied by one of them. NATS_DURABLE is the
+	// name the group had before.
+	if busConfig.Group == "" {
+		busConfig.Group = os.Getenv("NATS_DURABLE")
+	}
+	if busConfig.Group == "" {
+		busConfig.Group = "go-users"
+	}
+	if busConfig.PostgresConnectionString == "" {
+		busConfig.PostgresConnectionString = pgconnect.ConnectionString(pgConfig)
+	}
+	if busConfig.Backend == bus.BackendMemory {
+		myLogger.Warning("In-memory event bus selected, no user events will be received from the auth service")
+	}
+	eventSchemas, err := api.NewEventRegistry()
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to load event schemas: %s", err.Error()))
+	}
+	userEventHandler := eventHandler.New(userService, eventSchemas, myLogger)
 
-		var newUser *user.User
-		err := json.Unmarshal(msg.Data, &newUser)
+	consumerConfig := sub.DefaultConfig(busConfig.Group)
+	consumerConfig.Key = userEventHandler.Key
+	if workers := os.Getenv("EVENT_WORKERS"); workers != "" {
+		consumerConfig.Workers.Workers, err = strconv.Atoi(workers)
 		if err != nil {
-			myLogger.Warning("Failed to unmarshal user")
-		} else {
-			err := userService.Save(ctx, newUser)
-			if err != nil {
-				myLogger.Warning("Failed to create user " + err.Error())
-			}
+			myLogger.Fatal(fmt.Sprintf("Failed to get event workers: %s", err.Error()))
 		}
-	})
+	}
+	if queueSize := os.Getenv("EVENT_QUEUE_SIZE"); queueSize != "" {
+		consumerConfig.Workers.QueueSize, err = strconv.Atoi(queueSize)
+		if err != nil {
+			myLogger.Fatal(fmt.Sprintf("Failed to get event queue size: %s", err.Error()))
+		}
+	}
+	if timeout := os.Getenv("EVENT_TIMEOUT"); timeout != "" {
+		consumerConfig.Workers.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			myLogger.Fatal(fmt.Sprintf("Failed to get event timeout: %s", err.Error()))
+		}
+	}
+	busConfig.Consumer = &consumerConfig
+
+	subscriber, err := bus.NewSubscriber(busConfig, myLogger)
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to connect event bus: %s", err.Error()))
+	}
+
+	deadLetterConfig := deadLetterService.DefaultConfig()
+	if threshold := os.Getenv("DEAD_LETTER_ALERT_THRESHOLD"); threshold != "" {
+		deadLetterConfig.AlertThreshold, err = strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			myLogger.Fatal(fmt.Sprintf("Failed to get dead letter alert threshold: %s", err.Error()))
+		}
+	}
+	deadLetters, err := deadLetterService.New(deadLetterRepository.New(db, myLogger), userEventHandler.Handle,
+		deadLetterConfig, prometheus.DefaultRegisterer, myLogger)
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to create dead letter service: %s", err.Error()))
+	}
+	deadLetterCtx, stopDeadLetters := context.WithCancel(context.Background())
+	go deadLetters.Run(deadLetterCtx)
 
+	_, err = userEventHandler.Subscribe(subscriber, deadLetters.Middleware)
 	if err != nil {
 		myLogger.Warning("Failed to subscribe")
 	}
 
 	defer cancel()
-	defer subscriber.Conn.Close()
 
 	router := mux.NewRouter()
 	router.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
@@ -107,6 +186,17 @@ func main() {
 			myLogger.Warning("Failed to write response")
 		}
 	})
+	router.Handle("/metrics", promhttp.Handler())
+
+	adminToken := middleware.AdminToken(os.Getenv("ADMIN_TOKEN"), myLogger)
+
+	v1 := router.PathPrefix("/v1").Subrouter()
+	handler.NewUserHandler(userService, myLogger).InitRoutes(v1)
+	handler.NewProfileHandler(profiles, myLogger).InitRoutes(v1, adminToken)
+
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(adminToken)
+	handler.NewDeadLetterHandler(deadLetters, myLogger).InitRoutes(adminRouter)
 
 	port := os.Getenv("PORT")
 	srv := &http.Server{
@@ -152,8 +242,19 @@ func main() {
 	ctx2, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Finish the fetched events, and hand back the ones still queued after the drain timeout, before the
+	// database goes away.
+	if err := subscriber.Close(); err != nil {
+		myLogger.Warning(fmt.Sprintf("Failed to close event bus: %s", err.Error()))
+	}
+	stopDeadLetters()
+
 	err = srv.Shutdown(ctx2)
 	if err != nil {
 		myLogger.Fatal("Could not shutdown the server (after getting signal): " + err.Error())
 	}
+
+	if err := db.Close(); err != nil {
+		myLogger.Warning(fmt.Sprintf("Failed to close database: %s", err.Error()))
+	}
 }
@@ -0,0 +1,95 @@
+// Command rebuild truncates the account projection and replays the event store into it. With -until it
+// replays only the events recorded up to that time, which rolls the projection back to that point. The
+// profiles and avatars of the users the replay does not bring back are deleted.
+package main
+
+import (
+	profileRepository "Golang-practice-2023/internal/profile/repository"
+	profileService "Golang-practice-2023/internal/profile/service"
+	"Golang-practice-2023/internal/user/repository"
+	"Golang-practice-2023/internal/user/service"
+	"Golang-practice-2023/pkg/blobstore/filesystem"
+	"Golang-practice-2023/pkg/logger"
+	"Golang-practice-2023/pkg/pgconnect"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func main() {
+	untilFlag := flag.String("until", "", "replay the events recorded up to this RFC 3339 time only")
+	flag.Parse()
+
+	var until time.Time
+	if *untilFlag != "" {
+		var err error
+		until, err = time.Parse(time.RFC3339, *untilFlag)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Invalid -until time: %s", err.Error()))
+		}
+	}
+
+	envPath, envErr := filepath.Abs("dev.env")
+	if envErr != nil {
+		log.Fatal(fmt.Sprintf("Can't get environment file: %s", envErr))
+	}
+
+	err := godotenv.Load(envPath)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Error loading .env file: %s", err.Error()))
+	}
+
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, err := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Error creating logger: %s", err))
+	}
+
+	pgPort, err := strconv.Atoi(os.Getenv("POSTGRES_PORT"))
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to get Postgresql port: %s", err))
+	}
+	db, err := pgconnect.ConnectDatabase(pgconnect.ConnectionConfigData{
+		Username:     os.Getenv("POSTGRES_USERNAME"),
+		Password:     os.Getenv("POSTGRES_PASSWORD"),
+		DatabaseName: os.Getenv("POSTGRES_DATABASE"),
+		Port:         pgPort,
+		Host:         os.Getenv("POSTGRES_HOST"),
+	})
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to connect database: %s", err.Error()))
+	}
+	defer db.Close()
+
+	blobPath := os.Getenv("BLOB_STORE_PATH")
+	if blobPath == "" {
+		blobPath = "blobs"
+	}
+	blobs, err := filesystem.New(blobPath)
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to open blob store: %s", err.Error()))
+	}
+	profiles := profileService.New(profileRepository.New(db, myLogger), blobs, profileService.DefaultConfig(), myLogger)
+
+	userService := service.New(repository.New(db, myLogger), myLogger)
+	userService.OnRemove(profiles.OnUserRemoved)
+
+	started := time.Now()
+	report, err := userService.Rebuild(context.Background(), until.UTC())
+	if err != nil {
+		myLogger.Fatal(fmt.Sprintf("Failed to rebuild users: %s", err.Error()))
+	}
+
+	myLogger.Info(fmt.Sprintf("Replayed %d events (%d applied, %d skipped) into %d users in %s",
+		report.Events, report.Applied, report.Skipped, report.Users, time.Since(started).Round(time.Millisecond)))
+	for _, id := range report.OrphanedProfiles {
+		myLogger.Warning(fmt.Sprintf("Deleted the profile of user %s, who is not in the replayed events", id))
+	}
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/deadletter"
+	"Golang-practice-2023/internal/domain/logger"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const columns = "id, subject, messageId, headers, payload, error, attempts, status, createdAt, updatedAt, resolvedAt"
+
+type Repository struct {
+	db     *sqlx.DB
+	logger logger.Logger
+}
+
+func New(db *sqlx.DB, logger logger.Logger) *Repository {
+	return &Repository{db: db, logger: logger}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (r *Repository) Create(ctx context.Context, message *deadletter.Message) error {
+	headers, err := json.Marshal(message.Headers)
+	if err != nil {
+		return apperrors.ErrInternalJsonProcessing
+	}
+
+	query := `INSERT INTO dead_letter (subject, messageId, headers, payload, error, attempts)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING ` + columns
+
+	row := r.db.QueryRowContext(ctx, query, message.Subject, message.MessageID, headers, []byte(message.Payload),
+		message.Error, message.Attempts)
+	created, err := scanMessage(row)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	*message = *created
+
+	return nil
+}
+
+func (r *Repository) Get(ctx context.Context, id uuid.UUID) (*deadletter.Message, error) {
+	query := "SELECT " + columns + " FROM dead_letter WHERE id=$1"
+
+	message, err := scanMessage(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrDeadLetterNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return message, nil
+}
+
+func (r *Repository) List(ctx context.Context, filter deadletter.Filter) ([]deadletter.Message, error) {
+	query := "SELECT " + columns + " FROM dead_letter WHERE true"
+	args := make([]interface{}, 0, 4)
+	if filter.Status != "" {
+		args = append(args, string(filter.Status))
+		query += fmt.Sprintf(" AND status=$%d", len(args))
+	}
+	if filter.Subject != "" {
+		args = append(args, filter.Subject)
+		query += fmt.Sprintf(" AND subject=$%d", len(args))
+	}
+	query += " ORDER BY createdAt, id"
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	messages := make([]deadletter.Message, 0)
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		messages = append(messages, *message)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return messages, nil
+}
+
+func (r *Repository) Resolve(ctx context.Context, id uuid.UUID, resolve func(message *deadletter.Message) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := "SELECT " + columns + " FROM dead_letter WHERE id=$1 FOR UPDATE"
+
+	message, err := scanMessage(tx.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return apperrors.ErrDeadLetterNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	if message.Status != deadletter.StatusPending {
+		return apperrors.ErrDeadLetterResolved
+	}
+
+	if err := resolve(message); err != nil {
+		return err
+	}
+
+	query = `UPDATE dead_letter SET subject=$1, payload=$2, error=$3, attempts=$4, status=$5, updatedAt=current_timestamp,
+		resolvedAt=CASE WHEN $5 = 'pending' THEN NULL ELSE current_timestamp END
+		WHERE id=$6 RETURNING ` + columns
+
+	row := tx.QueryRowContext(ctx, query, message.Subject, []byte(message.Payload), message.Error, message.Attempts,
+		string(message.Status), message.ID)
+	updated, err := scanMessage(row)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	*message = *updated
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+func (r *Repository) GetBacklog(ctx context.Context) (*deadletter.Backlog, error) {
+	query := "SELECT count(*), min(createdAt) FROM dead_letter WHERE status='pending'"
+
+	var backlog deadletter.Backlog
+	var oldest sql.NullTime
+	if err := r.db.QueryRowContext(ctx, query).Scan(&backlog.Pending, &oldest); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	if oldest.Valid {
+		backlog.Oldest = &oldest.Time
+	}
+
+	return &backlog, nil
+}
+
+func scanMessage(row rowScanner) (*deadletter.Message, error) {
+	var message deadletter.Message
+	var headers, payload []byte
+	var resolvedAt sql.NullTime
+	err := row.Scan(&message.ID, &message.Subject, &message.MessageID, &headers, &payload, &message.Error,
+		&message.Attempts, &message.Status, &message.CreatedAt, &message.UpdatedAt, &resolvedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(headers, &message.Headers); err != nil {
+		return nil, err
+	}
+	message.Payload = string(payload)
+	if resolvedAt.Valid {
+		message.ResolvedAt = &resolvedAt.Time
+	}
+
+	return &message, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import "github.com/prometheus/client_golang/prometheus"
+
+type metrics struct {
+	pending   prometheus.Gauge
+	oldestAge prometheus.Gauge
+	received  *prometheus.CounterVec
+	replayed  prometheus.Counter
+}
+
+func newMetrics(registerer prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		pending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dead_letter_pending_messages",
+			Help: "Number of dead letters waiting to be replayed or discarded.",
+		}),
+		oldestAge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "dead_letter_oldest_pending_age_seconds",
+			Help: "Age of the oldest pending dead letter.",
+		}),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dead_letter_messages_total",
+			Help: "Number of messages moved to the dead letter table.",
+		}, []string{"subject"}),
+		replayed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dead_letter_replayed_total",
+			Help: "Number of dead letters replayed successfully.",
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.pending, m.oldestAge, m.received, m.replayed} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/deadletter"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+const maxErrorLength = 2048
+
+type Config struct {
+	// AlertThreshold is the number of pending dead letters above which an error is logged.
+	AlertThreshold int64
+	PollInterval   time.Duration
+	ReplayBatch    int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		AlertThreshold: 100,
+		PollInterval:   30 * time.Second,
+		ReplayBatch:    100,
+	}
+}
+
+type Service struct {
+	repository deadletter.Repository
+	// replay applies a message again; it is the event handler without the dead letter middleware.
+	replay  pubsub.Handler
+	config  Config
+	metrics *metrics
+	logger  logger.Logger
+
+	alertMu  sync.Mutex
+	alerting bool
+}
+
+func New(repository deadletter.Repository, replay pubsub.Handler, config Config, registerer prometheus.Registerer,
+	logger logger.Logger) (*Service, error) {
+	m, err := newMetrics(registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{repository: repository, replay: replay, config: config, metrics: m, logger: logger}, nil
+}
+
+// Middleware stores messages whose handler failed permanently or on their last delivery, and acks them.
+// If the dead letter cannot be stored the original error is returned, so the bus keeps its own behaviour.
+func (service *Service) Middleware(handler pubsub.Handler) pubsub.Handler {
+	return func(msg *pubsub.Message) error {
+		err := handler(msg)
+		if err == nil || !(msg.LastAttempt || pubsub.IsPermanent(err)) {
+			return err
+		}
+
+		message := &deadletter.Message{
+			Subject:   msg.Subject,
+			MessageID: msg.ID,
+			Headers:   msg.Headers,
+			Payload:   string(msg.Data),
+			Error:     truncateError(err),
+			Attempts:  msg.Attempt,
+		}
+		if message.Headers == nil {
+			message.Headers = make(map[string][]string)
+		}
+		if createErr := service.repository.Create(context.Background(), message); createErr != nil {
+			service.logger.Error(fmt.Sprintf("Failed to store dead letter for %s message %s: %s", msg.Subject, msg.ID,
+				createErr.Error()))
+			return err
+		}
+
+		service.logger.Warning(fmt.Sprintf("Moved %s message %s to dead letter %s: %s", msg.Subject, msg.ID, message.ID,
+			err.Error()))
+		service.metrics.received.WithLabelValues(msg.Subject).Inc()
+		service.UpdateBacklog(context.Background())
+		return nil
+	}
+}
+
+func (service *Service) Get(ctx context.Context, id uuid.UUID) (*deadletter.Message, error) {
+	return service.repository.Get(ctx, id)
+}
+
+func (service *Service) List(ctx context.Context, filter deadletter.Filter) ([]deadletter.Message, error) {
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return nil, apperrors.ErrInvalidDeadLetterStatus
+	}
+	return service.repository.List(ctx, filter)
+}
+
+func (service *Service) Edit(ctx context.Context, id uuid.UUID, edit deadletter.Edit) (*deadletter.Message, error) {
+	if edit.Subject != nil && *edit.Subject == "" {
+		return nil, apperrors.ErrInvalidRequestBody
+	}
+
+	var edited *deadletter.Message
+	err := service.repository.Resolve(ctx, id, func(message *deadletter.Message) error {
+		if edit.Subject != nil {
+			message.Subject = *edit.Subject
+		}
+		if edit.Payload != nil {
+			message.Payload = *edit.Payload
+		}
+		edited = message
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return edited, nil
+}
+
+// Replay applies a pending message again. The message is marked replayed on success; on failure it stays
+// pending with the new error and one more attempt. A message is never replayed twice at the same time.
+func (service *Service) Replay(ctx context.Context, id uuid.UUID) (*deadletter.Message, error) {
+	replayed, err := service.replayOne(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	service.UpdateBacklog(ctx)
+	return replayed, nil
+}
+
+// ReplayAll replays the pending messages matching the filter, oldest first.
+func (service *Service) ReplayAll(ctx context.Context, filter deadletter.Filter) (*deadletter.ReplayReport, error) {
+	filter.Status = deadletter.StatusPending
+	if filter.Limit <= 0 || filter.Limit > service.config.ReplayBatch {
+		filter.Limit = service.config.ReplayBatch
+	}
+
+	messages, err := service.repository.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &deadletter.ReplayReport{}
+	for i := range messages {
+		replayed, err := service.replayOne(ctx, messages[i].ID)
+		if errors.Is(err, apperrors.ErrDeadLetterResolved) {
+			// Resolved by another request since it was listed.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if replayed.Status == deadletter.StatusReplayed {
+			report.Replayed++
+		} else {
+			report.Failed++
+		}
+	}
+
+	service.UpdateBacklog(ctx)
+	return report, nil
+}
+
+func (service *Service) Discard(ctx context.Context, id uuid.UUID) error {
+	err := service.repository.Resolve(ctx, id, func(message *deadletter.Message) error {
+		message.Status = deadletter.StatusDiscarded
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	service.UpdateBacklog(ctx)
+	return nil
+}
+
+// Run keeps the backlog metrics up to date and logs an error while the backlog is above the threshold.
+func (service *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(service.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		service.UpdateBacklog(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (service *Service) UpdateBacklog(ctx context.Context) {
+	backlog, err := service.repository.GetBacklog(ctx)
+	if err != nil {
+		return
+	}
+
+	service.metrics.pending.Set(float64(backlog.Pending))
+	if backlog.Oldest != nil {
+		service.metrics.oldestAge.Set(time.Since(*backlog.Oldest).Seconds())
+	} else {
+		service.metrics.oldestAge.Set(0)
+	}
+
+	service.alertMu.Lock()
+	defer service.alertMu.Unlock()
+	alerting := service.config.AlertThreshold > 0 && backlog.Pending >= service.config.AlertThreshold
+	if alerting && !service.alerting {
+		service.logger.Error(fmt.Sprintf("Dead letter backlog reached %d messages (threshold %d)", backlog.Pending,
+			service.config.AlertThreshold))
+	}
+	if !alerting && service.alerting {
+		service.logger.Info(fmt.Sprintf("Dead letter backlog is back to %d messages", backlog.Pending))
+	}
+	service.alerting = alerting
+}
+
+func (service *Service) replayOne(ctx context.Context, id uuid.UUID) (*deadletter.Message, error) {
+	var replayed *deadletter.Message
+	err := service.repository.Resolve(ctx, id, func(message *deadletter.Message) error {
+		service.replayMessage(ctx, message)
+		replayed = message
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed.Status == deadletter.StatusReplayed {
+		service.metrics.replayed.Inc()
+	}
+	return replayed, nil
+}
+
+func (service *Service) replayMessage(ctx context.Context, message *deadletter.Message) {
+	message.Attempts++
+	err := service.replay((&pubsub.Message{
+		ID:          message.MessageID,
+		Subject:     message.Subject,
+		Headers:     message.Headers,
+		Data:        []byte(message.Payload),
+		Attempt:     message.Attempts,
+		LastAttempt: true,
+	}).WithContext(ctx))
+	if err != nil {
+		message.Error = truncateError(err)
+	} else {
+		message.Status = deadletter.StatusReplayed
+	}
+}
+
+func truncateError(err error) string {
+	message := err.Error()
+	if len(message) > maxErrorLength {
+		return message[:maxErrorLength]
+	}
+	return message
+}
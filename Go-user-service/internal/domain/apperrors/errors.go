@@ -5,11 +5,33 @@ import "errors"
 var ErrUserNotFound = errors.New("user not found")
 var ErrAlreadyRegisteredUserEmail = errors.New("user with the email already exists")
 var ErrInvalidEmailFormat = errors.New("email validation failed")
-var ErrInvalidPasswordFormat = errors.New("password validation failed")
 var ErrInvalidRequestFormat = errors.New("invalid request format")
 var ErrInvalidRequestBody = errors.New("invalid request body")
 var ErrInvalidIdFormat = errors.New("invalid id format (not uuid)")
+var ErrInvalidDateFormat = errors.New("invalid date format (not RFC 3339)")
+var ErrInvalidSearchQuery = errors.New("search query must have between 1 and 100 characters")
 
 var ErrInternalJsonProcessing = errors.New("failed to process json")
 var ErrNatsPublishing = errors.New("failed to publish message to NATS")
 var ErrDbQueryProcessing = errors.New("failed to execute query to db")
+var ErrBlobStoreProcessing = errors.New("failed to access blob store")
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+var ErrDeadLetterResolved = errors.New("dead letter was already replayed or discarded")
+var ErrInvalidDeadLetterStatus = errors.New("invalid dead letter status")
+var ErrInvalidOffsetFormat = errors.New("invalid offset format")
+var ErrInvalidLimitFormat = errors.New("invalid limit format")
+var ErrUnauthorized = errors.New("missing or invalid admin token")
+
+var ErrEventAlreadyProcessed = errors.New("event was already processed")
+var ErrStaleUserEvent = errors.New("event is older than the stored user")
+
+var ErrProfileNotFound = errors.New("profile not found")
+var ErrAvatarNotFound = errors.New("avatar not found")
+var ErrInvalidDisplayName = errors.New("display name validation failed")
+var ErrInvalidLocale = errors.New("locale validation failed (not a BCP 47 language tag)")
+var ErrInvalidTimeZone = errors.New("time zone validation failed (not an IANA time zone)")
+var ErrInvalidPreferences = errors.New("preferences validation failed (not a JSON object)")
+var ErrInvalidAvatar = errors.New("avatar is not a valid image")
+var ErrUnsupportedAvatarType = errors.New("avatar must be a PNG, JPEG or GIF image")
+var ErrAvatarTooLarge = errors.New("avatar is too large")
@@ -0,0 +1,60 @@
+package deadletter
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusReplayed  Status = "replayed"
+	StatusDiscarded Status = "discarded"
+)
+
+func (s Status) IsValid() bool {
+	switch s {
+	case StatusPending, StatusReplayed, StatusDiscarded:
+		return true
+	}
+	return false
+}
+
+// Message is an event that could not be applied, stored as it was received.
+type Message struct {
+	ID         uuid.UUID           `json:"id"`
+	Subject    string              `json:"subject"`
+	MessageID  string              `json:"message_id,omitempty"`
+	Headers    map[string][]string `json:"headers"`
+	Payload    string              `json:"payload"`
+	Error      string              `json:"error"`
+	Attempts   int                 `json:"attempts"`
+	Status     Status              `json:"status"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+	ResolvedAt *time.Time          `json:"resolved_at,omitempty"`
+}
+
+type Filter struct {
+	Status  Status
+	Subject string
+	Offset  int
+	Limit   int
+}
+
+// Edit replaces the subject or the payload of a pending message before it is replayed.
+type Edit struct {
+	Subject *string `json:"subject"`
+	Payload *string `json:"payload"`
+}
+
+type ReplayReport struct {
+	Replayed int `json:"replayed"`
+	Failed   int `json:"failed"`
+}
+
+type Backlog struct {
+	Pending int64
+	Oldest  *time.Time
+}
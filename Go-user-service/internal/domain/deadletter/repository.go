@@ -0,0 +1,17 @@
+package deadletter
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	Create(ctx context.Context, message *Message) error
+	Get(ctx context.Context, id uuid.UUID) (*Message, error)
+	List(ctx context.Context, filter Filter) ([]Message, error)
+	// Resolve locks the pending message until resolve returns, then stores the subject, payload, error, attempts
+	// and status resolve left it with. Concurrent calls for a message run one after the other; it returns
+	// apperrors.ErrDeadLetterResolved once the message is no longer pending, and stores nothing if resolve fails.
+	Resolve(ctx context.Context, id uuid.UUID, resolve func(message *Message) error) error
+	GetBacklog(ctx context.Context) (*Backlog, error)
+}
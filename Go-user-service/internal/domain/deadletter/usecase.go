@@ -0,0 +1,15 @@
+package deadletter
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	Get(ctx context.Context, id uuid.UUID) (*Message, error)
+	List(ctx context.Context, filter Filter) ([]Message, error)
+	Edit(ctx context.Context, id uuid.UUID, edit Edit) (*Message, error)
+	Replay(ctx context.Context, id uuid.UUID) (*Message, error)
+	ReplayAll(ctx context.Context, filter Filter) (*ReplayReport, error)
+	Discard(ctx context.Context, id uuid.UUID) error
+}
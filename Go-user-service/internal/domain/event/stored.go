@@ -0,0 +1,19 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stored is a consumed event as kept in the event store. Data is upcast to DataSchema, the version the
+// event was applied with.
+type Stored struct {
+	Position   int64           `json:"position"`
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Subject    string          `json:"subject"`
+	DataSchema string          `json:"dataschema"`
+	Data       json.RawMessage `json:"data"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	RecordedAt time.Time       `json:"recorded_at"`
+}
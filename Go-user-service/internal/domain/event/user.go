@@ -0,0 +1,39 @@
+package event
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	SubjectUserCreated = "users.created"
+	SubjectUserUpdated = "users.updated"
+	SubjectUserDeleted = "users.deleted"
+
+	// SubjectNewUser is the subject the auth service used before the users.* scheme. Messages still waiting
+	// in its outbox are published there and carry a UserCreated payload.
+	SubjectNewUser = "NewUser"
+
+	// SubjectUserReplay is where the backfills of the auth service publish by default. It carries UserCreated
+	// events with the current state of each user, applied like the live ones.
+	SubjectUserReplay = "users.replay"
+)
+
+type UserCreated struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type UserUpdated struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type UserDeleted struct {
+	ID        uuid.UUID `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
@@ -0,0 +1,28 @@
+package profile
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Profile is the data a user keeps in this service on top of the replicated account. Empty fields are unset.
+type Profile struct {
+	UserID      uuid.UUID       `json:"user_id"`
+	DisplayName string          `json:"display_name"`
+	Locale      string          `json:"locale"`
+	TimeZone    string          `json:"time_zone"`
+	Preferences json.RawMessage `json:"preferences"`
+	Avatar      *Avatar         `json:"avatar,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Avatar describes the uploaded picture; the image and its thumbnail are kept in the BlobStore.
+type Avatar struct {
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package profile
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	Get(ctx context.Context, userID uuid.UUID) (*Profile, error)
+	// Save creates or replaces the profile of a user, keeping its avatar.
+	Save(ctx context.Context, profile *Profile) error
+	// SetAvatar records the avatar of an existing profile; nil removes it.
+	SetAvatar(ctx context.Context, userID uuid.UUID, avatar *Avatar) error
+	Delete(ctx context.Context, userID uuid.UUID) error
+}
@@ -0,0 +1,25 @@
+package profile
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"io"
+)
+
+type Service interface {
+	Get(ctx context.Context, userID uuid.UUID) (*Profile, error)
+	Save(ctx context.Context, profile *Profile) error
+	Delete(ctx context.Context, userID uuid.UUID) error
+	SetAvatar(ctx context.Context, userID uuid.UUID, image io.Reader) (*Avatar, error)
+	// GetAvatar opens the avatar image, or its thumbnail, and returns its content type.
+	GetAvatar(ctx context.Context, userID uuid.UUID, thumbnail bool) (io.ReadCloser, string, error)
+	DeleteAvatar(ctx context.Context, userID uuid.UUID) error
+}
+
+// BlobStore keeps files by key. Get fails with an error matching fs.ErrNotExist for unknown keys, and
+// Delete succeeds for them.
+type BlobStore interface {
+	Put(ctx context.Context, key string, content io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
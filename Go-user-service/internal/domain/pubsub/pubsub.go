@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+)
+
+// Message is an event as it travels over the bus. Subjects are dot separated tokens; subscribers can use
+// the NATS wildcards "*" (one token) and ">" (one or more trailing tokens) on every backend.
+type Message struct {
+	// ID identifies the message for deduplication on backends that support it; publishing the same ID
+	// twice within the deduplication window stores the message once.
+	ID      string
+	Subject string
+	Headers map[string][]string
+	Data    []byte
+	// Attempt counts the deliveries of the message, starting at 1. LastAttempt is set when the backend
+	// will not deliver the message again if the handler fails.
+	Attempt     int
+	LastAttempt bool
+
+	ctx context.Context
+}
+
+// Context returns the context the message is handled in. Backends that bound the handling cancel it when
+// the handling times out or the subscriber shuts down; it is never nil.
+func (m *Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// WithContext returns a shallow copy of the message handled in ctx.
+func (m *Message) WithContext(ctx context.Context) *Message {
+	msg := *m
+	msg.ctx = ctx
+	return &msg
+}
+
+// Handler processes a message. Returning an error asks the backend to redeliver the message later, on
+// backends that support redelivery; the others only log it. Errors wrapped with Permanent are never retried.
+type Handler func(msg *Message) error
+
+type Middleware func(handler Handler) Handler
+
+type Publisher interface {
+	Publish(msg *Message) error
+	Close() error
+}
+
+type Subscription interface {
+	Unsubscribe() error
+}
+
+type Subscriber interface {
+	Subscribe(subject string, handler Handler) (Subscription, error)
+	Close() error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error that redelivering the same message cannot fix, like a malformed payload.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
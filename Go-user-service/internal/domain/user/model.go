@@ -2,13 +2,58 @@ package user
 
 import (
 	"github.com/google/uuid"
+	"regexp"
+	"strings"
 	"time"
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	Email        string    `json:"email"`
-	Passwordhash string    `json:"passwordhash"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Filter selects users for listing. Email matches a part of the address, ignoring case; zero times and
+// an empty email do not filter.
+type Filter struct {
+	Email         string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Offset        int
+	Limit         int
+}
+
+// SearchQuery looks users up by their email and profile display name, tolerating typos.
+type SearchQuery struct {
+	Text   string
+	Offset int
+	Limit  int
+}
+
+var searchTermRegex = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// Terms returns the lower-cased words of the query; punctuation only separates them.
+func (q SearchQuery) Terms() []string {
+	return searchTermRegex.FindAllString(strings.ToLower(q.Text), -1)
+}
+
+// SearchResult is a matching user, best matches first. The highlights are HTML escaped copies of the
+// email and display name with the words matching the query wrapped in <mark>.
+type SearchResult struct {
+	User
+	DisplayName          string
+	Rank                 float64
+	EmailHighlight       string
+	DisplayNameHighlight string
+}
+
+// RebuildReport sums up a replay of the event store into the account projection.
+type RebuildReport struct {
+	Events  int
+	Applied int
+	Skipped int
+	Users   int
+	// OrphanedProfiles are the users whose profile was deleted, as the replay did not bring them back.
+	OrphanedProfiles []uuid.UUID
 }
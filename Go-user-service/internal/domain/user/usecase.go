@@ -1,14 +1,21 @@
 package user
 
 import (
+	"Golang-practice-2023/internal/domain/event"
 	"context"
 	"github.com/google/uuid"
+	"time"
 )
 
 type Service interface {
 	Create(ctx context.Context, user *User) error
-	Save(ctx context.Context, user *User) error
+	Save(ctx context.Context, user *User, e *event.Stored) error
+	Remove(ctx context.Context, id uuid.UUID, deletedAt time.Time, e *event.Stored) error
+	Rebuild(ctx context.Context, until time.Time) (*RebuildReport, error)
 	GetById(ctx context.Context, id uuid.UUID) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	List(ctx context.Context, filter Filter) ([]User, error)
+	Search(ctx context.Context, query SearchQuery) ([]SearchResult, error)
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/profile"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const columns = `userId, displayName, locale, timeZone, preferences, avatarContentType, avatarSize, avatarWidth,
+	avatarHeight, avatarUpdatedAt, createdAt, updatedAt`
+
+type Repository struct {
+	db     *sqlx.DB
+	logger logger.Logger
+}
+
+func New(db *sqlx.DB, logger logger.Logger) *Repository {
+	return &Repository{db: db, logger: logger}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (r *Repository) Get(ctx context.Context, userID uuid.UUID) (*profile.Profile, error) {
+	query := "SELECT " + columns + " FROM profile WHERE userId=$1"
+
+	p, err := scanProfile(r.db.QueryRowContext(ctx, query, userID))
+	if err == sql.ErrNoRows {
+		return nil, apperrors.ErrProfileNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return p, nil
+}
+
+func (r *Repository) Save(ctx context.Context, p *profile.Profile) error {
+	query := `INSERT INTO profile (userId, displayName, locale, timeZone, preferences) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (userId) DO UPDATE SET displayName=EXCLUDED.displayName, locale=EXCLUDED.locale,
+			timeZone=EXCLUDED.timeZone, preferences=EXCLUDED.preferences, updatedAt=current_timestamp
+		RETURNING ` + columns
+
+	row := r.db.QueryRowContext(ctx, query, p.UserID, p.DisplayName, p.Locale, p.TimeZone, []byte(p.Preferences))
+	saved, err := scanProfile(row)
+	if isForeignKeyViolation(err) {
+		return apperrors.ErrUserNotFound
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	*p = *saved
+
+	return nil
+}
+
+func (r *Repository) SetAvatar(ctx context.Context, userID uuid.UUID, avatar *profile.Avatar) error {
+	var result sql.Result
+	var err error
+	if avatar == nil {
+		query := `UPDATE profile SET avatarContentType=NULL, avatarSize=NULL, avatarWidth=NULL, avatarHeight=NULL,
+			avatarUpdatedAt=NULL, updatedAt=current_timestamp WHERE userId=$1`
+		result, err = r.db.ExecContext(ctx, query, userID)
+	} else {
+		query := `UPDATE profile SET avatarContentType=$1, avatarSize=$2, avatarWidth=$3, avatarHeight=$4,
+			avatarUpdatedAt=$5, updatedAt=current_timestamp WHERE userId=$6`
+		result, err = r.db.ExecContext(ctx, query, avatar.ContentType, avatar.Size, avatar.Width, avatar.Height,
+			avatar.UpdatedAt, userID)
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return requireRow(result)
+}
+
+func (r *Repository) Delete(ctx context.Context, userID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM profile WHERE userId=$1", userID)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return requireRow(result)
+}
+
+func requireRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.ErrDbQueryProcessing
+	}
+	if affected == 0 {
+		return apperrors.ErrProfileNotFound
+	}
+	return nil
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+func scanProfile(row rowScanner) (*profile.Profile, error) {
+	var p profile.Profile
+	var preferences []byte
+	var contentType sql.NullString
+	var size sql.NullInt64
+	var width, height sql.NullInt32
+	var avatarUpdatedAt sql.NullTime
+	err := row.Scan(&p.UserID, &p.DisplayName, &p.Locale, &p.TimeZone, &preferences, &contentType, &size, &width,
+		&height, &avatarUpdatedAt, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Preferences = preferences
+	if contentType.Valid {
+		p.Avatar = &profile.Avatar{
+			ContentType: contentType.String,
+			Size:        size.Int64,
+			Width:       int(width.Int32),
+			Height:      int(height.Int32),
+			UpdatedAt:   avatarUpdatedAt.Time,
+		}
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/profile"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata"
+	"unicode"
+	"unicode/utf8"
+)
+
+const thumbnailContentType = "image/png"
+
+// avatarFormats maps the sniffed content types accepted for avatars to the name of their image decoder.
+var avatarFormats = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/gif":  "gif",
+}
+
+var localeRegex = regexp.MustCompile("^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{1,8})*$")
+
+type Config struct {
+	MaxDisplayNameLength int
+	MaxPreferencesBytes  int
+	MaxAvatarBytes       int64
+	// MaxAvatarDimension bounds the width and height of avatars, so small files cannot decode to huge images.
+	MaxAvatarDimension int
+	ThumbnailSize      int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxDisplayNameLength: 64,
+		MaxPreferencesBytes:  16 << 10,
+		MaxAvatarBytes:       5 << 20,
+		MaxAvatarDimension:   4096,
+		ThumbnailSize:        128,
+	}
+}
+
+type Service struct {
+	repository profile.Repository
+	blobs      profile.BlobStore
+	config     Config
+	logger     logger.Logger
+}
+
+func New(repository profile.Repository, blobs profile.BlobStore, config Config, logger logger.Logger) *Service {
+	return &Service{repository: repository, blobs: blobs, config: config, logger: logger}
+}
+
+func (service *Service) Get(ctx context.Context, userID uuid.UUID) (*profile.Profile, error) {
+	return service.repository.Get(ctx, userID)
+}
+
+func (service *Service) Save(ctx context.Context, p *profile.Profile) error {
+	p.DisplayName = strings.TrimSpace(p.DisplayName)
+	if err := service.validateDisplayName(p.DisplayName); err != nil {
+		return err
+	}
+	if err := validateLocale(p.Locale); err != nil {
+		return err
+	}
+	if err := validateTimeZone(p.TimeZone); err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(p.Preferences)) == 0 {
+		p.Preferences = json.RawMessage("{}")
+	}
+	if err := service.validatePreferences(p.Preferences); err != nil {
+		return err
+	}
+
+	return service.repository.Save(ctx, p)
+}
+
+// Delete also removes the avatar files when the profile is already gone, as a previous deletion may have
+// failed to.
+func (service *Service) Delete(ctx context.Context, userID uuid.UUID) error {
+	err := service.repository.Delete(ctx, userID)
+	if err != nil && !errors.Is(err, apperrors.ErrProfileNotFound) {
+		return err
+	}
+	service.deleteAvatarBlobs(ctx, userID)
+	return err
+}
+
+// OnUserRemoved removes the avatar files of a deleted user, whose profile the database deleted with the account.
+func (service *Service) OnUserRemoved(ctx context.Context, userID uuid.UUID) {
+	service.deleteAvatarBlobs(ctx, userID)
+}
+
+// SetAvatar stores an uploaded image and its thumbnail. The content type is sniffed from the image
+// itself; the one declared by the client is not trusted.
+func (service *Service) SetAvatar(ctx context.Context, userID uuid.UUID, content io.Reader) (*profile.Avatar, error) {
+	if _, err := service.repository.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, service.config.MaxAvatarBytes+1))
+	if err != nil {
+		return nil, apperrors.ErrInvalidRequestBody
+	}
+	if int64(len(data)) > service.config.MaxAvatarBytes {
+		return nil, apperrors.ErrAvatarTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	format, ok := avatarFormats[contentType]
+	if !ok {
+		return nil, apperrors.ErrUnsupportedAvatarType
+	}
+
+	imageConfig, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decodedFormat != format {
+		return nil, apperrors.ErrInvalidAvatar
+	}
+	if imageConfig.Width > service.config.MaxAvatarDimension || imageConfig.Height > service.config.MaxAvatarDimension {
+		return nil, apperrors.ErrAvatarTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, apperrors.ErrInvalidAvatar
+	}
+	var thumb bytes.Buffer
+	if err := png.Encode(&thumb, thumbnail(img, service.config.ThumbnailSize)); err != nil {
+		service.logger.Warning(fmt.Sprintf("Failed to encode avatar thumbnail of user %s: %s", userID, err.Error()))
+		return nil, apperrors.ErrInvalidAvatar
+	}
+
+	if err := service.blobs.Put(ctx, avatarKey(userID, false), bytes.NewReader(data)); err != nil {
+		service.logger.Warning(fmt.Sprintf("Failed to store avatar of user %s: %s", userID, err.Error()))
+		return nil, apperrors.ErrBlobStoreProcessing
+	}
+	if err := service.blobs.Put(ctx, avatarKey(userID, true), &thumb); err != nil {
+		service.logger.Warning(fmt.Sprintf("Failed to store avatar thumbnail of user %s: %s", userID, err.Error()))
+		return nil, apperrors.ErrBlobStoreProcessing
+	}
+
+	avatar := &profile.Avatar{
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       imageConfig.Width,
+		Height:      imageConfig.Height,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	if err := service.repository.SetAvatar(ctx, userID, avatar); err != nil {
+		return nil, err
+	}
+
+	return avatar, nil
+}
+
+func (service *Service) GetAvatar(ctx context.Context, userID uuid.UUID, thumbnail bool) (io.ReadCloser, string, error) {
+	p, err := service.repository.Get(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if p.Avatar == nil {
+		return nil, "", apperrors.ErrAvatarNotFound
+	}
+
+	content, err := service.blobs.Get(ctx, avatarKey(userID, thumbnail))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", apperrors.ErrAvatarNotFound
+	}
+	if err != nil {
+		service.logger.Warning(fmt.Sprintf("Failed to read avatar of user %s: %s", userID, err.Error()))
+		return nil, "", apperrors.ErrBlobStoreProcessing
+	}
+
+	if thumbnail {
+		return content, thumbnailContentType, nil
+	}
+	return content, p.Avatar.ContentType, nil
+}
+
+func (service *Service) DeleteAvatar(ctx context.Context, userID uuid.UUID) error {
+	p, err := service.repository.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if p.Avatar == nil {
+		return apperrors.ErrAvatarNotFound
+	}
+
+	if err := service.repository.SetAvatar(ctx, userID, nil); err != nil {
+		return err
+	}
+	service.deleteAvatarBlobs(ctx, userID)
+	return nil
+}
+
+// deleteAvatarBlobs removes the avatar files once the profile no longer points at them; a failure only
+// leaves an orphaned file behind, so it is logged.
+func (service *Service) deleteAvatarBlobs(ctx context.Context, userID uuid.UUID) {
+	for _, key := range []string{avatarKey(userID, false), avatarKey(userID, true)} {
+		if err := service.blobs.Delete(ctx, key); err != nil {
+			service.logger.Warning(fmt.Sprintf("Failed to delete avatar blob %s: %s", key, err.Error()))
+		}
+	}
+}
+
+func avatarKey(userID uuid.UUID, thumbnail bool) string {
+	if thumbnail {
+		return "avatars/" + userID.String() + "/thumbnail.png"
+	}
+	return "avatars/" + userID.String() + "/original"
+}
+
+func (service *Service) validateDisplayName(name string) error {
+	if !utf8.ValidString(name) || utf8.RuneCountInString(name) > service.config.MaxDisplayNameLength {
+		return apperrors.ErrInvalidDisplayName
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return apperrors.ErrInvalidDisplayName
+		}
+	}
+	return nil
+}
+
+func validateLocale(locale string) error {
+	if locale != "" && !localeRegex.MatchString(locale) {
+		return apperrors.ErrInvalidLocale
+	}
+	return nil
+}
+
+func validateTimeZone(timeZone string) error {
+	if timeZone == "" {
+		return nil
+	}
+	if timeZone == "Local" {
+		return apperrors.ErrInvalidTimeZone
+	}
+	if _, err := time.LoadLocation(timeZone); err != nil {
+		return apperrors.ErrInvalidTimeZone
+	}
+	return nil
+}
+
+func (service *Service) validatePreferences(preferences json.RawMessage) error {
+	if len(preferences) > service.config.MaxPreferencesBytes {
+		return apperrors.ErrInvalidPreferences
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(preferences, &object); err != nil || object == nil {
+		return apperrors.ErrInvalidPreferences
+	}
+	return nil
+}
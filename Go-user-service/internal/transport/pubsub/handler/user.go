@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/pkg/cloudevents"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// UserHandler applies the user events of the auth service to the local copy of the accounts. Events that
+// can never be applied (malformed, failing their schema) fail with a permanent error; other failures are
+// returned as is so the bus redelivers the event. Redelivered and out-of-order events are acknowledged
+// without being applied again.
+type UserHandler struct {
+	service user.Service
+	schemas *cloudevents.Registry
+	logger  logger.Logger
+}
+
+func New(service user.Service, schemas *cloudevents.Registry, logger logger.Logger) *UserHandler {
+	return &UserHandler{service: service, schemas: schemas, logger: logger}
+}
+
+func (h *UserHandler) handlers() map[string]pubsub.Handler {
+	return map[string]pubsub.Handler{
+		event.SubjectUserCreated: h.Created,
+		event.SubjectNewUser:     h.Created,
+		event.SubjectUserReplay:  h.Created,
+		event.SubjectUserUpdated: h.Updated,
+		event.SubjectUserDeleted: h.Deleted,
+	}
+}
+
+func (h *UserHandler) Subscribe(subscriber pubsub.Subscriber, middleware ...pubsub.Middleware) ([]pubsub.Subscription, error) {
+	handlers := h.handlers()
+
+	subscriptions := make([]pubsub.Subscription, 0, len(handlers))
+	for subject, handler := range handlers {
+		for _, wrap := range middleware {
+			handler = wrap(handler)
+		}
+		subscription, err := subscriber.Subscribe(subject, handler)
+		if err != nil {
+			return subscriptions, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+// Handle dispatches a message by its subject, as the subscriptions do.
+func (h *UserHandler) Handle(msg *pubsub.Message) error {
+	handler, ok := h.handlers()[msg.Subject]
+	if !ok {
+		return pubsub.Permanent(fmt.Errorf("no handler for subject %s", msg.Subject))
+	}
+	return handler(msg)
+}
+
+func (h *UserHandler) Created(msg *pubsub.Message) error {
+	var payload event.UserCreated
+	stored, err := h.decode(msg, event.SubjectUserCreated, &payload)
+	if err != nil {
+		h.logger.Warning(fmt.Sprintf("Rejecting %s message: %s", msg.Subject, err.Error()))
+		return pubsub.Permanent(err)
+	}
+
+	u := &user.User{
+		ID:        payload.ID,
+		Email:     payload.Email,
+		CreatedAt: payload.CreatedAt,
+		UpdatedAt: payload.UpdatedAt,
+	}
+	err = h.service.Save(msg.Context(), u, stored)
+	if err != nil && !h.skipped(msg, err) {
+		h.logger.Warning(fmt.Sprintf("Failed to create user %s: %s", payload.ID, err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (h *UserHandler) Updated(msg *pubsub.Message) error {
+	var payload event.UserUpdated
+	stored, err := h.decode(msg, event.SubjectUserUpdated, &payload)
+	if err != nil {
+		h.logger.Warning(fmt.Sprintf("Rejecting %s message: %s", msg.Subject, err.Error()))
+		return pubsub.Permanent(err)
+	}
+
+	u := &user.User{
+		ID:        payload.ID,
+		Email:     payload.Email,
+		CreatedAt: payload.CreatedAt,
+		UpdatedAt: payload.UpdatedAt,
+	}
+	err = h.service.Save(msg.Context(), u, stored)
+	if err != nil && !h.skipped(msg, err) {
+		h.logger.Warning(fmt.Sprintf("Failed to update user %s: %s", payload.ID, err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (h *UserHandler) Deleted(msg *pubsub.Message) error {
+	var payload event.UserDeleted
+	stored, err := h.decode(msg, event.SubjectUserDeleted, &payload)
+	if err != nil {
+		h.logger.Warning(fmt.Sprintf("Rejecting %s message: %s", msg.Subject, err.Error()))
+		return pubsub.Permanent(err)
+	}
+
+	err = h.service.Remove(msg.Context(), payload.ID, payload.DeletedAt, stored)
+	if err != nil && !h.skipped(msg, err) {
+		h.logger.Warning(fmt.Sprintf("Failed to delete user %s: %s", payload.ID, err.Error()))
+		return err
+	}
+	return nil
+}
+
+// Key returns the id of the user a message is about, so that the events of one user are handled in order.
+func (h *UserHandler) Key(msg *pubsub.Message) string {
+	data := msg.Data
+	if ce, err := cloudevents.Parse(msg.Data); err == nil {
+		if ce.Subject != "" {
+			return ce.Subject
+		}
+		data = ce.Data
+	}
+
+	var payload struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return ""
+	}
+	return payload.ID
+}
+
+// skipped reports whether err only means the event was already applied or is superseded.
+func (h *UserHandler) skipped(msg *pubsub.Message, err error) bool {
+	if errors.Is(err, apperrors.ErrEventAlreadyProcessed) || errors.Is(err, apperrors.ErrStaleUserEvent) {
+		h.logger.Info(fmt.Sprintf("Skipping %s message %s: %s", msg.Subject, msg.ID, err.Error()))
+		return true
+	}
+	return false
+}
+
+// decode validates the message against the schema of its version, upcasts it to the version this service
+// understands and returns it as the event to store. Payloads published before the CloudEvents envelope are
+// read as version 1 and identified by the message id.
+func (h *UserHandler) decode(msg *pubsub.Message, eventType string, payload interface{}) (*event.Stored, error) {
+	ce, err := cloudevents.Parse(msg.Data)
+	if errors.Is(err, cloudevents.ErrNotCloudEvent) {
+		ce = &cloudevents.Event{ID: msg.ID, Type: eventType, DataSchema: cloudevents.SchemaURI(eventType, 1), Data: msg.Data}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if ce.Type != eventType {
+		return nil, fmt.Errorf("unexpected event type %s", ce.Type)
+	}
+
+	ce, err = h.schemas.Upcast(ce)
+	if err != nil {
+		return nil, err
+	}
+	if err := ce.DecodeData(payload); err != nil {
+		return nil, err
+	}
+
+	stored := &event.Stored{
+		ID:         ce.ID,
+		Type:       ce.Type,
+		Subject:    h.Key(msg),
+		DataSchema: ce.DataSchema,
+		Data:       ce.Data,
+		OccurredAt: ce.Time,
+	}
+	if stored.OccurredAt.IsZero() {
+		stored.OccurredAt = time.Now()
+	}
+	return stored, nil
+}
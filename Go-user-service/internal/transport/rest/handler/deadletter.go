@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/deadletter"
+	"Golang-practice-2023/internal/domain/logger"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type DeadLetterHandler struct {
+	service deadletter.Service
+	logger  logger.Logger
+}
+
+func NewDeadLetterHandler(service deadletter.Service, logger logger.Logger) *DeadLetterHandler {
+	return &DeadLetterHandler{service: service, logger: logger}
+}
+
+func (h *DeadLetterHandler) InitRoutes(router *mux.Router) {
+	router.HandleFunc("/dead-letter", h.List).Methods(http.MethodGet)
+	router.HandleFunc("/dead-letter/replay", h.ReplayAll).Methods(http.MethodPost)
+	router.HandleFunc("/dead-letter/{id}", h.Get).Methods(http.MethodGet)
+	router.HandleFunc("/dead-letter/{id}", h.Edit).Methods(http.MethodPatch)
+	router.HandleFunc("/dead-letter/{id}", h.Discard).Methods(http.MethodDelete)
+	router.HandleFunc("/dead-letter/{id}/replay", h.Replay).Methods(http.MethodPost)
+}
+
+func (h *DeadLetterHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDeadLetterFilter(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	messages, err := h.service.List(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, messages, http.StatusOK)
+}
+
+func (h *DeadLetterHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	message, err := h.service.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, message, http.StatusOK)
+}
+
+func (h *DeadLetterHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	if err := myHttp.ValidateRequestFormat(r, contentType); err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestFormat)
+		return
+	}
+
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	var edit deadletter.Edit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestBody)
+		return
+	}
+
+	message, err := h.service.Edit(r.Context(), id, edit)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, message, http.StatusOK)
+}
+
+func (h *DeadLetterHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	message, err := h.service.Replay(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, message, http.StatusOK)
+}
+
+func (h *DeadLetterHandler) ReplayAll(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDeadLetterFilter(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	report, err := h.service.ReplayAll(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, report, http.StatusOK)
+}
+
+func (h *DeadLetterHandler) Discard(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	if err := h.service.Discard(r.Context(), id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *DeadLetterHandler) writeResponse(w http.ResponseWriter, data interface{}, status int) {
+	if err := myHttp.WriteResponse(data, w, contentType, status); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal dead letter response: %s", err.Error()))
+	}
+}
+
+func (h *DeadLetterHandler) writeError(w http.ResponseWriter, err error) {
+	if err := HandleError(w, err); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+	}
+}
+
+func parseDeadLetterFilter(r *http.Request) (deadletter.Filter, error) {
+	query := r.URL.Query()
+	filter := deadletter.Filter{Status: deadletter.Status(query.Get("status")), Subject: query.Get("subject")}
+
+	if offset := query.Get("offset"); offset != "" {
+		parsed, err := strconv.Atoi(offset)
+		if err != nil || parsed < 0 {
+			return filter, apperrors.ErrInvalidOffsetFormat
+		}
+		filter.Offset = parsed
+	}
+	if limit := query.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 0 {
+			return filter, apperrors.ErrInvalidLimitFormat
+		}
+		filter.Limit = parsed
+	}
+
+	return filter, nil
+}
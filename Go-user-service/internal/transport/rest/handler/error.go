@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+const (
+	contentType        = "application/json"
+	problemContentType = "application/problem+json"
+)
+
+// Problem is an error response in the RFC 7807 problem details format.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// HandleError writes err as a problem; errors it does not know are reported as internal errors without
+// their details.
+func HandleError(w http.ResponseWriter, err error) error {
+	status := http.StatusInternalServerError
+	switch errors.Cause(err) {
+	case apperrors.ErrUserNotFound, apperrors.ErrDeadLetterNotFound, apperrors.ErrProfileNotFound,
+		apperrors.ErrAvatarNotFound:
+		status = http.StatusNotFound
+	case apperrors.ErrInvalidRequestFormat, apperrors.ErrInvalidRequestBody, apperrors.ErrInvalidIdFormat,
+		apperrors.ErrInvalidOffsetFormat, apperrors.ErrInvalidLimitFormat, apperrors.ErrInvalidDeadLetterStatus,
+		apperrors.ErrInvalidDateFormat, apperrors.ErrInvalidEmailFormat, apperrors.ErrInvalidSearchQuery, apperrors.ErrInvalidDisplayName,
+		apperrors.ErrInvalidLocale, apperrors.ErrInvalidTimeZone, apperrors.ErrInvalidPreferences,
+		apperrors.ErrInvalidAvatar:
+		status = http.StatusBadRequest
+	case apperrors.ErrUnsupportedAvatarType:
+		status = http.StatusUnsupportedMediaType
+	case apperrors.ErrAvatarTooLarge:
+		status = http.StatusRequestEntityTooLarge
+	case apperrors.ErrUnauthorized:
+		status = http.StatusUnauthorized
+	case apperrors.ErrDeadLetterResolved:
+		status = http.StatusConflict
+	}
+
+	problem := Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: err.Error()}
+	if status == http.StatusInternalServerError {
+		problem.Detail = "Failed to execute"
+	}
+	return myHttp.WriteResponse(problem, w, problemContentType, status)
+}
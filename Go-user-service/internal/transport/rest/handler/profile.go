@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/profile"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+type ProfileHandler struct {
+	service profile.Service
+	logger  logger.Logger
+}
+
+func NewProfileHandler(service profile.Service, logger logger.Logger) *ProfileHandler {
+	return &ProfileHandler{service: service, logger: logger}
+}
+
+// InitRoutes serves profiles to everyone; only the requests let through by authorize can change them.
+func (h *ProfileHandler) InitRoutes(router *mux.Router, authorize mux.MiddlewareFunc) {
+	router.HandleFunc("/user/{id}/profile", h.Get).Methods(http.MethodGet)
+	router.Handle("/user/{id}/profile", authorize(http.HandlerFunc(h.Save))).Methods(http.MethodPut)
+	router.Handle("/user/{id}/profile", authorize(http.HandlerFunc(h.Delete))).Methods(http.MethodDelete)
+	router.HandleFunc("/user/{id}/profile/avatar", h.GetAvatar).Methods(http.MethodGet)
+	router.Handle("/user/{id}/profile/avatar", authorize(http.HandlerFunc(h.SetAvatar))).Methods(http.MethodPut)
+	router.Handle("/user/{id}/profile/avatar", authorize(http.HandlerFunc(h.DeleteAvatar))).Methods(http.MethodDelete)
+	router.HandleFunc("/user/{id}/profile/avatar/thumbnail", h.GetAvatarThumbnail).Methods(http.MethodGet)
+}
+
+func (h *ProfileHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	p, err := h.service.Get(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, p, http.StatusOK)
+}
+
+// Save creates or replaces the profile; the avatar is managed through its own route and is kept.
+func (h *ProfileHandler) Save(w http.ResponseWriter, r *http.Request) {
+	if err := myHttp.ValidateRequestFormat(r, contentType); err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestFormat)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	var p profile.Profile
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		h.writeError(w, apperrors.ErrInvalidRequestBody)
+		return
+	}
+	p.UserID = id
+
+	if err := h.service.Save(r.Context(), &p); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, p, http.StatusOK)
+}
+
+func (h *ProfileHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetAvatar takes the image as the raw request body.
+func (h *ProfileHandler) SetAvatar(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	avatar, err := h.service.SetAvatar(r.Context(), id, r.Body)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, avatar, http.StatusOK)
+}
+
+func (h *ProfileHandler) GetAvatar(w http.ResponseWriter, r *http.Request) {
+	h.serveAvatar(w, r, false)
+}
+
+func (h *ProfileHandler) GetAvatarThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serveAvatar(w, r, true)
+}
+
+func (h *ProfileHandler) serveAvatar(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	content, avatarType, err := h.service.GetAvatar(r.Context(), id, thumbnail)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", avatarType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write avatar of user %s: %s", id, err.Error()))
+	}
+}
+
+func (h *ProfileHandler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	if err := h.service.DeleteAvatar(r.Context(), id); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ProfileHandler) writeResponse(w http.ResponseWriter, data interface{}, status int) {
+	if err := myHttp.WriteResponse(data, w, contentType, status); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal profile response: %s", err.Error()))
+	}
+}
+
+func (h *ProfileHandler) writeError(w http.ResponseWriter, err error) {
+	if err := HandleError(w, err); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+	}
+}
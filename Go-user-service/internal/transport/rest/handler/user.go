@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/user"
+	myHttp "Golang-practice-2023/pkg/utils/http"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UserResponse is a user as served by the read API, without its credentials.
+type UserResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewUserResponse(u *user.User) UserResponse {
+	return UserResponse{ID: u.ID, Email: u.Email, CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt}
+}
+
+// SearchResponse is a search match; the highlights are HTML with the matched words wrapped in <mark>.
+type SearchResponse struct {
+	UserResponse
+	DisplayName string          `json:"display_name"`
+	Rank        float64         `json:"rank"`
+	Highlight   SearchHighlight `json:"highlight"`
+}
+
+type SearchHighlight struct {
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+}
+
+type UserHandler struct {
+	service user.Service
+	logger  logger.Logger
+}
+
+func NewUserHandler(service user.Service, logger logger.Logger) *UserHandler {
+	return &UserHandler{service: service, logger: logger}
+}
+
+func (h *UserHandler) InitRoutes(router *mux.Router) {
+	router.HandleFunc("/user/search", h.Search).Methods(http.MethodGet)
+	router.HandleFunc("/user/{id}", h.GetById).Methods(http.MethodGet)
+	router.HandleFunc("/user", h.GetByEmail).Methods(http.MethodGet).Queries("email", "{email}")
+	router.HandleFunc("/user", h.List).Methods(http.MethodGet)
+}
+
+func (h *UserHandler) GetById(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, apperrors.ErrInvalidIdFormat)
+		return
+	}
+
+	u, err := h.service.GetById(r.Context(), id)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, NewUserResponse(u), http.StatusOK)
+}
+
+func (h *UserHandler) GetByEmail(w http.ResponseWriter, r *http.Request) {
+	email := r.URL.Query().Get("email")
+	if email == "" {
+		h.writeError(w, apperrors.ErrInvalidEmailFormat)
+		return
+	}
+
+	u, err := h.service.GetByEmail(r.Context(), email)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeResponse(w, NewUserResponse(u), http.StatusOK)
+}
+
+// List serves a page of users ordered by registration. Query parameters: offset, limit, q (part of the
+// email) and created_after / created_before (RFC 3339).
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUserFilter(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	users, err := h.service.List(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	responses := make([]UserResponse, 0, len(users))
+	for i := range users {
+		responses = append(responses, NewUserResponse(&users[i]))
+	}
+	h.writeResponse(w, responses, http.StatusOK)
+}
+
+// Search serves the users matching q, best matches first, paged with offset and limit.
+func (h *UserHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := user.SearchQuery{Text: r.URL.Query().Get("q")}
+	var err error
+	if query.Offset, query.Limit, err = parsePage(r); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	results, err := h.service.Search(r.Context(), query)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	responses := make([]SearchResponse, 0, len(results))
+	for i := range results {
+		responses = append(responses, SearchResponse{
+			UserResponse: NewUserResponse(&results[i].User),
+			DisplayName:  results[i].DisplayName,
+			Rank:         results[i].Rank,
+			Highlight:    SearchHighlight{Email: results[i].EmailHighlight, DisplayName: results[i].DisplayNameHighlight},
+		})
+	}
+	h.writeResponse(w, responses, http.StatusOK)
+}
+
+func (h *UserHandler) writeResponse(w http.ResponseWriter, data interface{}, status int) {
+	if err := myHttp.WriteResponse(data, w, contentType, status); err != nil {
+		h.logger.Warning(fmt.Sprintf("Error: unable to marshal user response: %s", err.Error()))
+	}
+}
+
+func (h *UserHandler) writeError(w http.ResponseWriter, err error) {
+	if err := HandleError(w, err); err != nil {
+		h.logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+	}
+}
+
+func parseUserFilter(r *http.Request) (user.Filter, error) {
+	query := r.URL.Query()
+	filter := user.Filter{Email: query.Get("q")}
+
+	var err error
+	if filter.Offset, filter.Limit, err = parsePage(r); err != nil {
+		return filter, err
+	}
+	if after := query.Get("created_after"); after != "" {
+		parsed, err := time.Parse(time.RFC3339, after)
+		if err != nil {
+			return filter, apperrors.ErrInvalidDateFormat
+		}
+		filter.CreatedAfter = parsed.UTC()
+	}
+	if before := query.Get("created_before"); before != "" {
+		parsed, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			return filter, apperrors.ErrInvalidDateFormat
+		}
+		filter.CreatedBefore = parsed.UTC()
+	}
+
+	return filter, nil
+}
+
+func parsePage(r *http.Request) (offset int, limit int, err error) {
+	query := r.URL.Query()
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, apperrors.ErrInvalidOffsetFormat
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return 0, 0, apperrors.ErrInvalidLimitFormat
+		}
+	}
+	return offset, limit, nil
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"Go-common/pkg/auth"
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"fmt"
+	"net/http"
+)
+
+// AdminToken only lets requests through that carry "Authorization: Bearer <token>".
+func AdminToken(token string, logger logger.Logger) func(http.Handler) http.Handler {
+	return auth.BearerToken(token, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := handler.HandleError(w, apperrors.ErrUnauthorized); err != nil {
+			logger.Warning(fmt.Sprintf("Failed to write response: %s", err.Error()))
+		}
+	}))
+}
@@ -2,11 +2,19 @@ package repository
 
 import (
 	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/event"
 	"Golang-practice-2023/internal/domain/logger"
 	"Golang-practice-2023/internal/domain/user"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"strings"
+	"time"
 )
 
 type Repository struct {
@@ -27,9 +35,9 @@ func (r *Repository) Create(ctx context.Context, user *user.User) error {
 		return apperrors.ErrAlreadyRegisteredUserEmail
 	}
 
-	query := "INSERT INTO account (email, passwordhash) VALUES ($1, $2) RETURNING id, createdAt, updatedAt"
+	query := "INSERT INTO account (email) VALUES ($1) RETURNING id, createdAt, updatedAt"
 
-	row := r.db.QueryRowContext(ctx, query, user.Email, user.Passwordhash)
+	row := r.db.QueryRowContext(ctx, query, user.Email)
 	err := row.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		r.logger.Warning(err.Error())
@@ -39,8 +47,283 @@ func (r *Repository) Create(ctx context.Context, user *user.User) error {
 	return nil
 }
 
+// Save upserts a user replicated from the auth service under its source id, keeping its timestamps. The
+// event is appended to the event store in the same transaction, and a redelivered event fails with
+// ErrEventAlreadyProcessed; an event older than the stored copy, or about a deleted user, fails with
+// ErrStaleUserEvent. A nil event skips both the store and the deduplication.
+func (r *Repository) Save(ctx context.Context, user *user.User, e *event.Stored) error {
+	return r.inEvent(ctx, e, func(tx *sqlx.Tx) error {
+		return r.save(ctx, tx, user)
+	})
+}
+
+func (r *Repository) save(ctx context.Context, tx *sqlx.Tx, user *user.User) error {
+	var deleted bool
+	err := tx.GetContext(ctx, &deleted, "SELECT EXISTS(SELECT 1 FROM account_tombstone WHERE id=$1)", user.ID)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+	if deleted {
+		return apperrors.ErrStaleUserEvent
+	}
+
+	query := `INSERT INTO account (id, email, createdAt, updatedAt) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET email=EXCLUDED.email, createdAt=EXCLUDED.createdAt, updatedAt=EXCLUDED.updatedAt
+		WHERE account.updatedAt <= EXCLUDED.updatedAt`
+
+	result, err := tx.ExecContext(ctx, query, user.ID, user.Email, user.CreatedAt, user.UpdatedAt)
+	if isUniqueViolation(err, "account_email_key") {
+		return apperrors.ErrAlreadyRegisteredUserEmail
+	}
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return apperrors.ErrDbQueryProcessing
+	}
+	if rowsAffected == 0 {
+		return apperrors.ErrStaleUserEvent
+	}
+
+	return nil
+}
+
+// Remove deletes a replicated user and leaves a tombstone, so that its create and update events arriving
+// late are ignored. Like Save it stores and deduplicates the event.
+func (r *Repository) Remove(ctx context.Context, id uuid.UUID, deletedAt time.Time, e *event.Stored) error {
+	return r.inEvent(ctx, e, func(tx *sqlx.Tx) error {
+		return r.remove(ctx, tx, id, deletedAt)
+	})
+}
+
+func (r *Repository) remove(ctx context.Context, tx *sqlx.Tx, id uuid.UUID, deletedAt time.Time) error {
+	if _, err := tx.ExecContext(ctx, deleteAccountQuery, id); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	query := "INSERT INTO account_tombstone (id, deletedAt) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING"
+
+	if _, err := tx.ExecContext(ctx, query, id, deletedAt); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+// inEvent runs apply in a transaction that also records the event as processed and appends it to the event
+// store. ErrStaleUserEvent still commits both, so the stale event is not applied again when redelivered and
+// a rebuild skips it the same way.
+func (r *Repository) inEvent(ctx context.Context, e *event.Stored, apply func(tx *sqlx.Tx) error) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	if e != nil && e.ID != "" {
+		query := "INSERT INTO processed_event (id) VALUES ($1) ON CONFLICT (id) DO NOTHING"
+
+		result, err := tx.ExecContext(ctx, query, e.ID)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			_ = tx.Rollback()
+			return apperrors.ErrDbQueryProcessing
+		}
+		if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+			_ = tx.Rollback()
+			if err != nil {
+				return apperrors.ErrDbQueryProcessing
+			}
+			return apperrors.ErrEventAlreadyProcessed
+		}
+	}
+
+	applyErr := apply(tx)
+	if applyErr != nil && !errors.Is(applyErr, apperrors.ErrStaleUserEvent) {
+		_ = tx.Rollback()
+		return applyErr
+	}
+
+	if e != nil {
+		if err := r.append(ctx, tx, e); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return applyErr
+}
+
+func (r *Repository) append(ctx context.Context, tx *sqlx.Tx, e *event.Stored) error {
+	query := `INSERT INTO event_store (eventId, type, subject, dataSchema, data, occurredAt)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5, $6) RETURNING position, recordedAt`
+
+	row := tx.QueryRowContext(ctx, query, e.ID, e.Type, e.Subject, e.DataSchema, string(e.Data), e.OccurredAt)
+	if err := row.Scan(&e.Position, &e.RecordedAt); err != nil {
+		r.logger.Warning(err.Error())
+		return apperrors.ErrDbQueryProcessing
+	}
+
+	return nil
+}
+
+const rebuildPageSize = 500
+
+// deleteAccountQuery deletes the profile of the account in the same statement, as the profile foreign key
+// does not cascade.
+const deleteAccountQuery = "WITH deleted_profile AS (DELETE FROM profile WHERE userId=$1) DELETE FROM account WHERE id=$1"
+
+// Rebuild replaces the account projection by a replay of the event store in the order the events were
+// consumed, up to the events recorded at until; a zero until replays all of them. It runs in one transaction
+// with the profile foreign key deferred, and consumers wait on the table locks until it commits. Profiles are
+// not projected: those of users the replay did not bring back are deleted and reported.
+func (r *Repository) Rebuild(ctx context.Context, until time.Time) (*user.RebuildReport, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		"LOCK TABLE event_store, account, account_tombstone, profile IN EXCLUSIVE MODE",
+		"SET CONSTRAINTS profile_userid_fkey DEFERRED",
+		"DELETE FROM account",
+		"DELETE FROM account_tombstone",
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+	}
+
+	report := &user.RebuildReport{}
+	var position int64
+	for {
+		events, err := r.eventsAfter(ctx, tx, position, until)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		for i := range events {
+			e := &events[i]
+			err := r.replay(ctx, tx, e)
+			if errors.Is(err, apperrors.ErrStaleUserEvent) {
+				report.Skipped++
+			} else if err != nil {
+				return nil, fmt.Errorf("replaying event %d: %w", e.Position, err)
+			} else {
+				report.Applied++
+			}
+			report.Events++
+			position = e.Position
+		}
+	}
+
+	query := "DELETE FROM profile p WHERE NOT EXISTS(SELECT 1 FROM account a WHERE a.id = p.userId) RETURNING p.userId"
+	if err := tx.SelectContext(ctx, &report.OrphanedProfiles, query); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	if err := tx.GetContext(ctx, &report.Users, "SELECT count(*) FROM account"); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return report, nil
+}
+
+// eventsAfter reads a page of the event store. The page is read whole before it is replayed, as the
+// connection of the transaction cannot run statements while rows are open.
+func (r *Repository) eventsAfter(ctx context.Context, tx *sqlx.Tx, position int64, until time.Time) ([]event.Stored, error) {
+	query := `SELECT position, coalesce(eventId, ''), type, subject, dataSchema, data, occurredAt, recordedAt
+		FROM event_store WHERE position > $1`
+	args := []interface{}{position}
+	if !until.IsZero() {
+		args = append(args, until)
+		query += fmt.Sprintf(" AND recordedAt <= $%d", len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY position LIMIT %d", rebuildPageSize)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	events := make([]event.Stored, 0, rebuildPageSize)
+	for rows.Next() {
+		var e event.Stored
+		var data []byte
+		err := rows.Scan(&e.Position, &e.ID, &e.Type, &e.Subject, &e.DataSchema, &data, &e.OccurredAt, &e.RecordedAt)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		e.Data = data
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return events, nil
+}
+
+func (r *Repository) replay(ctx context.Context, tx *sqlx.Tx, e *event.Stored) error {
+	switch e.Type {
+	case event.SubjectUserCreated, event.SubjectUserUpdated:
+		var payload event.UserUpdated
+		if err := json.Unmarshal(e.Data, &payload); err != nil {
+			return err
+		}
+		return r.save(ctx, tx, &user.User{
+			ID:        payload.ID,
+			Email:     payload.Email,
+			CreatedAt: payload.CreatedAt,
+			UpdatedAt: payload.UpdatedAt,
+		})
+	case event.SubjectUserDeleted:
+		var payload event.UserDeleted
+		if err := json.Unmarshal(e.Data, &payload); err != nil {
+			return err
+		}
+		return r.remove(ctx, tx, payload.ID, payload.DeletedAt)
+	default:
+		return fmt.Errorf("unknown event type %s", e.Type)
+	}
+}
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
 func (r *Repository) GetById(ctx context.Context, id uuid.UUID) (*user.User, error) {
-	query := "SELECT id, email, passwordhash, createdAt, updatedAt FROM account WHERE id=$1"
+	query := "SELECT id, email, createdAt, updatedAt FROM account WHERE id=$1"
 
 	var u user.User
 	err := r.db.GetContext(ctx, &u, query, id)
@@ -52,7 +335,7 @@ func (r *Repository) GetById(ctx context.Context, id uuid.UUID) (*user.User, err
 }
 
 func (r *Repository) GetByEmail(ctx context.Context, email string) (*user.User, error) {
-	query := "SELECT id, email, passwordhash, createdAt, updatedAt  FROM account WHERE email=$1"
+	query := "SELECT id, email, createdAt, updatedAt  FROM account WHERE email=$1"
 
 	var u user.User
 	err := r.db.GetContext(ctx, &u, query, email)
@@ -63,14 +346,115 @@ func (r *Repository) GetByEmail(ctx context.Context, email string) (*user.User,
 	return &u, nil
 }
 
+func (r *Repository) List(ctx context.Context, filter user.Filter) ([]user.User, error) {
+	query := "SELECT id, email, createdAt, updatedAt FROM account WHERE true"
+	args := make([]interface{}, 0, 5)
+	if filter.Email != "" {
+		args = append(args, "%"+escapeLike(filter.Email)+"%")
+		query += fmt.Sprintf(" AND email ILIKE $%d", len(args))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		args = append(args, filter.CreatedAfter)
+		query += fmt.Sprintf(" AND createdAt > $%d", len(args))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		args = append(args, filter.CreatedBefore)
+		query += fmt.Sprintf(" AND createdAt < $%d", len(args))
+	}
+	query += " ORDER BY createdAt, id"
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	users := make([]user.User, 0)
+	if err := r.db.SelectContext(ctx, &users, query, args...); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return users, nil
+}
+
+// wordSimilarityThreshold is lower than the pg_trgm default of 0.6, so that a single typo in a word of an
+// email still matches it.
+const wordSimilarityThreshold = 0.5
+
+// Search matches the words of the query as prefixes of the indexed email and display name words, and the
+// whole query by trigram similarity, so typos still find the user. Full-text matches rank above fuzzy ones.
+func (r *Repository) Search(ctx context.Context, query user.SearchQuery) ([]user.SearchResult, error) {
+	terms := query.Terms()
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+
+	sqlQuery := `SELECT a.id, a.email, a.createdAt, a.updatedAt, coalesce(p.displayName, '') AS displayName,
+			ts_rank_cd(a.searchDocument || coalesce(p.searchDocument, ''::tsvector), q) +
+				greatest(word_similarity($1, a.email), word_similarity($1, coalesce(p.displayName, ''))) AS rank
+		FROM account a
+			LEFT JOIN profile p ON p.userId = a.id
+			CROSS JOIN to_tsquery('simple', $2) q
+		WHERE a.searchDocument @@ q OR p.searchDocument @@ q OR $1 <% a.email OR $1 <% p.displayName
+		ORDER BY rank DESC, a.createdAt, a.id
+		OFFSET $3 LIMIT $4`
+
+	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL pg_trgm.word_similarity_threshold = %g", wordSimilarityThreshold))
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	rows, err := tx.QueryContext(ctx, sqlQuery, strings.ToLower(strings.TrimSpace(query.Text)),
+		strings.Join(prefixes, " & "), query.Offset, query.Limit)
+	if err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+	defer rows.Close()
+
+	results := make([]user.SearchResult, 0)
+	for rows.Next() {
+		var result user.SearchResult
+		err := rows.Scan(&result.ID, &result.Email, &result.CreatedAt, &result.UpdatedAt, &result.DisplayName,
+			&result.Rank)
+		if err != nil {
+			r.logger.Warning(err.Error())
+			return nil, apperrors.ErrDbQueryProcessing
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Warning(err.Error())
+		return nil, apperrors.ErrDbQueryProcessing
+	}
+
+	return results, nil
+}
+
+func escapeLike(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(pattern)
+}
+
 func (r *Repository) Update(ctx context.Context, user *user.User) error {
 	if u, _ := r.GetById(ctx, user.ID); u == nil {
 		return apperrors.ErrUserNotFound
 	}
 
-	query := "UPDATE account SET email=$1, passwordhash=$2, updatedAt=current_timestamp WHERE id=$3 RETURNING createdAt, updatedAt"
+	query := "UPDATE account SET email=$1, updatedAt=current_timestamp WHERE id=$2 RETURNING createdAt, updatedAt"
 
-	row := r.db.QueryRowContext(ctx, query, user.Email, user.Passwordhash, user.ID)
+	row := r.db.QueryRowContext(ctx, query, user.Email, user.ID)
 	err := row.Scan(&user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		r.logger.Warning(err.Error())
@@ -81,9 +465,7 @@ func (r *Repository) Update(ctx context.Context, user *user.User) error {
 }
 
 func (r *Repository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := "DELETE FROM account WHERE id=$1"
-
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := r.db.ExecContext(ctx, deleteAccountQuery, id)
 	if err != nil {
 		return apperrors.ErrDbQueryProcessing
 	}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// highlight HTML escapes text and wraps in <mark> the start of every word that begins with one of the
+// terms, the way the search matches them as prefixes. Words only found by similarity are not marked.
+func highlight(text string, terms []string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(runes) && isWordRune(runes[end]) {
+			end++
+		}
+		word := runes[i:end]
+
+		marked := 0
+		lower := strings.ToLower(string(word))
+		for _, term := range terms {
+			if strings.HasPrefix(lower, term) && len([]rune(term)) > marked {
+				marked = len([]rune(term))
+			}
+		}
+		if marked > len(word) {
+			// Lower-casing changed the length of the word; mark all of it.
+			marked = len(word)
+		}
+
+		if marked > 0 {
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(string(word[:marked])))
+			b.WriteString("</mark>")
+		}
+		b.WriteString(html.EscapeString(string(word[marked:])))
+		i = end
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
@@ -2,35 +2,50 @@ package service
 
 import (
 	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/event"
 	"Golang-practice-2023/internal/domain/logger"
 	"Golang-practice-2023/internal/domain/user"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"github.com/google/uuid"
 	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+	maxSearchLength  = 100
 )
 
 type Service struct {
 	repository user.Repository
 	logger     logger.Logger
+	onRemove   []func(ctx context.Context, id uuid.UUID)
 }
 
 func New(repository user.Repository, logger logger.Logger) *Service {
 	return &Service{repository: repository, logger: logger}
 }
 
+// OnRemove registers a listener called after a user, and its profile with it, was deleted. Listeners are
+// registered before the service is used.
+func (service *Service) OnRemove(listener func(ctx context.Context, id uuid.UUID)) {
+	service.onRemove = append(service.onRemove, listener)
+}
+
+func (service *Service) removed(ctx context.Context, id uuid.UUID) {
+	for _, listener := range service.onRemove {
+		listener(ctx, id)
+	}
+}
+
 func (service *Service) Create(ctx context.Context, user *user.User) error {
 	if err := validateEmail(user.Email); err != nil {
 		return err
 	}
-	if err := validatePassword(user.Passwordhash); err != nil {
-		return err
-	}
-
-	hashedPassword := hashPassword(user.Passwordhash)
-	user.Passwordhash = hashedPassword
 
 	err := service.repository.Create(ctx, user)
 	if err != nil {
@@ -55,6 +70,48 @@ func (service *Service) GetById(ctx context.Context, id uuid.UUID) (*user.User,
 	return service.repository.GetById(ctx, id)
 }
 
+func (service *Service) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	return service.repository.GetByEmail(ctx, email)
+}
+
+// List returns a page of users ordered by registration; the page size defaults to defaultListLimit and is
+// capped at maxListLimit.
+func (service *Service) List(ctx context.Context, filter user.Filter) ([]user.User, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	if filter.Limit > maxListLimit {
+		filter.Limit = maxListLimit
+	}
+	return service.repository.List(ctx, filter)
+}
+
+// Search validates the query, applies the same paging defaults as List and highlights the matched words.
+func (service *Service) Search(ctx context.Context, query user.SearchQuery) ([]user.SearchResult, error) {
+	query.Text = strings.TrimSpace(query.Text)
+	if query.Text == "" || utf8.RuneCountInString(query.Text) > maxSearchLength {
+		return nil, apperrors.ErrInvalidSearchQuery
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultListLimit
+	}
+	if query.Limit > maxListLimit {
+		query.Limit = maxListLimit
+	}
+
+	results, err := service.repository.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := query.Terms()
+	for i := range results {
+		results[i].EmailHighlight = highlight(results[i].Email, terms)
+		results[i].DisplayNameHighlight = highlight(results[i].DisplayName, terms)
+	}
+	return results, nil
+}
+
 func (service *Service) Update(ctx context.Context, user *user.User) error {
 	_, err := service.GetById(ctx, user.ID)
 	if err != nil {
@@ -64,12 +121,6 @@ func (service *Service) Update(ctx context.Context, user *user.User) error {
 	if err := validateEmail(user.Email); err != nil {
 		return err
 	}
-	if err := validatePassword(user.Passwordhash); err != nil {
-		return err
-	}
-
-	hashedPassword := hashPassword(user.Passwordhash)
-	user.Passwordhash = hashedPassword
 
 	return service.repository.Update(ctx, user)
 }
@@ -79,12 +130,34 @@ func (service *Service) Delete(ctx context.Context, id uuid.UUID) error {
 	if err != nil {
 		return err
 	}
-	return service.repository.Delete(ctx, id)
+	if err := service.repository.Delete(ctx, id); err != nil {
+		return err
+	}
+	service.removed(ctx, id)
+	return nil
 }
 
-func (service *Service) Save(ctx context.Context, user *user.User) error {
-	createdUser := service.repository.Create(ctx, user)
-	return createdUser
+func (service *Service) Save(ctx context.Context, user *user.User, e *event.Stored) error {
+	return service.repository.Save(ctx, user, e)
+}
+
+func (service *Service) Remove(ctx context.Context, id uuid.UUID, deletedAt time.Time, e *event.Stored) error {
+	if err := service.repository.Remove(ctx, id, deletedAt, e); err != nil {
+		return err
+	}
+	service.removed(ctx, id)
+	return nil
+}
+
+func (service *Service) Rebuild(ctx context.Context, until time.Time) (*user.RebuildReport, error) {
+	report, err := service.repository.Rebuild(ctx, until)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range report.OrphanedProfiles {
+		service.removed(ctx, id)
+	}
+	return report, nil
 }
 
 func validateEmail(email string) error {
@@ -99,21 +172,3 @@ func validateEmail(email string) error {
 
 	return nil
 }
-
-func validatePassword(password string) error {
-	if password == "" {
-		return apperrors.ErrInvalidPasswordFormat
-	}
-
-	passwordRegex := regexp.MustCompile("^[a-zA-Z0-9@#$%!]{8,60}$") // fixme reg exp
-	if !passwordRegex.MatchString(password) {
-		return apperrors.ErrInvalidPasswordFormat
-	}
-
-	return nil
-}
-
-func hashPassword(password string) string {
-	hashed := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hashed[:])
-}
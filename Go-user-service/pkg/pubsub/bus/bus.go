@@ -0,0 +1,104 @@
+package bus
+
+import (
+	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"Golang-practice-2023/pkg/pubsub/memory"
+	"Golang-practice-2023/pkg/pubsub/nats/pub"
+	"Golang-practice-2023/pkg/pubsub/nats/stream"
+	"Golang-practice-2023/pkg/pubsub/nats/sub"
+	"Golang-practice-2023/pkg/pubsub/postgres"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	BackendNats     = "nats"
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+)
+
+type Config struct {
+	Backend string
+	NatsURL string
+	// Stream defaults to stream.DefaultUsersConfig.
+	Stream *stream.Config
+	// Consumer configures the durable consumers of NewSubscriber; the default uses Group as prefix.
+	Consumer *sub.Config
+	// Group names the consumer group of NewSubscriber with the nats backend: subscribers of the same group,
+	// in any number of processes, share the durable consumers and each message goes to one of them. With the
+	// postgres backend every subscriber receives every message.
+	Group string
+	// PostgresConnectionString selects the database the bus runs on. Both sides of the bus have to use
+	// the same database, as notifications do not cross databases.
+	PostgresConnectionString string
+	PostgresChannel          string
+	// Memory is shared by the publisher and the subscriber of one process; a new bus is created if nil.
+	Memory *memory.Bus
+}
+
+func NewPublisher(config Config, logger logger.Logger) (pubsub.Publisher, error) {
+	switch config.Backend {
+	case BackendNats, "":
+		return pub.New(config.NatsURL, streamConfig(config), logger)
+	case BackendPostgres:
+		db, err := sqlx.Open("postgres", config.PostgresConnectionString)
+		if err != nil {
+			return nil, err
+		}
+		return &ownedDbPublisher{Publisher: postgres.NewPublisher(db, postgresChannel(config)), db: db}, nil
+	case BackendMemory:
+		return memoryBus(config), nil
+	}
+	return nil, fmt.Errorf("unknown event bus backend %q", config.Backend)
+}
+
+func NewSubscriber(config Config, logger logger.Logger) (pubsub.Subscriber, error) {
+	switch config.Backend {
+	case BackendNats, "":
+		return sub.New(config.NatsURL, streamConfig(config), consumerConfig(config), logger)
+	case BackendPostgres:
+		return postgres.NewSubscriber(config.PostgresConnectionString, postgresChannel(config), logger)
+	case BackendMemory:
+		return memoryBus(config), nil
+	}
+	return nil, fmt.Errorf("unknown event bus backend %q", config.Backend)
+}
+
+func streamConfig(config Config) stream.Config {
+	if config.Stream == nil {
+		return stream.DefaultUsersConfig()
+	}
+	return *config.Stream
+}
+
+func consumerConfig(config Config) sub.Config {
+	if config.Consumer == nil {
+		return sub.DefaultConfig(config.Group)
+	}
+	return *config.Consumer
+}
+
+func postgresChannel(config Config) string {
+	if config.PostgresChannel == "" {
+		return postgres.DefaultChannel
+	}
+	return config.PostgresChannel
+}
+
+func memoryBus(config Config) *memory.Bus {
+	if config.Memory == nil {
+		return memory.New()
+	}
+	return config.Memory
+}
+
+// ownedDbPublisher closes the connection pool the factory opened for the publisher.
+type ownedDbPublisher struct {
+	*postgres.Publisher
+	db *sqlx.DB
+}
+
+func (p *ownedDbPublisher) Close() error {
+	return p.db.Close()
+}
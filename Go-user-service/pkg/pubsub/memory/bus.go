@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"Golang-practice-2023/internal/domain/pubsub"
+	subjects "Golang-practice-2023/pkg/pubsub/subject"
+	"errors"
+	"sync"
+)
+
+var ErrClosed = errors.New("memory bus is closed")
+
+// Bus is an in-process Publisher and Subscriber. Messages are delivered synchronously on the publishing
+// goroutine, so a test can assert on the effects of an event right after Publish returns. Handler errors
+// are returned from Publish; nothing is redelivered.
+type Bus struct {
+	mu            sync.RWMutex
+	subscriptions map[*subscription]struct{}
+	closed        bool
+}
+
+type subscription struct {
+	bus     *Bus
+	pattern string
+	handler pubsub.Handler
+}
+
+func New() *Bus {
+	return &Bus{subscriptions: make(map[*subscription]struct{})}
+}
+
+func (b *Bus) Publish(msg *pubsub.Message) error {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrClosed
+	}
+	handlers := make([]pubsub.Handler, 0)
+	for s := range b.subscriptions {
+		if subjects.Match(s.pattern, msg.Subject) {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	b.mu.RUnlock()
+
+	var err error
+	for _, handler := range handlers {
+		payload := make([]byte, len(msg.Data))
+		copy(payload, msg.Data)
+		delivered := &pubsub.Message{ID: msg.ID, Subject: msg.Subject, Headers: msg.Headers, Data: payload, Attempt: 1,
+			LastAttempt: true}
+		if handlerErr := handler(delivered); handlerErr != nil {
+			err = handlerErr
+		}
+	}
+
+	return err
+}
+
+func (b *Bus) Subscribe(subject string, handler pubsub.Handler) (pubsub.Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	s := &subscription{bus: b, pattern: subject, handler: handler}
+	b.subscriptions[s] = struct{}{}
+	return s, nil
+}
+
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.subscriptions = make(map[*subscription]struct{})
+	return nil
+}
+
+func (s *subscription) Unsubscribe() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	delete(s.bus.subscriptions, s)
+	return nil
+}
@@ -2,34 +2,308 @@ package sub
 
 import (
 	"Golang-practice-2023/internal/domain/logger"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"Golang-practice-2023/pkg/pubsub/nats/stream"
+	"Golang-practice-2023/pkg/pubsub/worker"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/nats-io/nats.go"
+	"strings"
+	"sync"
+	"time"
 )
 
+type Config struct {
+	// Durable prefixes the consumer names; every subscribed subject gets its own durable pull consumer.
+	// Subscribers with the same Durable share the consumers, so replicas of a service split the messages
+	// between them instead of each handling all of them.
+	Durable    string
+	BatchSize  int
+	FetchWait  time.Duration
+	AckWait    time.Duration
+	MaxDeliver int
+	// BackOff is the redelivery delay after the n-th failed delivery; the last entry repeats.
+	BackOff []time.Duration
+	// Workers configures the pool the messages of all subscriptions are handled on. Fetching pauses while
+	// its queue is full, leaving the messages in the stream.
+	Workers worker.Config
+	// Key returns the ordering key of a message: messages with the same key are handled one at a time, in
+	// the order they were fetched. Nil, or an empty key, handles messages in any order.
+	Key func(msg *pubsub.Message) string
+	// DrainTimeout bounds how long Close waits for the fetched messages to be handled; zero waits for all.
+	DrainTimeout time.Duration
+}
+
+func DefaultConfig(durable string) Config {
+	return Config{
+		Durable:      durable,
+		BatchSize:    32,
+		FetchWait:    5 * time.Second,
+		AckWait:      30 * time.Second,
+		MaxDeliver:   5,
+		BackOff:      []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 2 * time.Minute},
+		Workers:      worker.DefaultConfig(),
+		DrainTimeout: 30 * time.Second,
+	}
+}
+
+// NatsSubscriber consumes a JetStream stream through durable pull consumers with explicit acks: a message
+// is acked once its handler returns nil and redelivered with backoff otherwise, up to MaxDeliver times.
+// Messages published while the service is down wait in the stream. Handlers run on a worker pool, each in
+// a context that is cancelled after the timeout of the pool.
 type NatsSubscriber struct {
 	Conn   *nats.Conn
+	js     nats.JetStreamContext
+	stream stream.Config
+	config Config
 	logger logger.Logger
+	pool   *worker.Pool
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	closed  chan struct{}
+	closeMu sync.Mutex
+}
+
+type subscription struct {
+	sub    *nats.Subscription
+	cancel context.CancelFunc
+	done   chan struct{}
+	jobs   sync.WaitGroup
 }
 
-func New(natsURL string, logger logger.Logger) (*NatsSubscriber, error) {
-	conn, err := nats.Connect(natsURL)
+func New(natsURL string, streamConfig stream.Config, config Config, logger logger.Logger) (*NatsSubscriber, error) {
+	closed := make(chan struct{})
+	conn, err := nats.Connect(natsURL, nats.ClosedHandler(func(*nats.Conn) {
+		close(closed)
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := conn.JetStream()
 	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := stream.Ensure(js, streamConfig); err != nil {
+		conn.Close()
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &NatsSubscriber{
 		Conn:   conn,
+		js:     js,
+		stream: streamConfig,
+		config: config,
 		logger: logger,
+		pool:   worker.New(config.Workers),
+		ctx:    ctx,
+		cancel: cancel,
+		closed: closed,
 	}, nil
 }
 
-func (s *NatsSubscriber) Subscribe(topic string, callback func(msg *nats.Msg)) (*nats.Subscription, error) {
-	return s.Conn.Subscribe(topic, callback)
+func (s *NatsSubscriber) Subscribe(topic string, handler pubsub.Handler) (pubsub.Subscription, error) {
+	durable := ConsumerName(s.config.Durable, topic)
+	consumerConfig := &nats.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: topic,
+		DeliverPolicy: nats.DeliverAllPolicy,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       s.config.AckWait,
+		MaxDeliver:    s.config.MaxDeliver,
+		BackOff:       s.consumerBackOff(),
+	}
+
+	// The consumer is created here rather than by PullSubscribe, which would delete it on Unsubscribe.
+	_, err := s.js.ConsumerInfo(s.stream.Name, durable)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = s.js.AddConsumer(s.stream.Name, consumerConfig)
+	} else if err == nil {
+		_, err = s.js.UpdateConsumer(s.stream.Name, consumerConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := s.js.PullSubscribe(topic, durable, nats.Bind(s.stream.Name, durable))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	subscription := &subscription{sub: sub, cancel: cancel, done: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(subscription.done)
+		s.consume(ctx, subscription, handler)
+	}()
+
+	return subscription, nil
+}
+
+func (s *NatsSubscriber) consume(ctx context.Context, subscription *subscription, handler pubsub.Handler) {
+	sub := subscription.sub
+	for ctx.Err() == nil {
+		fetchCtx, cancel := context.WithTimeout(ctx, s.config.FetchWait)
+		msgs, err := sub.Fetch(s.config.BatchSize, nats.Context(fetchCtx))
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, nats.ErrTimeout) {
+				s.logger.Warning(fmt.Sprintf("Failed to fetch from %s: %s", sub.Subject, err.Error()))
+				if errors.Is(err, nats.ErrConnectionClosed) || errors.Is(err, nats.ErrBadSubscription) {
+					return
+				}
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for i, msg := range msgs {
+			// Finish the batch quickly on shutdown: hand the rest back for immediate redelivery.
+			if err := s.submit(ctx, subscription, msg, handler); err != nil {
+				for _, rest := range msgs[i:] {
+					_ = rest.Nak()
+				}
+				return
+			}
+		}
+	}
+}
+
+// submit queues the message on the pool, waiting while the pool is busy.
+func (s *NatsSubscriber) submit(ctx context.Context, subscription *subscription, msg *nats.Msg, handler pubsub.Handler) error {
+	message, delivered := s.message(msg)
+
+	key := ""
+	if s.config.Key != nil {
+		key = s.config.Key(message)
+	}
+
+	subscription.jobs.Add(1)
+	err := s.pool.Submit(ctx, key, func(ctx context.Context) {
+		defer subscription.jobs.Done()
+		s.handle(msg, message.WithContext(ctx), delivered, handler)
+	})
+	if err != nil {
+		subscription.jobs.Done()
+	}
+	return err
+}
+
+func (s *NatsSubscriber) message(msg *nats.Msg) (*pubsub.Message, uint64) {
+	delivered := uint64(1)
+	if meta, err := msg.Metadata(); err == nil {
+		delivered = meta.NumDelivered
+	}
+	message := &pubsub.Message{
+		ID:          msg.Header.Get(nats.MsgIdHdr),
+		Subject:     msg.Subject,
+		Headers:     msg.Header,
+		Data:        msg.Data,
+		Attempt:     int(delivered),
+		LastAttempt: s.config.MaxDeliver > 0 && delivered >= uint64(s.config.MaxDeliver),
+	}
+	return message, delivered
+}
+
+func (s *NatsSubscriber) handle(msg *nats.Msg, message *pubsub.Message, delivered uint64, handler pubsub.Handler) {
+	if err := handler(message); err != nil {
+		if message.LastAttempt || pubsub.IsPermanent(err) {
+			s.logger.Error(fmt.Sprintf("Giving up on %s message %s after %d deliveries: %s", msg.Subject, message.ID,
+				delivered, err.Error()))
+			_ = msg.Term()
+			return
+		}
+
+		if nakErr := msg.NakWithDelay(s.backOff(delivered)); nakErr != nil {
+			s.logger.Warning(fmt.Sprintf("Failed to nak %s message: %s", msg.Subject, nakErr.Error()))
+		}
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		s.logger.Warning(fmt.Sprintf("Failed to ack %s message: %s", msg.Subject, err.Error()))
+	}
+}
+
+func (s *NatsSubscriber) backOff(delivered uint64) time.Duration {
+	if len(s.config.BackOff) == 0 {
+		return 0
+	}
+	i := int(delivered) - 1
+	if i >= len(s.config.BackOff) {
+		i = len(s.config.BackOff) - 1
+	}
+	return s.config.BackOff[i]
 }
 
-func (s *NatsSubscriber) Unsubscribe(subscription *nats.Subscription) error {
+// consumerBackOff is the server side schedule for messages whose ack wait expired. The server requires
+// fewer entries than MaxDeliver.
+func (s *NatsSubscriber) consumerBackOff() []time.Duration {
+	if s.config.MaxDeliver > 0 && len(s.config.BackOff) >= s.config.MaxDeliver {
+		return s.config.BackOff[:s.config.MaxDeliver-1]
+	}
+	return s.config.BackOff
+}
+
+func (s *NatsSubscriber) Unsubscribe(subscription pubsub.Subscription) error {
 	err := subscription.Unsubscribe()
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// Close stops fetching, waits up to DrainTimeout for the fetched messages to be handled and drains the
+// connection. Handlers still running after DrainTimeout see their context cancelled.
+func (s *NatsSubscriber) Close() error {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+
+	ctx := context.Background()
+	if s.config.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.DrainTimeout)
+		defer cancel()
+	}
+	if err := s.pool.Close(ctx); err != nil {
+		s.logger.Warning(fmt.Sprintf("Gave up waiting for the fetched messages: %s", err.Error()))
+	}
+
+	if s.Conn.IsClosed() {
+		return nil
+	}
+	if err := s.Conn.Drain(); err != nil {
+		return err
+	}
+	<-s.closed
+	return nil
+}
+
+func (sub *subscription) Unsubscribe() error {
+	sub.cancel()
+	<-sub.done
+	sub.jobs.Wait()
+	return sub.sub.Unsubscribe()
+}
+
+// ConsumerName derives a durable name from a subject; durable names cannot contain '.', '*' or '>'.
+func ConsumerName(durable string, subject string) string {
+	name := strings.NewReplacer(".", "_", "*", "any", ">", "all").Replace(subject)
+	if durable == "" {
+		return name
+	}
+	return durable + "_" + name
+}
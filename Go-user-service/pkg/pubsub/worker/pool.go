@@ -0,0 +1,189 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrClosed = errors.New("worker pool is closed")
+
+type Config struct {
+	// Workers is the number of jobs run at once.
+	Workers int
+	// QueueSize bounds the jobs waiting for a worker, separately for the jobs without a key and for the keyed
+	// ones, which are split evenly between the workers. Submit blocks while the queue of a job is full.
+	QueueSize int
+	// Timeout bounds a single job; zero means no limit.
+	Timeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:   8,
+		QueueSize: 64,
+		Timeout:   10 * time.Second,
+	}
+}
+
+// Job runs in a context derived from the root context of the pool, with the timeout of the pool applied.
+type Job func(ctx context.Context)
+
+// Pool runs jobs on a fixed number of goroutines. Jobs submitted with the same key run one at a time in
+// submission order, on the worker the key hashes to; jobs without a key go to whichever worker is free.
+type Pool struct {
+	config Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	shared chan Job
+	shards []chan Job
+
+	mu         sync.Mutex
+	closed     bool
+	stopping   chan struct{}
+	quit       chan struct{}
+	submitting sync.WaitGroup
+	workers    sync.WaitGroup
+	pending    atomic.Int64
+}
+
+func New(config Config) *Pool {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.QueueSize < config.Workers {
+		config.QueueSize = config.Workers
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		config:   config,
+		ctx:      ctx,
+		cancel:   cancel,
+		shared:   make(chan Job, config.QueueSize),
+		shards:   make([]chan Job, config.Workers),
+		stopping: make(chan struct{}),
+		quit:     make(chan struct{}),
+	}
+	for i := range p.shards {
+		p.shards[i] = make(chan Job, config.QueueSize/config.Workers)
+	}
+
+	p.workers.Add(config.Workers)
+	for i := range p.shards {
+		go p.work(p.shards[i])
+	}
+
+	return p
+}
+
+// Submit queues a job, waiting for room while the queue is full. It fails with ctx.Err() if ctx is done
+// first, and with ErrClosed once Close was called.
+func (p *Pool) Submit(ctx context.Context, key string, job Job) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.submitting.Add(1)
+	p.mu.Unlock()
+	defer p.submitting.Done()
+
+	queue := p.shared
+	if key != "" {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(key))
+		queue = p.shards[hash.Sum32()%uint32(len(p.shards))]
+	}
+
+	p.pending.Add(1)
+	select {
+	case queue <- job:
+		return nil
+	case <-ctx.Done():
+		p.pending.Add(-1)
+		return ctx.Err()
+	case <-p.stopping:
+		p.pending.Add(-1)
+		return ErrClosed
+	}
+}
+
+// Pending returns the number of jobs queued or running.
+func (p *Pool) Pending() int {
+	return int(p.pending.Load())
+}
+
+// Close stops accepting jobs and waits for the queued and running ones to finish. If ctx is done first,
+// the root context of the jobs is cancelled, the remaining jobs run with it and Close returns ctx.Err()
+// once they did.
+func (p *Pool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.stopping)
+	p.submitting.Wait()
+	close(p.quit)
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work(shard chan Job) {
+	defer p.workers.Done()
+	for {
+		select {
+		case job := <-shard:
+			p.run(job)
+		case job := <-p.shared:
+			p.run(job)
+		case <-p.quit:
+			for {
+				select {
+				case job := <-shard:
+					p.run(job)
+				case job := <-p.shared:
+					p.run(job)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *Pool) run(job Job) {
+	defer p.pending.Add(-1)
+
+	ctx := p.ctx
+	if p.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(p.ctx, p.config.Timeout)
+		defer cancel()
+	}
+
+	job(ctx)
+}
@@ -0,0 +1,15 @@
+CREATE TABLE dead_letter (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subject varchar(255) NOT NULL,
+    messageId varchar(255) NOT NULL DEFAULT '',
+    headers jsonb NOT NULL DEFAULT '{}',
+    payload bytea NOT NULL,
+    error text NOT NULL,
+    attempts integer NOT NULL,
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    createdAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    updatedAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    resolvedAt TIMESTAMP
+);
+
+CREATE INDEX dead_letter_status_idx ON dead_letter (status, createdAt);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_tombstone;
+DROP TABLE IF EXISTS processed_event;
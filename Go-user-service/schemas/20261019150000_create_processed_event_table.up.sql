@@ -0,0 +1,9 @@
+CREATE TABLE processed_event (
+    id varchar(255) PRIMARY KEY,
+    processedAt TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
+
+CREATE TABLE account_tombstone (
+    id uuid PRIMARY KEY,
+    deletedAt TIMESTAMP NOT NULL
+);
@@ -0,0 +1,14 @@
+CREATE TABLE profile (
+    userId uuid PRIMARY KEY REFERENCES account (id) ON DELETE CASCADE,
+    displayName varchar(255) NOT NULL DEFAULT '',
+    locale varchar(35) NOT NULL DEFAULT '',
+    timeZone varchar(64) NOT NULL DEFAULT '',
+    preferences jsonb NOT NULL DEFAULT '{}',
+    avatarContentType varchar(32),
+    avatarSize bigint,
+    avatarWidth integer,
+    avatarHeight integer,
+    avatarUpdatedAt TIMESTAMP,
+    createdAt TIMESTAMP NOT NULL DEFAULT current_timestamp,
+    updatedAt TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS profile_display_name_trgm_idx;
+DROP INDEX IF EXISTS profile_search_document_idx;
+DROP INDEX IF EXISTS account_email_trgm_idx;
+DROP INDEX IF EXISTS account_search_document_idx;
+
+DROP TRIGGER IF EXISTS profile_search_document ON profile;
+DROP FUNCTION IF EXISTS profile_search_document();
+ALTER TABLE profile DROP COLUMN IF EXISTS searchDocument;
+
+DROP TRIGGER IF EXISTS account_search_document ON account;
+DROP FUNCTION IF EXISTS account_search_document();
+ALTER TABLE account DROP COLUMN IF EXISTS searchDocument;
+
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,36 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- The email is indexed whole and split into its parts, so "doe" finds "john.doe@gmail.com".
+ALTER TABLE account ADD COLUMN searchDocument tsvector NOT NULL DEFAULT ''::tsvector;
+
+CREATE FUNCTION account_search_document() RETURNS trigger AS $$
+BEGIN
+    NEW.searchDocument :=
+        setweight(to_tsvector('simple', NEW.email), 'A') ||
+        setweight(to_tsvector('simple', regexp_replace(NEW.email, '[^[:alnum:]]+', ' ', 'g')), 'B');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER account_search_document BEFORE INSERT OR UPDATE OF email ON account
+    FOR EACH ROW EXECUTE FUNCTION account_search_document();
+
+ALTER TABLE profile ADD COLUMN searchDocument tsvector NOT NULL DEFAULT ''::tsvector;
+
+CREATE FUNCTION profile_search_document() RETURNS trigger AS $$
+BEGIN
+    NEW.searchDocument := setweight(to_tsvector('simple', NEW.displayName), 'A');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER profile_search_document BEFORE INSERT OR UPDATE OF displayName ON profile
+    FOR EACH ROW EXECUTE FUNCTION profile_search_document();
+
+UPDATE account SET email = email;
+UPDATE profile SET displayName = displayName;
+
+CREATE INDEX account_search_document_idx ON account USING gin (searchDocument);
+CREATE INDEX account_email_trgm_idx ON account USING gin (email gin_trgm_ops);
+CREATE INDEX profile_search_document_idx ON profile USING gin (searchDocument);
+CREATE INDEX profile_display_name_trgm_idx ON profile USING gin (displayName gin_trgm_ops);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS event_store;
+DROP FUNCTION IF EXISTS event_store_append_only();
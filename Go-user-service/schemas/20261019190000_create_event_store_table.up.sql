@@ -0,0 +1,43 @@
+CREATE TABLE event_store (
+    position bigserial PRIMARY KEY,
+    eventId varchar(255),
+    type varchar(255) NOT NULL,
+    subject varchar(255) NOT NULL DEFAULT '',
+    dataSchema varchar(255) NOT NULL DEFAULT '',
+    data jsonb NOT NULL,
+    occurredAt TIMESTAMP NOT NULL,
+    recordedAt TIMESTAMP NOT NULL DEFAULT current_timestamp
+);
+
+CREATE UNIQUE INDEX event_store_event_id_idx ON event_store (eventId) WHERE eventId IS NOT NULL;
+CREATE INDEX event_store_recorded_at_idx ON event_store (recordedAt);
+
+CREATE FUNCTION event_store_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'event_store is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER event_store_append_only BEFORE UPDATE OR DELETE ON event_store
+    FOR EACH ROW EXECUTE FUNCTION event_store_append_only();
+CREATE TRIGGER event_store_no_truncate BEFORE TRUNCATE ON event_store
+    FOR EACH STATEMENT EXECUTE FUNCTION event_store_append_only();
+
+-- The users replicated before the event store existed are seeded as events, so that a rebuild keeps them.
+INSERT INTO event_store (type, subject, dataSchema, data, occurredAt, recordedAt)
+SELECT 'users.created', id::text, 'urn:go-practice-2023:events:users.created:v2',
+       jsonb_build_object(
+           'id', id,
+           'email', email,
+           'created_at', to_char(createdAt, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+           'updated_at', to_char(updatedAt, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')),
+       updatedAt, updatedAt
+FROM account
+ORDER BY updatedAt, id;
+
+INSERT INTO event_store (type, subject, dataSchema, data, occurredAt, recordedAt)
+SELECT 'users.deleted', id::text, 'urn:go-practice-2023:events:users.deleted:v1',
+       jsonb_build_object('id', id, 'deleted_at', to_char(deletedAt, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')),
+       deletedAt, deletedAt
+FROM account_tombstone
+ORDER BY deletedAt, id;
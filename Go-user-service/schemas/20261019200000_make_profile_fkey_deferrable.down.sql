@@ -0,0 +1,3 @@
+ALTER TABLE profile DROP CONSTRAINT profile_userid_fkey;
+ALTER TABLE profile ADD CONSTRAINT profile_userid_fkey
+    FOREIGN KEY (userId) REFERENCES account (id) ON DELETE CASCADE;
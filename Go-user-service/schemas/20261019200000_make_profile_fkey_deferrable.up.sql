@@ -0,0 +1,5 @@
+-- A cascading delete runs immediately even when the constraint is deferred, so accounts delete their profile
+-- themselves and the rebuild can replace every account in one transaction.
+ALTER TABLE profile DROP CONSTRAINT profile_userid_fkey;
+ALTER TABLE profile ADD CONSTRAINT profile_userid_fkey
+    FOREIGN KEY (userId) REFERENCES account (id) DEFERRABLE INITIALLY IMMEDIATE;
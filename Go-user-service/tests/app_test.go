@@ -1,11 +1,16 @@
 package tests
 
 import (
+	"Golang-practice-2023/api"
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/event"
 	"Golang-practice-2023/internal/domain/user"
+	profileRepository "Golang-practice-2023/internal/profile/repository"
 	"Golang-practice-2023/pkg/logger"
 	"Golang-practice-2023/tests/data"
 	"Golang-practice-2023/tests/data/provider"
 	"context"
+	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
@@ -14,6 +19,7 @@ import (
 	"net/http"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestApp(t *testing.T) {
@@ -44,6 +50,12 @@ func TestApp(t *testing.T) {
 	t.Run("service tests", func(t *testing.T) {
 		RunServiceTests(userService, userDataProvider, t)
 	})
+	t.Run("search repository tests", func(t *testing.T) {
+		RunSearchRepositoryTests(userRepository, t)
+	})
+	t.Run("profile repository tests", func(t *testing.T) {
+		RunProfileRepositoryTests(profileRepository.New(db, myLogger), userRepository, t)
+	})
 
 	t.Cleanup(func() {
 
@@ -58,13 +70,12 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 		err := repo.Create(ctx, testUser)
 		require.NoError(t, err)
 
-		query := "SELECT id, email, passwordhash FROM account WHERE id=$1"
+		query := "SELECT id, email FROM account WHERE id=$1"
 		var returnedUser user.User
 		err = repo.GetDbInstance().GetContext(ctx, &returnedUser, query, testUser.ID)
 
 		require.NoError(t, err)
 		assert.Equal(t, testUser.Email, returnedUser.Email)
-		assert.Equal(t, testUser.Passwordhash, returnedUser.Passwordhash)
 
 		repo.Delete(ctx, testUser.ID) // todo refactor
 	})
@@ -78,7 +89,6 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 
 		require.NoError(t, err)
 		assert.Equal(t, testUser.Email, returnedUser.Email)
-		assert.Equal(t, testUser.Passwordhash, returnedUser.Passwordhash)
 
 		repo.Delete(ctx, testUser.ID) // todo refactor
 	})
@@ -98,13 +108,11 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 
 		testUser2 := data.TestUser2()
 		testUser.Email = testUser2.Email
-		testUser.Passwordhash = testUser2.Passwordhash
 
 		repo.Update(ctx, testUser)
 
 		updatedTestUser, _ := repo.GetById(ctx, testUser.ID)
 		assert.Equal(t, testUser2.Email, updatedTestUser.Email)
-		assert.Equal(t, testUser2.Passwordhash, updatedTestUser.Passwordhash)
 
 		repo.Delete(ctx, testUser.ID)
 	})
@@ -120,13 +128,154 @@ func RunRepositoryTests(repo user.Repository, t *testing.T) {
 
 		require.Nil(t, returnedUser)
 	})
+	t.Run("save-replicated-user", func(t *testing.T) {
+		ctx := context.Background()
+
+		testUser := data.TestUser1WithId()
+		testUser.CreatedAt = time.Date(2023, 4, 20, 10, 0, 0, 0, time.UTC)
+		testUser.UpdatedAt = testUser.CreatedAt
+		created := newStoredEvent(t, event.SubjectUserCreated, testUser.ID, testUser)
+		require.NoError(t, repo.Save(ctx, testUser, created))
+
+		returnedUser, err := repo.GetById(ctx, testUser.ID)
+		require.NoError(t, err)
+		assert.Equal(t, testUser.Email, returnedUser.Email)
+		assert.True(t, testUser.CreatedAt.Equal(returnedUser.CreatedAt))
+
+		err = repo.Save(ctx, testUser, created)
+		assert.ErrorIs(t, err, apperrors.ErrEventAlreadyProcessed)
+
+		renamed := *testUser
+		renamed.Email = data.TestUser2().Email
+		renamed.UpdatedAt = testUser.UpdatedAt.Add(time.Minute)
+		require.NoError(t, repo.Save(ctx, &renamed, newStoredEvent(t, event.SubjectUserUpdated, renamed.ID, renamed)))
+
+		err = repo.Save(ctx, testUser, newStoredEvent(t, event.SubjectUserUpdated, testUser.ID, testUser))
+		assert.ErrorIs(t, err, apperrors.ErrStaleUserEvent)
+		returnedUser, _ = repo.GetById(ctx, testUser.ID)
+		assert.Equal(t, renamed.Email, returnedUser.Email)
+
+		deleted := event.UserDeleted{ID: testUser.ID, DeletedAt: time.Now().UTC()}
+		require.NoError(t, repo.Remove(ctx, testUser.ID, deleted.DeletedAt,
+			newStoredEvent(t, event.SubjectUserDeleted, testUser.ID, deleted)))
+		err = repo.Save(ctx, &renamed, newStoredEvent(t, event.SubjectUserUpdated, renamed.ID, renamed))
+		assert.ErrorIs(t, err, apperrors.ErrStaleUserEvent)
+		returnedUser, _ = repo.GetById(ctx, testUser.ID)
+		require.Nil(t, returnedUser)
+	})
+	t.Run("list-users", func(t *testing.T) {
+		ctx := context.Background()
+
+		testUser := data.TestUser1WithId()
+		testUser.ID = uuid.New()
+		testUser.CreatedAt = time.Date(2023, 4, 21, 10, 0, 0, 0, time.UTC)
+		testUser.UpdatedAt = testUser.CreatedAt
+		require.NoError(t, repo.Save(ctx, testUser, nil))
+
+		users, err := repo.List(ctx, user.Filter{Email: "TEST11", CreatedAfter: testUser.CreatedAt.Add(-time.Second), Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+		assert.Equal(t, testUser.ID, users[0].ID)
+
+		users, err = repo.List(ctx, user.Filter{Email: "test11", CreatedBefore: testUser.CreatedAt})
+		require.NoError(t, err)
+		assert.Empty(t, users)
+
+		users, err = repo.List(ctx, user.Filter{Email: "%"})
+		require.NoError(t, err)
+		assert.Empty(t, users, "wildcards in the email filter are matched literally")
+
+		_ = repo.Delete(ctx, testUser.ID)
+	})
+	t.Run("rebuild-projection", func(t *testing.T) {
+		ctx := context.Background()
+
+		testUser := &user.User{ID: uuid.New(), CreatedAt: time.Date(2023, 4, 22, 10, 0, 0, 0, time.UTC)}
+		testUser.Email = "rebuild-" + testUser.ID.String() + "@gmail.com"
+		testUser.UpdatedAt = testUser.CreatedAt
+		created := newStoredEvent(t, event.SubjectUserCreated, testUser.ID, testUser)
+		require.NoError(t, repo.Save(ctx, testUser, created))
+
+		renamed := *testUser
+		renamed.Email = "renamed-" + testUser.Email
+		renamed.UpdatedAt = testUser.UpdatedAt.Add(time.Minute)
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, repo.Save(ctx, &renamed, newStoredEvent(t, event.SubjectUserUpdated, renamed.ID, renamed)))
+
+		_, err := repo.GetDbInstance().ExecContext(ctx, "UPDATE account SET email='corrupt@gmail.com' WHERE id=$1", testUser.ID)
+		require.NoError(t, err)
+		_, err = repo.GetDbInstance().ExecContext(ctx, "DELETE FROM event_store WHERE position=$1", created.Position)
+		assert.Error(t, err, "the event store is append-only")
+
+		_, err = repo.GetDbInstance().ExecContext(ctx, "INSERT INTO profile (userId, displayName) VALUES ($1, 'Kept')", testUser.ID)
+		require.NoError(t, err)
+
+		var constraintBefore string
+		constraintQuery := "SELECT pg_get_constraintdef(oid) || ' ' || convalidated FROM pg_constraint WHERE conname='profile_userid_fkey'"
+		require.NoError(t, repo.GetDbInstance().GetContext(ctx, &constraintBefore, constraintQuery))
+
+		report, err := repo.Rebuild(ctx, time.Time{})
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, report.Events, 2)
+		returnedUser, err := repo.GetById(ctx, testUser.ID)
+		require.NoError(t, err)
+		assert.Equal(t, renamed.Email, returnedUser.Email)
+		assert.NotContains(t, report.OrphanedProfiles, testUser.ID)
+
+		var displayName string
+		require.NoError(t, repo.GetDbInstance().GetContext(ctx, &displayName, "SELECT displayName FROM profile WHERE userId=$1", testUser.ID))
+		assert.Equal(t, "Kept", displayName, "the profiles of replayed users are kept")
+		var constraintAfter string
+		require.NoError(t, repo.GetDbInstance().GetContext(ctx, &constraintAfter, constraintQuery))
+		assert.Equal(t, constraintBefore, constraintAfter, "a rebuild does not change the schema")
+
+		lateUser := &user.User{ID: uuid.New(), CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()}
+		lateUser.Email = "rebuild-" + lateUser.ID.String() + "@gmail.com"
+		require.NoError(t, repo.Save(ctx, lateUser, newStoredEvent(t, event.SubjectUserCreated, lateUser.ID, lateUser)))
+		_, err = repo.GetDbInstance().ExecContext(ctx, "INSERT INTO profile (userId) VALUES ($1)", lateUser.ID)
+		require.NoError(t, err)
+
+		report, err = repo.Rebuild(ctx, created.RecordedAt)
+		require.NoError(t, err)
+		returnedUser, err = repo.GetById(ctx, testUser.ID)
+		require.NoError(t, err)
+		assert.Equal(t, testUser.Email, returnedUser.Email, "the update was recorded after the point in time")
+		assert.Contains(t, report.OrphanedProfiles, lateUser.ID)
+		var profiles int
+		require.NoError(t, repo.GetDbInstance().GetContext(ctx, &profiles, "SELECT count(*) FROM profile WHERE userId=$1", lateUser.ID))
+		assert.Zero(t, profiles, "the profiles of users the replay did not bring back are deleted")
+
+		_, err = repo.Rebuild(ctx, time.Time{})
+		require.NoError(t, err)
+		deleted := event.UserDeleted{ID: testUser.ID, DeletedAt: time.Now().UTC()}
+		require.NoError(t, repo.Remove(ctx, testUser.ID, deleted.DeletedAt,
+			newStoredEvent(t, event.SubjectUserDeleted, testUser.ID, deleted)))
+	})
+}
+
+// newStoredEvent wraps payload as a newly consumed event of the latest schema version.
+func newStoredEvent(t *testing.T, eventType string, subject uuid.UUID, payload interface{}) *event.Stored {
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+	schema, err := schemas.Latest(eventType)
+	require.NoError(t, err)
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+	return &event.Stored{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		Subject:    subject.String(),
+		DataSchema: schema,
+		Data:       data,
+		OccurredAt: time.Now().UTC(),
+	}
 }
 
 func RunServiceTests(service user.Service, provider *provider.UserDataProvider, t *testing.T) {
 	t.Run("create-user", func(t *testing.T) {
 		ctx := context.Background()
 
-		testUser := provider.GenerateUserData(false, false)
+		testUser := provider.GenerateUserData(false)
 		err := service.Create(ctx, testUser)
 		require.NoError(t, err)
 
@@ -134,37 +283,27 @@ func RunServiceTests(service user.Service, provider *provider.UserDataProvider,
 
 		require.NoError(t, err)
 		assert.Equal(t, testUser.Email, createdUser.Email)
-		assert.Equal(t, testUser.Passwordhash, createdUser.Passwordhash)
 
 		service.Delete(ctx, testUser.ID)
 	})
 	t.Run("create-user-with-invalid-email", func(t *testing.T) {
 		ctx := context.Background()
 
-		testUser := provider.GenerateUserData(false, false)
+		testUser := provider.GenerateUserData(false)
 		testUser.Email = "testusergmail"
 		err := service.Create(ctx, testUser)
 		require.Error(t, err)
 	})
-	t.Run("create-user-with-invalid-password", func(t *testing.T) {
-		ctx := context.Background()
-
-		testUser := provider.GenerateUserData(false, false)
-		testUser.Passwordhash = "xx"
-		err := service.Create(ctx, testUser)
-		require.Error(t, err)
-	})
 	t.Run("get-user-by-id", func(t *testing.T) {
 		ctx := context.Background()
 
-		testUser := provider.GenerateUserData(false, false)
+		testUser := provider.GenerateUserData(false)
 		err := service.Create(ctx, testUser)
 
 		returnedUser, err := service.GetById(ctx, testUser.ID)
 
 		require.NoError(t, err)
 		assert.Equal(t, testUser.Email, returnedUser.Email)
-		assert.Equal(t, testUser.Passwordhash, returnedUser.Passwordhash)
 
 		service.Delete(ctx, testUser.ID)
 	})
@@ -178,12 +317,11 @@ func RunServiceTests(service user.Service, provider *provider.UserDataProvider,
 	t.Run("update-user", func(t *testing.T) {
 		ctx := context.Background()
 
-		testUser := provider.GenerateUserData(false, false)
+		testUser := provider.GenerateUserData(false)
 		_ = service.Create(ctx, testUser)
 
-		testUser2 := provider.GenerateUserData(false, false)
+		testUser2 := provider.GenerateUserData(false)
 		testUser.Email = testUser2.Email
-		testUser.Passwordhash = testUser2.Passwordhash
 
 		service.Update(ctx, testUser)
 
@@ -195,31 +333,12 @@ func RunServiceTests(service user.Service, provider *provider.UserDataProvider,
 	t.Run("update-user-with-invalid-email", func(t *testing.T) {
 		ctx := context.Background()
 
-		testUser := provider.GenerateUserData(false, false)
+		testUser := provider.GenerateUserData(false)
 		_ = service.Create(ctx, testUser)
 
-		testUser2 := provider.GenerateUserData(false, false)
+		testUser2 := provider.GenerateUserData(false)
 		testUser2.Email = "testusergmail"
 		testUser.Email = testUser2.Email
-		testUser.Passwordhash = testUser2.Passwordhash
-
-		service.Update(ctx, testUser)
-
-		updatedTestUser, _ := service.GetById(ctx, testUser.ID)
-		assert.NotEqual(t, testUser2.Email, updatedTestUser.Email)
-
-		service.Delete(ctx, testUser.ID)
-	})
-	t.Run("update-user-with-invalid-password", func(t *testing.T) {
-		ctx := context.Background()
-
-		testUser := provider.GenerateUserData(false, false)
-		_ = service.Create(ctx, testUser)
-
-		testUser2 := provider.GenerateUserData(false, false)
-		testUser2.Passwordhash = "xx"
-		testUser.Email = testUser2.Email
-		testUser.Passwordhash = testUser2.Passwordhash
 
 		service.Update(ctx, testUser)
 
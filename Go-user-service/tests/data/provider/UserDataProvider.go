@@ -2,8 +2,6 @@ package provider
 
 import (
 	"Golang-practice-2023/internal/domain/user"
-	"crypto/sha256"
-	"encoding/hex"
 	"github.com/google/uuid"
 	"github.com/lucasjones/reggen"
 )
@@ -15,7 +13,7 @@ func New() *UserDataProvider {
 	return &UserDataProvider{}
 }
 
-func (provider *UserDataProvider) GenerateUserData(hasId bool, isHashedPassword bool) *user.User {
+func (provider *UserDataProvider) GenerateUserData(hasId bool) *user.User {
 	var id uuid.UUID
 	if hasId {
 		id = generateId()
@@ -23,22 +21,16 @@ func (provider *UserDataProvider) GenerateUserData(hasId bool, isHashedPassword
 		id = uuid.Nil
 	}
 
-	password := generatePassword()
-	if isHashedPassword {
-		password = hashPassword(password)
-	}
-
 	return &user.User{
-		ID:           id,
-		Email:        generateEmail(),
-		Passwordhash: password,
+		ID:    id,
+		Email: generateEmail(),
 	}
 }
 
-func (provider *UserDataProvider) GenerateUserList(count int, hasId bool, isHashedPassword bool) []*user.User {
+func (provider *UserDataProvider) GenerateUserList(count int, hasId bool) []*user.User {
 	userList := make([]*user.User, count)
 	for i := 0; i < count; i++ {
-		userList[i] = provider.GenerateUserData(hasId, isHashedPassword)
+		userList[i] = provider.GenerateUserData(hasId)
 	}
 	return userList
 }
@@ -54,16 +46,3 @@ func generateEmail() string {
 	}
 	return email
 }
-
-func generatePassword() string {
-	password, err := reggen.Generate("^[a-zA-Z0-9@#$%!]{8,60}$", 25)
-	if err != nil {
-		panic(err)
-	}
-	return password
-}
-
-func hashPassword(password string) string {
-	hashed := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hashed[:])
-}
@@ -0,0 +1,342 @@
+package tests
+
+import (
+	"Golang-practice-2023/api"
+	"Golang-practice-2023/internal/deadletter/service"
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/deadletter"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/pubsub"
+	eventHandler "Golang-practice-2023/internal/transport/pubsub/handler"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/internal/transport/rest/middleware"
+	"Golang-practice-2023/pkg/logger"
+	"Golang-practice-2023/pkg/pubsub/memory"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeadLetters(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	users := newMemoryUserService()
+	userEventHandler := eventHandler.New(users, schemas, myLogger)
+	repository := newFakeDeadLetterRepository()
+	registry := prometheus.NewRegistry()
+	deadLetters, err := service.New(repository, userEventHandler.Handle, service.DefaultConfig(), registry, myLogger)
+	require.NoError(t, err)
+
+	bus := memory.New()
+	_, err = userEventHandler.Subscribe(bus, deadLetters.Middleware)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.AdminToken("secret", myLogger))
+	handler.NewDeadLetterHandler(deadLetters, myLogger).InitRoutes(adminRouter)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	id := uuid.New()
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	invalid := newEventMsg(t, event.SubjectUserCreated, event.UserCreated{ID: id, CreatedAt: createdAt, UpdatedAt: createdAt})
+	invalid.ID = "outbox-7"
+	invalid.Headers = map[string][]string{"Nats-Msg-Id": {"outbox-7"}}
+	require.NoError(t, bus.Publish(invalid), "a dead-lettered message is acked")
+
+	var letter deadletter.Message
+	t.Run("store-failed-message", func(t *testing.T) {
+		messages := repository.All()
+		require.Len(t, messages, 1)
+		letter = messages[0]
+		assert.Equal(t, event.SubjectUserCreated, letter.Subject)
+		assert.Equal(t, "outbox-7", letter.MessageID)
+		assert.Equal(t, []string{"outbox-7"}, letter.Headers["Nats-Msg-Id"])
+		assert.Equal(t, string(invalid.Data), letter.Payload)
+		assert.Contains(t, letter.Error, "email")
+		assert.Equal(t, 1, letter.Attempts)
+
+		expected := `
+			# HELP dead_letter_pending_messages Number of dead letters waiting to be replayed or discarded.
+			# TYPE dead_letter_pending_messages gauge
+			dead_letter_pending_messages 1
+		`
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "dead_letter_pending_messages"))
+	})
+	t.Run("transient-failure-before-last-attempt", func(t *testing.T) {
+		guarded := deadLetters.Middleware(func(msg *pubsub.Message) error {
+			return apperrors.ErrDbQueryProcessing
+		})
+		err := guarded(&pubsub.Message{Subject: event.SubjectUserCreated, Attempt: 1})
+		assert.ErrorIs(t, err, apperrors.ErrDbQueryProcessing, "left to the bus for redelivery")
+		assert.Len(t, repository.All(), 1)
+
+		err = guarded(&pubsub.Message{Subject: event.SubjectUserCreated, Data: []byte("{}"), Attempt: 5, LastAttempt: true})
+		assert.NoError(t, err)
+		assert.Len(t, repository.All(), 2)
+	})
+	t.Run("admin-token-required", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/admin/dead-letter")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+		for _, authorization := range []string{"secret", "Basic secret", "Bearer secret2", "Bearer  secret"} {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/admin/dead-letter", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", authorization)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, authorization)
+		}
+	})
+	t.Run("list-and-get", func(t *testing.T) {
+		var messages []deadletter.Message
+		resp := adminRequest(t, http.MethodGet, srv.URL+"/admin/dead-letter?status=pending&subject=users.created&limit=1", "", &messages)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, messages, 1)
+		assert.Equal(t, letter.ID, messages[0].ID)
+
+		resp = adminRequest(t, http.MethodGet, srv.URL+"/admin/dead-letter?status=lost", "", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		var got deadletter.Message
+		resp = adminRequest(t, http.MethodGet, srv.URL+"/admin/dead-letter/"+letter.ID.String(), "", &got)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, letter.Payload, got.Payload)
+
+		resp = adminRequest(t, http.MethodGet, srv.URL+"/admin/dead-letter/"+uuid.NewString(), "", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	t.Run("replay-failing-message", func(t *testing.T) {
+		var replayed deadletter.Message
+		resp := adminRequest(t, http.MethodPost, srv.URL+"/admin/dead-letter/"+letter.ID.String()+"/replay", "", &replayed)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, deadletter.StatusPending, replayed.Status)
+		assert.Equal(t, 2, replayed.Attempts)
+	})
+	t.Run("edit-and-replay", func(t *testing.T) {
+		var payload map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(letter.Payload), &payload))
+		payload["data"].(map[string]interface{})["email"] = "fixed@gmail.com"
+		fixed, err := json.Marshal(payload)
+		require.NoError(t, err)
+		body, err := json.Marshal(map[string]string{"payload": string(fixed)})
+		require.NoError(t, err)
+
+		var edited deadletter.Message
+		resp := adminRequest(t, http.MethodPatch, srv.URL+"/admin/dead-letter/"+letter.ID.String(), string(body), &edited)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, string(fixed), edited.Payload)
+
+		var replayed deadletter.Message
+		resp = adminRequest(t, http.MethodPost, srv.URL+"/admin/dead-letter/"+letter.ID.String()+"/replay", "", &replayed)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, deadletter.StatusReplayed, replayed.Status)
+		assert.NotNil(t, replayed.ResolvedAt)
+		assert.True(t, users.Has(id))
+
+		resp = adminRequest(t, http.MethodPost, srv.URL+"/admin/dead-letter/"+letter.ID.String()+"/replay", "", nil)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+	t.Run("replay-all-and-discard", func(t *testing.T) {
+		var report deadletter.ReplayReport
+		resp := adminRequest(t, http.MethodPost, srv.URL+"/admin/dead-letter/replay", "", &report)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, deadletter.ReplayReport{Replayed: 0, Failed: 1}, report)
+
+		var pending []deadletter.Message
+		adminRequest(t, http.MethodGet, srv.URL+"/admin/dead-letter?status=pending", "", &pending)
+		require.Len(t, pending, 1)
+
+		resp = adminRequest(t, http.MethodDelete, srv.URL+"/admin/dead-letter/"+pending[0].ID.String(), "", nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		assert.Equal(t, deadletter.StatusDiscarded, repository.All()[1].Status)
+
+		expected := `
+			# HELP dead_letter_pending_messages Number of dead letters waiting to be replayed or discarded.
+			# TYPE dead_letter_pending_messages gauge
+			dead_letter_pending_messages 0
+			# HELP dead_letter_replayed_total Number of dead letters replayed successfully.
+			# TYPE dead_letter_replayed_total counter
+			dead_letter_replayed_total 1
+		`
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+			"dead_letter_pending_messages", "dead_letter_replayed_total"))
+	})
+	t.Run("replay-once-when-concurrent", func(t *testing.T) {
+		var applied int32
+		apply := func(msg *pubsub.Message) error {
+			atomic.AddInt32(&applied, 1)
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		}
+		repository := newFakeDeadLetterRepository()
+		deadLetters, err := service.New(repository, apply, service.DefaultConfig(), prometheus.NewRegistry(), myLogger)
+		require.NoError(t, err)
+		message := &deadletter.Message{Subject: event.SubjectUserCreated, Headers: map[string][]string{}}
+		require.NoError(t, repository.Create(context.Background(), message))
+
+		var wg sync.WaitGroup
+		errs := make([]error, 5)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i == 0 {
+					errs[i] = deadLetters.Discard(context.Background(), message.ID)
+					return
+				}
+				_, errs[i] = deadLetters.Replay(context.Background(), message.ID)
+			}(i)
+		}
+		wg.Wait()
+
+		resolved := 0
+		for _, err := range errs {
+			if err == nil {
+				resolved++
+			} else {
+				assert.ErrorIs(t, err, apperrors.ErrDeadLetterResolved)
+			}
+		}
+		assert.Equal(t, 1, resolved, "a single replay or discard wins")
+		assert.LessOrEqual(t, atomic.LoadInt32(&applied), int32(1))
+		stored, err := repository.Get(context.Background(), message.ID)
+		require.NoError(t, err)
+		assert.Equal(t, atomic.LoadInt32(&applied) == 1, stored.Status == deadletter.StatusReplayed)
+	})
+}
+
+func adminRequest(t *testing.T, method string, url string, body string, result interface{}) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if result != nil && resp.StatusCode < 300 {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp
+}
+
+type fakeDeadLetterRepository struct {
+	mu        sync.Mutex
+	resolveMu sync.Mutex
+	messages  map[uuid.UUID]deadletter.Message
+}
+
+func newFakeDeadLetterRepository() *fakeDeadLetterRepository {
+	return &fakeDeadLetterRepository{messages: make(map[uuid.UUID]deadletter.Message)}
+}
+
+func (r *fakeDeadLetterRepository) All() []deadletter.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := make([]deadletter.Message, 0, len(r.messages))
+	for _, message := range r.messages {
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
+	return messages
+}
+
+func (r *fakeDeadLetterRepository) Create(ctx context.Context, message *deadletter.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	message.ID = uuid.New()
+	message.Status = deadletter.StatusPending
+	message.CreatedAt = time.Now().Add(time.Duration(len(r.messages)) * time.Millisecond)
+	message.UpdatedAt = message.CreatedAt
+	r.messages[message.ID] = *message
+	return nil
+}
+
+func (r *fakeDeadLetterRepository) Get(ctx context.Context, id uuid.UUID) (*deadletter.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	message, ok := r.messages[id]
+	if !ok {
+		return nil, apperrors.ErrDeadLetterNotFound
+	}
+	return &message, nil
+}
+
+func (r *fakeDeadLetterRepository) List(ctx context.Context, filter deadletter.Filter) ([]deadletter.Message, error) {
+	messages := make([]deadletter.Message, 0)
+	for _, message := range r.All() {
+		if (filter.Status == "" || message.Status == filter.Status) && (filter.Subject == "" || message.Subject == filter.Subject) {
+			messages = append(messages, message)
+		}
+	}
+	if filter.Limit > 0 && len(messages) > filter.Limit {
+		messages = messages[:filter.Limit]
+	}
+	return messages, nil
+}
+
+// Resolve holds resolveMu while resolve runs, as the real repository holds the row lock.
+func (r *fakeDeadLetterRepository) Resolve(ctx context.Context, id uuid.UUID, resolve func(message *deadletter.Message) error) error {
+	r.resolveMu.Lock()
+	defer r.resolveMu.Unlock()
+	message, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if message.Status != deadletter.StatusPending {
+		return apperrors.ErrDeadLetterResolved
+	}
+	if err := resolve(message); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	message.UpdatedAt = time.Now()
+	if message.Status != deadletter.StatusPending {
+		resolvedAt := time.Now()
+		message.ResolvedAt = &resolvedAt
+	}
+	r.messages[message.ID] = *message
+	return nil
+}
+
+func (r *fakeDeadLetterRepository) GetBacklog(ctx context.Context) (*deadletter.Backlog, error) {
+	backlog := &deadletter.Backlog{}
+	for _, message := range r.All() {
+		if message.Status == deadletter.StatusPending {
+			backlog.Pending++
+			if backlog.Oldest == nil {
+				createdAt := message.CreatedAt
+				backlog.Oldest = &createdAt
+			}
+		}
+	}
+	return backlog, nil
+}
@@ -0,0 +1,396 @@
+package tests
+
+import (
+	"Golang-practice-2023/api"
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/pubsub"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/transport/pubsub/handler"
+	"Golang-practice-2023/pkg/cloudevents"
+	"Golang-practice-2023/pkg/logger"
+	"Golang-practice-2023/pkg/pubsub/bus"
+	"Golang-practice-2023/pkg/pubsub/memory"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestUserEventHandler(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	service := newMemoryUserService()
+	userHandler := handler.New(service, schemas, myLogger)
+
+	id := uuid.New()
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+
+	userHandler.Created(newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+		ID: id, Email: "copy@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+	}))
+	require.Contains(t, service.users, id)
+	assert.Equal(t, "copy@gmail.com", service.users[id].Email)
+
+	updatedAt := createdAt.Add(time.Minute)
+	userHandler.Updated(newEventMsg(t, event.SubjectUserUpdated, event.UserUpdated{
+		ID: id, Email: "renamed@gmail.com", CreatedAt: createdAt, UpdatedAt: updatedAt,
+	}))
+	assert.Equal(t, "renamed@gmail.com", service.users[id].Email)
+	assert.Equal(t, updatedAt, service.users[id].UpdatedAt)
+
+	userHandler.Deleted(newEventMsg(t, event.SubjectUserDeleted, event.UserDeleted{ID: id, DeletedAt: time.Now()}))
+	assert.NotContains(t, service.users, id)
+
+	legacyId := uuid.New()
+	userHandler.Created(newLegacyMsg(t, event.SubjectNewUser, legacyUserPayload(legacyId, "legacy@gmail.com", createdAt)))
+	assert.Contains(t, service.users, legacyId)
+
+	invalidId := uuid.New()
+	userHandler.Created(newEventMsg(t, event.SubjectUserCreated, event.UserCreated{ID: invalidId}))
+	assert.NotContains(t, service.users, invalidId)
+
+	v1Id := uuid.New()
+	userHandler.Created(newVersionedEventMsg(t, event.SubjectUserCreated, cloudevents.SchemaURI(event.SubjectUserCreated, 1),
+		map[string]interface{}{"id": v1Id, "email": "v1@gmail.com", "passwordhash": "hash", "created_at": createdAt, "updated_at": createdAt}))
+	assert.Contains(t, service.users, v1Id, "v1 events are upcast without their credentials")
+
+	credentialsId := uuid.New()
+	userHandler.Created(newEventMsg(t, event.SubjectUserCreated,
+		map[string]interface{}{"id": credentialsId, "email": "v2@gmail.com", "passwordhash": "hash", "created_at": createdAt, "updated_at": createdAt}))
+	assert.NotContains(t, service.users, credentialsId, "v2 events carrying credentials are rejected")
+
+	mismatchedId := uuid.New()
+	userHandler.Deleted(newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+		ID: mismatchedId, Email: "copy@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+	}))
+	assert.NotContains(t, service.users, mismatchedId)
+}
+
+func TestUserEventHandlerIdempotency(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	service := newMemoryUserService()
+	userHandler := handler.New(service, schemas, myLogger)
+
+	id := uuid.New()
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	updatedAt := createdAt.Add(time.Minute)
+
+	created := newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+		ID: id, Email: "copy@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+	})
+	updated := newEventMsg(t, event.SubjectUserUpdated, event.UserUpdated{
+		ID: id, Email: "renamed@gmail.com", CreatedAt: createdAt, UpdatedAt: updatedAt,
+	})
+
+	t.Run("keep-source-id-and-timestamps", func(t *testing.T) {
+		require.NoError(t, userHandler.Created(created))
+		require.Contains(t, service.users, id)
+		assert.Equal(t, createdAt, service.users[id].CreatedAt)
+		assert.Equal(t, createdAt, service.users[id].UpdatedAt)
+	})
+	t.Run("acknowledge-redelivery", func(t *testing.T) {
+		require.NoError(t, userHandler.Updated(updated))
+		service.users[id] = user.User{ID: id, Email: "local@gmail.com", UpdatedAt: updatedAt}
+
+		require.NoError(t, userHandler.Updated(updated), "a redelivered event is acked")
+		assert.Equal(t, "local@gmail.com", service.users[id].Email, "and not applied again")
+	})
+	t.Run("ignore-stale-update", func(t *testing.T) {
+		require.NoError(t, userHandler.Created(newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+			ID: id, Email: "copy@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+		})))
+		assert.Equal(t, "local@gmail.com", service.users[id].Email)
+	})
+	t.Run("ignore-events-after-delete", func(t *testing.T) {
+		require.NoError(t, userHandler.Deleted(newEventMsg(t, event.SubjectUserDeleted, event.UserDeleted{ID: id, DeletedAt: time.Now()})))
+		require.NoError(t, userHandler.Updated(newEventMsg(t, event.SubjectUserUpdated, event.UserUpdated{
+			ID: id, Email: "late@gmail.com", CreatedAt: createdAt, UpdatedAt: updatedAt.Add(time.Minute),
+		})))
+		assert.NotContains(t, service.users, id)
+	})
+	t.Run("identify-legacy-messages-by-message-id", func(t *testing.T) {
+		legacyId := uuid.New()
+		msg := newLegacyMsg(t, event.SubjectNewUser, legacyUserPayload(legacyId, "legacy@gmail.com", createdAt))
+		msg.ID = "outbox-1"
+		require.NoError(t, userHandler.Created(msg))
+		assert.True(t, service.processed["outbox-1"])
+	})
+	t.Run("store-upcast-event", func(t *testing.T) {
+		legacyId := uuid.New()
+		msg := newLegacyMsg(t, event.SubjectNewUser, legacyUserPayload(legacyId, "stored@gmail.com", createdAt))
+		msg.ID = "outbox-2"
+		require.NoError(t, userHandler.Created(msg))
+
+		stored := service.events[len(service.events)-1]
+		assert.Equal(t, "outbox-2", stored.ID)
+		assert.Equal(t, event.SubjectUserCreated, stored.Type)
+		assert.Equal(t, legacyId.String(), stored.Subject)
+		assert.Equal(t, cloudevents.SchemaURI(event.SubjectUserCreated, 2), stored.DataSchema)
+		assert.False(t, stored.OccurredAt.IsZero())
+
+		var data map[string]interface{}
+		require.NoError(t, json.Unmarshal(stored.Data, &data))
+		assert.Equal(t, "stored@gmail.com", data["email"])
+		assert.NotContains(t, data, "passwordhash")
+	})
+	t.Run("key-by-user-id", func(t *testing.T) {
+		assert.Equal(t, id.String(), userHandler.Key(created))
+		assert.Equal(t, id.String(), userHandler.Key(newLegacyMsg(t, event.SubjectNewUser, event.UserCreated{ID: id})))
+		assert.Empty(t, userHandler.Key(&pubsub.Message{Data: []byte("not json")}))
+	})
+}
+
+func TestUserEventHandlerOverMemoryBus(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	config := bus.Config{Backend: bus.BackendMemory, Memory: memory.New()}
+	subscriber, err := bus.NewSubscriber(config, myLogger)
+	require.NoError(t, err)
+	publisher, err := bus.NewPublisher(config, myLogger)
+	require.NoError(t, err)
+
+	service := newMemoryUserService()
+	subscriptions, err := handler.New(service, schemas, myLogger).Subscribe(subscriber)
+	require.NoError(t, err)
+	assert.Len(t, subscriptions, 5)
+
+	id := uuid.New()
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	msg := newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+		ID: id, Email: "bus@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+	})
+	require.NoError(t, publisher.Publish(msg))
+	assert.Contains(t, service.users, id)
+
+	// A backfill republishes the user as it is now; applying it again changes nothing.
+	replayed := newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+		ID: id, Email: "bus@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+	})
+	replayed.Subject = event.SubjectUserReplay
+	require.NoError(t, publisher.Publish(replayed))
+	assert.Equal(t, "bus@gmail.com", service.users[id].Email)
+
+	backfilledId := uuid.New()
+	replayed = newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+		ID: backfilledId, Email: "backfilled@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+	})
+	replayed.Subject = event.SubjectUserReplay
+	require.NoError(t, publisher.Publish(replayed))
+	assert.Contains(t, service.users, backfilledId, "a backfill brings back the users a consumer missed")
+
+	msg = newEventMsg(t, event.SubjectUserDeleted, event.UserDeleted{ID: id, DeletedAt: time.Now()})
+	require.NoError(t, publisher.Publish(msg))
+	assert.NotContains(t, service.users, id)
+
+	require.NoError(t, subscriber.Close())
+}
+
+func TestUserEventUpcasting(t *testing.T) {
+	schemas, err := cloudevents.NewRegistry(fstest.MapFS{
+		"users.deleted.v1.json": {Data: []byte(`{"type": "object", "required": ["id"]}`)},
+		"users.deleted.v2.json": {Data: []byte(`{"type": "object", "required": ["id", "reason"]}`)},
+	})
+	require.NoError(t, err)
+
+	latest, err := schemas.Latest(event.SubjectUserDeleted)
+	require.NoError(t, err)
+	assert.Equal(t, cloudevents.SchemaURI(event.SubjectUserDeleted, 2), latest)
+
+	schemas.RegisterUpcaster(event.SubjectUserDeleted, 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var payload map[string]interface{}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, err
+		}
+		payload["reason"] = "unknown"
+		return json.Marshal(payload)
+	})
+
+	ce, err := cloudevents.New("/go-auth", event.SubjectUserDeleted, cloudevents.SchemaURI(event.SubjectUserDeleted, 1),
+		map[string]string{"id": uuid.NewString()})
+	require.NoError(t, err)
+
+	upcasted, err := schemas.Upcast(ce)
+	require.NoError(t, err)
+	assert.Equal(t, latest, upcasted.DataSchema)
+
+	var payload map[string]string
+	require.NoError(t, upcasted.DecodeData(&payload))
+	assert.Equal(t, "unknown", payload["reason"])
+
+	missing, err := cloudevents.New("/go-auth", event.SubjectUserDeleted, latest, map[string]string{"id": uuid.NewString()})
+	require.NoError(t, err)
+	_, err = schemas.Upcast(missing)
+	assert.ErrorIs(t, err, cloudevents.ErrSchemaValidation)
+}
+
+func newEventMsg(t *testing.T, subject string, payload interface{}) *pubsub.Message {
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+	schema, err := schemas.Latest(subject)
+	require.NoError(t, err)
+	return newVersionedEventMsg(t, subject, schema, payload)
+}
+
+func newVersionedEventMsg(t *testing.T, subject string, schema string, payload interface{}) *pubsub.Message {
+	ce, err := cloudevents.New("/go-auth", subject, schema, payload)
+	require.NoError(t, err)
+	data, err := json.Marshal(ce)
+	require.NoError(t, err)
+	return &pubsub.Message{Subject: subject, Data: data}
+}
+
+// legacyUserPayload is a user as published before CloudEvents, password hash included.
+func legacyUserPayload(id uuid.UUID, email string, createdAt time.Time) map[string]interface{} {
+	return map[string]interface{}{"id": id, "email": email, "passwordhash": "hash", "created_at": createdAt, "updated_at": createdAt}
+}
+
+func newLegacyMsg(t *testing.T, subject string, payload interface{}) *pubsub.Message {
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+	return &pubsub.Message{Subject: subject, Data: data}
+}
+
+// memoryUserService implements the replication part of user.Service on a map, with the same deduplication
+// and ordering rules as the repository, keeping the events it is given in events. Errors queued in saveErrs
+// fail the next calls to Save.
+type memoryUserService struct {
+	user.Service
+	mu        sync.Mutex
+	users     map[uuid.UUID]user.User
+	deleted   map[uuid.UUID]bool
+	processed map[string]bool
+	events    []event.Stored
+	saves     int
+	saveErrs  []error
+}
+
+func newMemoryUserService() *memoryUserService {
+	return &memoryUserService{
+		users:     make(map[uuid.UUID]user.User),
+		deleted:   make(map[uuid.UUID]bool),
+		processed: make(map[string]bool),
+	}
+}
+
+func (s *memoryUserService) Save(ctx context.Context, u *user.User, e *event.Stored) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves++
+	if len(s.saveErrs) > 0 {
+		err := s.saveErrs[0]
+		s.saveErrs = s.saveErrs[1:]
+		return err
+	}
+	if err := s.process(e); err != nil {
+		return err
+	}
+	if stored, ok := s.users[u.ID]; s.deleted[u.ID] || ok && stored.UpdatedAt.After(u.UpdatedAt) {
+		return apperrors.ErrStaleUserEvent
+	}
+	s.users[u.ID] = *u
+	return nil
+}
+
+func (s *memoryUserService) Remove(ctx context.Context, id uuid.UUID, deletedAt time.Time, e *event.Stored) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.process(e); err != nil {
+		return err
+	}
+	delete(s.users, id)
+	s.deleted[id] = true
+	return nil
+}
+
+func (s *memoryUserService) process(e *event.Stored) error {
+	if e == nil {
+		return nil
+	}
+	if e.ID != "" {
+		if s.processed[e.ID] {
+			return apperrors.ErrEventAlreadyProcessed
+		}
+		s.processed[e.ID] = true
+	}
+	s.events = append(s.events, *e)
+	return nil
+}
+
+func (s *memoryUserService) GetById(ctx context.Context, id uuid.UUID) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, apperrors.ErrUserNotFound
+	}
+	return &u, nil
+}
+
+func (s *memoryUserService) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, apperrors.ErrUserNotFound
+}
+
+func (s *memoryUserService) List(ctx context.Context, filter user.Filter) ([]user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make([]user.User, 0)
+	for _, u := range s.users {
+		if strings.Contains(strings.ToLower(u.Email), strings.ToLower(filter.Email)) &&
+			(filter.CreatedAfter.IsZero() || u.CreatedAt.After(filter.CreatedAfter)) &&
+			(filter.CreatedBefore.IsZero() || u.CreatedAt.Before(filter.CreatedBefore)) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	if filter.Offset >= len(users) {
+		return []user.User{}, nil
+	}
+	users = users[filter.Offset:]
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+func (s *memoryUserService) Has(id uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.users[id]
+	return ok
+}
+
+func (s *memoryUserService) Saves() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
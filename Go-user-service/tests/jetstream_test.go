@@ -0,0 +1,311 @@
+package tests
+
+import (
+	"Golang-practice-2023/api"
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/transport/pubsub/handler"
+	"Golang-practice-2023/pkg/logger"
+	"Golang-practice-2023/pkg/pubsub/bus"
+	"Golang-practice-2023/pkg/pubsub/nats/pub"
+	"Golang-practice-2023/pkg/pubsub/nats/stream"
+	"Golang-practice-2023/pkg/pubsub/nats/sub"
+	"Golang-practice-2023/pkg/pubsub/worker"
+	"context"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJetStreamDurableConsumer(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	natsServer := runJetStreamServer(t)
+	streamConfig := stream.DefaultUsersConfig()
+	consumerConfig := sub.DefaultConfig("go-users")
+	consumerConfig.FetchWait = 100 * time.Millisecond
+	consumerConfig.MaxDeliver = 3
+	consumerConfig.BackOff = []time.Duration{10 * time.Millisecond}
+
+	publisher, err := pub.New(natsServer.ClientURL(), streamConfig, myLogger)
+	require.NoError(t, err)
+	defer func() {
+		_ = publisher.Close()
+	}()
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	newCreated := func(id uuid.UUID) event.UserCreated {
+		return event.UserCreated{ID: id, Email: "durable@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt}
+	}
+
+	// Published before the user service ever started: the stream keeps it for the durable consumer.
+	first := uuid.New()
+	require.NoError(t, publisher.Publish(newEventMsg(t, event.SubjectUserCreated, newCreated(first))))
+
+	service := newMemoryUserService()
+	service.saveErrs = []error{apperrors.ErrDbQueryProcessing}
+
+	subscriber, err := sub.New(natsServer.ClientURL(), streamConfig, consumerConfig, myLogger)
+	require.NoError(t, err)
+	_, err = handler.New(service, schemas, myLogger).Subscribe(subscriber)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return service.Has(first) }, 5*time.Second, 10*time.Millisecond,
+		"nak'ed message is redelivered")
+	assert.Equal(t, 2, service.Saves())
+	require.NoError(t, subscriber.Close())
+
+	// Published while the user service is down.
+	second := uuid.New()
+	require.NoError(t, publisher.Publish(newEventMsg(t, event.SubjectUserCreated, newCreated(second))))
+
+	subscriber, err = sub.New(natsServer.ClientURL(), streamConfig, consumerConfig, myLogger)
+	require.NoError(t, err)
+	_, err = handler.New(service, schemas, myLogger).Subscribe(subscriber)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return service.Has(second) }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 3, service.Saves(), "acked messages are not delivered again after a restart")
+
+	// A message that keeps failing is given up after MaxDeliver attempts.
+	poisoned := uuid.New()
+	service.mu.Lock()
+	service.saveErrs = []error{apperrors.ErrDbQueryProcessing, apperrors.ErrDbQueryProcessing,
+		apperrors.ErrDbQueryProcessing, apperrors.ErrDbQueryProcessing}
+	service.mu.Unlock()
+	require.NoError(t, publisher.Publish(newEventMsg(t, event.SubjectUserCreated, newCreated(poisoned))))
+
+	assert.Eventually(t, func() bool { return service.Saves() == 6 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 6, service.Saves())
+	assert.False(t, service.Has(poisoned))
+
+	require.NoError(t, subscriber.Close())
+
+	js, err := publisher.Conn.JetStream()
+	require.NoError(t, err)
+	consumer, err := js.ConsumerInfo(streamConfig.Name, sub.ConsumerName("go-users", event.SubjectUserCreated))
+	require.NoError(t, err)
+	assert.Equal(t, 0, consumer.NumAckPending)
+	assert.Equal(t, uint64(0), consumer.NumPending)
+}
+
+func TestJetStreamWorkerPool(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	natsServer := runJetStreamServer(t)
+	streamConfig := stream.DefaultUsersConfig()
+	consumerConfig := sub.DefaultConfig("go-users")
+	consumerConfig.FetchWait = 100 * time.Millisecond
+	consumerConfig.BackOff = []time.Duration{10 * time.Millisecond}
+	consumerConfig.Workers = worker.Config{Workers: 4, QueueSize: 4, Timeout: time.Second}
+
+	publisher, err := pub.New(natsServer.ClientURL(), streamConfig, myLogger)
+	require.NoError(t, err)
+	defer func() {
+		_ = publisher.Close()
+	}()
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	ids := make([]uuid.UUID, 8)
+	for i := range ids {
+		ids[i] = uuid.New()
+		require.NoError(t, publisher.Publish(newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+			ID: ids[i], Email: "pool@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+		})))
+	}
+
+	service := &slowUserService{memoryUserService: newMemoryUserService(), release: make(chan struct{})}
+	userHandler := handler.New(service, schemas, myLogger)
+
+	subscriber, err := sub.New(natsServer.ClientURL(), streamConfig, consumerConfig, myLogger)
+	require.NoError(t, err)
+	_, err = userHandler.Subscribe(subscriber)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return service.running.Load() == 4 }, 5*time.Second, time.Millisecond,
+		"messages are handled concurrently")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(4), service.maxRunning.Load(), "by at most Workers handlers")
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- subscriber.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while handlers were running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(service.release)
+	require.NoError(t, <-closed)
+
+	js, err := publisher.Conn.JetStream()
+	require.NoError(t, err)
+	consumer, err := js.ConsumerInfo(streamConfig.Name, sub.ConsumerName("go-users", event.SubjectUserCreated))
+	require.NoError(t, err)
+	assert.Equal(t, 0, consumer.NumAckPending, "fetched messages are acked or handed back on close")
+	assert.GreaterOrEqual(t, service.Saves(), 4)
+
+	subscriber, err = sub.New(natsServer.ClientURL(), streamConfig, consumerConfig, myLogger)
+	require.NoError(t, err)
+	_, err = userHandler.Subscribe(subscriber)
+	require.NoError(t, err)
+	defer func() {
+		_ = subscriber.Close()
+	}()
+
+	assert.Eventually(t, func() bool {
+		for _, id := range ids {
+			if !service.Has(id) {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestJetStreamConsumerGroup(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	schemas, err := api.NewEventRegistry()
+	require.NoError(t, err)
+
+	natsServer := runJetStreamServer(t)
+	streamConfig := stream.DefaultUsersConfig()
+
+	// One message at a time per replica, so that the replicas take turns.
+	newReplica := func(group string) *countingUserService {
+		config := bus.Config{Backend: bus.BackendNats, NatsURL: natsServer.ClientURL(), Group: group}
+		consumerConfig := sub.DefaultConfig(group)
+		consumerConfig.BatchSize = 1
+		consumerConfig.FetchWait = 100 * time.Millisecond
+		consumerConfig.Workers = worker.Config{Workers: 1, QueueSize: 1, Timeout: time.Second}
+		config.Consumer = &consumerConfig
+
+		service := &countingUserService{memoryUserService: newMemoryUserService(), handled: make(map[uuid.UUID]int)}
+		subscriber, err := bus.NewSubscriber(config, myLogger)
+		require.NoError(t, err)
+		_, err = handler.New(service, schemas, myLogger).Subscribe(subscriber)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = subscriber.Close()
+		})
+		return service
+	}
+
+	replicas := make([]*countingUserService, 2)
+	for i := range replicas {
+		replicas[i] = newReplica("go-users")
+	}
+	other := newReplica("go-audit")
+
+	publisher, err := pub.New(natsServer.ClientURL(), streamConfig, myLogger)
+	require.NoError(t, err)
+	defer func() {
+		_ = publisher.Close()
+	}()
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	ids := make([]uuid.UUID, 20)
+	for i := range ids {
+		ids[i] = uuid.New()
+		require.NoError(t, publisher.Publish(newEventMsg(t, event.SubjectUserCreated, event.UserCreated{
+			ID: ids[i], Email: "group@gmail.com", CreatedAt: createdAt, UpdatedAt: createdAt,
+		})))
+	}
+
+	handledBy := func(id uuid.UUID) int {
+		return replicas[0].Handled(id) + replicas[1].Handled(id)
+	}
+	require.Eventually(t, func() bool {
+		for _, id := range ids {
+			if handledBy(id) == 0 || other.Handled(id) == 0 {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+	time.Sleep(200 * time.Millisecond)
+
+	for _, id := range ids {
+		assert.Equal(t, 1, handledBy(id), "exactly one replica of the group handles %s", id)
+		assert.Equal(t, 1, other.Handled(id), "another group gets its own copy of %s", id)
+	}
+	assert.NotZero(t, replicas[0].Saves())
+	assert.NotZero(t, replicas[1].Saves())
+}
+
+// countingUserService counts the saves of each user after a short delay.
+type countingUserService struct {
+	*memoryUserService
+	handledMu sync.Mutex
+	handled   map[uuid.UUID]int
+}
+
+func (s *countingUserService) Save(ctx context.Context, u *user.User, e *event.Stored) error {
+	time.Sleep(5 * time.Millisecond)
+	s.handledMu.Lock()
+	s.handled[u.ID]++
+	s.handledMu.Unlock()
+	return s.memoryUserService.Save(ctx, u, e)
+}
+
+func (s *countingUserService) Handled(id uuid.UUID) int {
+	s.handledMu.Lock()
+	defer s.handledMu.Unlock()
+	return s.handled[id]
+}
+
+// slowUserService holds every Save until release is closed or the handling times out.
+type slowUserService struct {
+	*memoryUserService
+	release    chan struct{}
+	running    atomic.Int32
+	maxRunning atomic.Int32
+}
+
+func (s *slowUserService) Save(ctx context.Context, u *user.User, e *event.Stored) error {
+	n := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		m := s.maxRunning.Load()
+		if n <= m || s.maxRunning.CompareAndSwap(m, n) {
+			break
+		}
+	}
+
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.memoryUserService.Save(ctx, u, e)
+}
+
+func runJetStreamServer(t *testing.T) *server.Server {
+	natsServer, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	require.NoError(t, err)
+	go natsServer.Start()
+	require.True(t, natsServer.ReadyForConnections(5*time.Second))
+	t.Cleanup(natsServer.Shutdown)
+	return natsServer
+}
@@ -0,0 +1,371 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/apperrors"
+	"Golang-practice-2023/internal/domain/event"
+	"Golang-practice-2023/internal/domain/profile"
+	"Golang-practice-2023/internal/domain/user"
+	profileService "Golang-practice-2023/internal/profile/service"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/internal/transport/rest/middleware"
+	userService "Golang-practice-2023/internal/user/service"
+	"Golang-practice-2023/pkg/blobstore/filesystem"
+	"Golang-practice-2023/pkg/logger"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "secret"
+
+func TestProfileApi(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	blobDir := t.TempDir()
+	blobs, err := filesystem.New(blobDir)
+	require.NoError(t, err)
+
+	userId := uuid.New()
+	repository := newMemoryProfileRepository(userId)
+	config := profileService.DefaultConfig()
+	config.MaxAvatarBytes = 64 << 10
+	config.MaxAvatarDimension = 1024
+
+	profiles := profileService.New(repository, blobs, config, myLogger)
+	router := mux.NewRouter()
+	handler.NewProfileHandler(profiles, myLogger).InitRoutes(router.PathPrefix("/v1").Subrouter(),
+		middleware.AdminToken(testAdminToken, myLogger))
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	profileUrl := srv.URL + "/v1/user/" + userId.String() + "/profile"
+
+	t.Run("save-and-get", func(t *testing.T) {
+		resp := putJson(t, profileUrl, `{"display_name": "  Ada  ", "locale": "en-GB", "time_zone": "Europe/London",
+			"preferences": {"theme": "dark", "digest": {"weekly": true}}}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var saved profile.Profile
+		resp = getJson(t, profileUrl, &saved)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, userId, saved.UserID)
+		assert.Equal(t, "Ada", saved.DisplayName)
+		assert.Equal(t, "en-GB", saved.Locale)
+		assert.Equal(t, "Europe/London", saved.TimeZone)
+		assert.JSONEq(t, `{"theme": "dark", "digest": {"weekly": true}}`, string(saved.Preferences))
+		assert.Nil(t, saved.Avatar)
+
+		resp = putJson(t, profileUrl, `{"display_name": "Ada L."}`)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		getJson(t, profileUrl, &saved)
+		assert.Equal(t, "", saved.Locale, "a save replaces the whole profile")
+		assert.JSONEq(t, `{}`, string(saved.Preferences))
+	})
+	t.Run("reject-invalid-profile", func(t *testing.T) {
+		for _, body := range []string{
+			`{"display_name": "` + strings.Repeat("a", 65) + `"}`,
+			`{"display_name": "tab\there"}`,
+			`{"locale": "english please"}`,
+			`{"time_zone": "Mars/Olympus_Mons"}`,
+			`{"time_zone": "Local"}`,
+			`{"preferences": ["dark"]}`,
+			`{"preferences": null}`,
+			`not json`,
+		} {
+			resp := putJson(t, profileUrl, body)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		}
+
+		resp := putJson(t, srv.URL+"/v1/user/"+uuid.NewString()+"/profile", `{"display_name": "Nobody"}`)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "profiles belong to replicated users")
+	})
+	t.Run("require-admin-token-for-writes", func(t *testing.T) {
+		for _, r := range []struct {
+			method string
+			url    string
+		}{
+			{http.MethodPut, profileUrl},
+			{http.MethodDelete, profileUrl},
+			{http.MethodPut, profileUrl + "/avatar"},
+			{http.MethodDelete, profileUrl + "/avatar"},
+		} {
+			req, err := http.NewRequest(r.method, r.url, strings.NewReader(`{"display_name": "Mallory"}`))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer wrong")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, r.method+" "+r.url)
+		}
+
+		var saved profile.Profile
+		resp := getJson(t, profileUrl, &saved)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "reads need no token")
+		assert.Equal(t, "Ada L.", saved.DisplayName)
+	})
+	t.Run("upload-avatar", func(t *testing.T) {
+		resp := put(t, profileUrl+"/avatar", "application/octet-stream", encodePng(t, 400, 200))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var saved profile.Profile
+		getJson(t, profileUrl, &saved)
+		require.NotNil(t, saved.Avatar)
+		assert.Equal(t, "image/png", saved.Avatar.ContentType)
+		assert.Equal(t, 400, saved.Avatar.Width)
+		assert.Equal(t, 200, saved.Avatar.Height)
+
+		resp, err := http.Get(profileUrl + "/avatar")
+		require.NoError(t, err)
+		original, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+		assert.Equal(t, int64(len(original)), saved.Avatar.Size)
+
+		resp, err = http.Get(profileUrl + "/avatar/thumbnail")
+		require.NoError(t, err)
+		thumbnail, err := png.Decode(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 128, 64), thumbnail.Bounds())
+		r, g, b, _ := thumbnail.At(10, 10).RGBA()
+		assert.Equal(t, [3]uint32{0xffff, 0, 0}, [3]uint32{r, g, b}, "the left half stays red")
+	})
+	t.Run("reject-invalid-avatar", func(t *testing.T) {
+		resp := put(t, profileUrl+"/avatar", "image/png", []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode, "the declared content type is not trusted")
+
+		truncated := encodePng(t, 64, 64)[:100]
+		resp = put(t, profileUrl+"/avatar", "image/png", truncated)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp = put(t, profileUrl+"/avatar", "image/png", append(encodePng(t, 8, 8), make([]byte, 64<<10)...))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+		resp = put(t, profileUrl+"/avatar", "image/png", encodePng(t, 2000, 1))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+		var saved profile.Profile
+		getJson(t, profileUrl, &saved)
+		require.NotNil(t, saved.Avatar)
+		assert.Equal(t, 400, saved.Avatar.Width, "rejected uploads keep the previous avatar")
+	})
+	t.Run("delete", func(t *testing.T) {
+		resp := request(t, http.MethodDelete, profileUrl+"/avatar", "", nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		resp = getJson(t, profileUrl+"/avatar", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		_, err := os.Stat(filepath.Join(blobDir, "avatars", userId.String(), "original"))
+		assert.True(t, os.IsNotExist(err))
+
+		resp = request(t, http.MethodDelete, profileUrl, "", nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		resp = getJson(t, profileUrl, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp = request(t, http.MethodDelete, profileUrl, "", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+	t.Run("remove-user-deletes-avatar", func(t *testing.T) {
+		resp := putJson(t, profileUrl, `{"display_name": "Ada"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		resp = put(t, profileUrl+"/avatar", "application/octet-stream", encodePng(t, 16, 16))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		users := userService.New(&cascadingUserRepository{profiles: repository}, myLogger)
+		users.OnRemove(profiles.OnUserRemoved)
+		require.NoError(t, users.Remove(context.Background(), userId, time.Now(), nil))
+
+		for _, name := range []string{"original", "thumbnail.png"} {
+			_, err := os.Stat(filepath.Join(blobDir, "avatars", userId.String(), name))
+			assert.True(t, os.IsNotExist(err), name)
+		}
+	})
+}
+
+func RunProfileRepositoryTests(repo profile.Repository, users user.Repository, t *testing.T) {
+	t.Run("save-profile", func(t *testing.T) {
+		ctx := context.Background()
+
+		owner := &user.User{ID: uuid.New(), Email: "profile@gmail.com", CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()}
+		require.NoError(t, users.Save(ctx, owner, nil))
+
+		p := &profile.Profile{UserID: owner.ID, DisplayName: "Ada", Preferences: json.RawMessage(`{"theme": "dark"}`)}
+		require.NoError(t, repo.Save(ctx, p))
+		assert.False(t, p.CreatedAt.IsZero())
+
+		avatar := &profile.Avatar{ContentType: "image/png", Size: 10, Width: 2, Height: 1, UpdatedAt: time.Now().UTC()}
+		require.NoError(t, repo.SetAvatar(ctx, owner.ID, avatar))
+		p.DisplayName = "Ada L."
+		require.NoError(t, repo.Save(ctx, p))
+
+		saved, err := repo.Get(ctx, owner.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Ada L.", saved.DisplayName)
+		assert.JSONEq(t, `{"theme": "dark"}`, string(saved.Preferences))
+		require.NotNil(t, saved.Avatar, "saving keeps the avatar")
+		assert.Equal(t, 2, saved.Avatar.Width)
+
+		err = repo.Save(ctx, &profile.Profile{UserID: uuid.New(), Preferences: json.RawMessage(`{}`)})
+		assert.ErrorIs(t, err, apperrors.ErrUserNotFound)
+
+		_ = users.Delete(ctx, owner.ID)
+		_, err = repo.Get(ctx, owner.ID)
+		assert.ErrorIs(t, err, apperrors.ErrProfileNotFound, "profiles go away with their user")
+	})
+}
+
+func TestFilesystemBlobStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := filesystem.New(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(ctx, "a/b/c", strings.NewReader("first")))
+	require.NoError(t, store.Put(ctx, "a/b/c", strings.NewReader("second")))
+	content, err := store.Get(ctx, "a/b/c")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, "second", string(data))
+
+	require.NoError(t, store.Delete(ctx, "a/b/c"))
+	require.NoError(t, store.Delete(ctx, "a/b/c"))
+	_, err = store.Get(ctx, "a/b/c")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, key := range []string{"../escape", "/absolute", "a/../../b", ""} {
+		assert.ErrorIs(t, store.Put(ctx, key, strings.NewReader("x")), filesystem.ErrInvalidKey, key)
+	}
+}
+
+func encodePng(t *testing.T, width int, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 0xff, A: 0xff})
+			} else {
+				img.Set(x, y, color.RGBA{B: 0xff, A: 0xff})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func putJson(t *testing.T, url string, body string) *http.Response {
+	return put(t, url, "application/json", []byte(body))
+}
+
+func put(t *testing.T, url string, contentType string, body []byte) *http.Response {
+	return request(t, http.MethodPut, url, contentType, body)
+}
+
+func request(t *testing.T, method string, url string, contentType string, body []byte) *http.Response {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+// memoryProfileRepository keeps profiles in a map; only the given users exist.
+type memoryProfileRepository struct {
+	mu       sync.Mutex
+	users    map[uuid.UUID]bool
+	profiles map[uuid.UUID]profile.Profile
+}
+
+func newMemoryProfileRepository(userIds ...uuid.UUID) *memoryProfileRepository {
+	r := &memoryProfileRepository{users: make(map[uuid.UUID]bool), profiles: make(map[uuid.UUID]profile.Profile)}
+	for _, id := range userIds {
+		r.users[id] = true
+	}
+	return r
+}
+
+func (r *memoryProfileRepository) Get(ctx context.Context, userID uuid.UUID) (*profile.Profile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.profiles[userID]
+	if !ok {
+		return nil, apperrors.ErrProfileNotFound
+	}
+	return &p, nil
+}
+
+func (r *memoryProfileRepository) Save(ctx context.Context, p *profile.Profile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.users[p.UserID] {
+		return apperrors.ErrUserNotFound
+	}
+	now := time.Now().UTC()
+	p.CreatedAt, p.UpdatedAt, p.Avatar = now, now, nil
+	if existing, ok := r.profiles[p.UserID]; ok {
+		p.CreatedAt, p.Avatar = existing.CreatedAt, existing.Avatar
+	}
+	p.Preferences = append(json.RawMessage(nil), p.Preferences...)
+	r.profiles[p.UserID] = *p
+	return nil
+}
+
+func (r *memoryProfileRepository) SetAvatar(ctx context.Context, userID uuid.UUID, avatar *profile.Avatar) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.profiles[userID]
+	if !ok {
+		return apperrors.ErrProfileNotFound
+	}
+	p.Avatar = avatar
+	r.profiles[userID] = p
+	return nil
+}
+
+func (r *memoryProfileRepository) Delete(ctx context.Context, userID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.profiles[userID]; !ok {
+		return apperrors.ErrProfileNotFound
+	}
+	delete(r.profiles, userID)
+	return nil
+}
+
+// cascadingUserRepository removes users like the database does, taking their profile with them.
+type cascadingUserRepository struct {
+	user.Repository
+	profiles *memoryProfileRepository
+}
+
+func (r *cascadingUserRepository) Remove(ctx context.Context, id uuid.UUID, deletedAt time.Time, e *event.Stored) error {
+	r.profiles.mu.Lock()
+	defer r.profiles.mu.Unlock()
+	delete(r.profiles.users, id)
+	delete(r.profiles.profiles, id)
+	return nil
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/pkg/logger"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUserReadApi(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	service := newMemoryUserService()
+	registeredAt := time.Date(2023, 4, 20, 10, 0, 0, 0, time.UTC)
+	users := make([]user.User, 5)
+	for i := range users {
+		users[i] = user.User{
+			ID:        uuid.New(),
+			Email:     "reader" + string(rune('a'+i)) + "@gmail.com",
+			CreatedAt: registeredAt.Add(time.Duration(i) * time.Hour),
+			UpdatedAt: registeredAt.Add(time.Duration(i) * time.Hour),
+		}
+		service.users[users[i].ID] = users[i]
+	}
+
+	router := mux.NewRouter()
+	handler.NewUserHandler(service, myLogger).InitRoutes(router.PathPrefix("/v1").Subrouter())
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	t.Run("get-by-id", func(t *testing.T) {
+		var body map[string]interface{}
+		resp := getJson(t, srv.URL+"/v1/user/"+users[0].ID.String(), &body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, users[0].Email, body["email"])
+		assert.NotContains(t, body, "passwordhash", "credentials are not served")
+	})
+	t.Run("get-by-email", func(t *testing.T) {
+		var body handler.UserResponse
+		resp := getJson(t, srv.URL+"/v1/user?email="+url.QueryEscape(users[2].Email), &body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, users[2].ID, body.ID)
+
+		var problem handler.Problem
+		resp = getJson(t, srv.URL+"/v1/user?email=nobody%40gmail.com", &problem)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, http.StatusNotFound, problem.Status)
+	})
+	t.Run("list", func(t *testing.T) {
+		var page []map[string]interface{}
+		resp := getJson(t, srv.URL+"/v1/user?offset=1&limit=2", &page)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, page, 2)
+		assert.Equal(t, users[1].Email, page[0]["email"])
+		assert.Equal(t, users[2].Email, page[1]["email"])
+		assert.NotContains(t, page[0], "passwordhash")
+
+		var filtered []handler.UserResponse
+		after := url.QueryEscape(registeredAt.Add(90 * time.Minute).Format(time.RFC3339))
+		getJson(t, srv.URL+"/v1/user?q=READER&created_after="+after, &filtered)
+		require.Len(t, filtered, 3)
+		assert.Equal(t, users[2].ID, filtered[0].ID)
+	})
+	t.Run("problem-details", func(t *testing.T) {
+		for _, path := range []string{"/v1/user/not-a-uuid", "/v1/user?limit=-1", "/v1/user?created_after=yesterday"} {
+			var problem handler.Problem
+			resp := getJson(t, srv.URL+path, &problem)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+			assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"), path)
+			assert.Equal(t, handler.Problem{Type: "about:blank", Title: "Bad Request", Status: 400, Detail: problem.Detail}, problem)
+			assert.NotEmpty(t, problem.Detail, path)
+		}
+
+		resp := getJson(t, srv.URL+"/v1/user/"+uuid.NewString(), nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func getJson(t *testing.T, url string, result interface{}) *http.Response {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if result != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp
+}
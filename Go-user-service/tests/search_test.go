@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"Golang-practice-2023/internal/domain/user"
+	"Golang-practice-2023/internal/transport/rest/handler"
+	"Golang-practice-2023/pkg/logger"
+	"context"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUserSearch(t *testing.T) {
+	zeroLogLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	myLogger, _ := logger.New(os.Getenv("LOG_LEVEL"), &zeroLogLogger)
+
+	repository := &searchRepository{results: []user.SearchResult{
+		{User: user.User{ID: uuid.New(), Email: "john.doe@gmail.com"}, DisplayName: "Johnny <b>Doe</b>", Rank: 0.9},
+		{User: user.User{ID: uuid.New(), Email: "jon.dow@gmail.com"}, Rank: 0.4},
+	}}
+	userService, err := NewUserService(repository, myLogger)
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	handler.NewUserHandler(userService, myLogger).InitRoutes(router.PathPrefix("/v1").Subrouter())
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	t.Run("search", func(t *testing.T) {
+		var results []handler.SearchResponse
+		resp := getJson(t, srv.URL+"/v1/user/search?q=John+D%C3%B6e&offset=1&limit=5", &results)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, user.SearchQuery{Text: "John Döe", Offset: 1, Limit: 5}, repository.query)
+		assert.Equal(t, []string{"john", "döe"}, repository.query.Terms())
+
+		require.Len(t, results, 2)
+		assert.Equal(t, repository.results[0].ID, results[0].ID)
+		assert.Equal(t, "Johnny <b>Doe</b>", results[0].DisplayName)
+		assert.Equal(t, 0.9, results[0].Rank)
+		assert.Equal(t, "<mark>john</mark>.doe@gmail.com", results[0].Highlight.Email)
+		assert.Equal(t, "<mark>John</mark>ny &lt;b&gt;Doe&lt;/b&gt;", results[0].Highlight.DisplayName,
+			"highlights are escaped HTML")
+		assert.Equal(t, "jon.dow@gmail.com", results[1].Highlight.Email, "fuzzy matches are not marked")
+	})
+	t.Run("page-limits", func(t *testing.T) {
+		getJson(t, srv.URL+"/v1/user/search?q=john", nil)
+		assert.Equal(t, 20, repository.query.Limit)
+		getJson(t, srv.URL+"/v1/user/search?q=john&limit=1000", nil)
+		assert.Equal(t, 100, repository.query.Limit)
+	})
+	t.Run("reject-invalid-query", func(t *testing.T) {
+		for _, path := range []string{"/v1/user/search", "/v1/user/search?q=+++", "/v1/user/search?q=" + strings.Repeat("a", 101),
+			"/v1/user/search?q=john&offset=-1"} {
+			var problem handler.Problem
+			resp := getJson(t, srv.URL+path, &problem)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+		}
+	})
+}
+
+func RunSearchRepositoryTests(repo user.Repository, t *testing.T) {
+	t.Run("search-users", func(t *testing.T) {
+		ctx := context.Background()
+
+		found := &user.User{ID: uuid.New(), Email: "margaret.hamilton@nasa.gov"}
+		other := &user.User{ID: uuid.New(), Email: "grace.hopper@navy.mil"}
+		require.NoError(t, repo.Create(ctx, found))
+		require.NoError(t, repo.Create(ctx, other))
+
+		for _, text := range []string{"hamilton", "marg ham", "Margaret.Hamilton@nasa.gov", "hamliton"} {
+			results, err := repo.Search(ctx, user.SearchQuery{Text: text, Limit: 10})
+			require.NoError(t, err, text)
+			require.NotEmpty(t, results, text)
+			assert.Equal(t, found.ID, results[0].ID, text)
+			assert.Greater(t, results[0].Rank, 0.0, text)
+		}
+
+		results, err := repo.Search(ctx, user.SearchQuery{Text: "hamilton", Offset: 1, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, results)
+
+		_ = repo.Delete(ctx, found.ID)
+		_ = repo.Delete(ctx, other.ID)
+	})
+}
+
+// searchRepository records the last search and answers it with fixed results.
+type searchRepository struct {
+	user.Repository
+	query   user.SearchQuery
+	results []user.SearchResult
+}
+
+func (r *searchRepository) Search(ctx context.Context, query user.SearchQuery) ([]user.SearchResult, error) {
+	r.query = query
+	results := make([]user.SearchResult, len(r.results))
+	copy(results, r.results)
+	return results, nil
+}